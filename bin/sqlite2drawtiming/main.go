@@ -85,24 +85,29 @@ func main() {
 	q := fmt.Sprintf(`
         SELECT
             s.Name,
-            v.Timestamp,
-            v.Value
+            Svalues.Timestamp,
+            -- Enum signals show the names of their values.
+            IFNULL(EnumValues.Name, Svalues.Value)
         FROM
-            Svalues v
+            Svalues
         JOIN
             Signals s
         ON
-            s.Code = v.Code
+            s.Code = Svalues.Code
+        LEFT JOIN
+            EnumValues
+        ON
+            %v
         WHERE
-            (v.Timestamp >= ?)
+            (Svalues.Timestamp >= ?)
                 AND
-            (v.Timestamp <= ?)
+            (Svalues.Timestamp <= ?)
                 AND
             s.Name IN (%v)
         ORDER BY
-            v.Timestamp
+            Svalues.Timestamp
         ;
-    `, signals.String())
+    `, db.EnumValueJoin, signals.String())
 
 	rows, err := dbx.QueryContext(ctx, q, minTime, maxTime)
 	if err != nil {
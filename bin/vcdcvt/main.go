@@ -5,37 +5,87 @@ import (
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"math"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/filmil/go-vcd-parser/cvt"
 	"github.com/filmil/go-vcd-parser/db"
+	"github.com/filmil/go-vcd-parser/fst"
+	"github.com/filmil/go-vcd-parser/ghw"
 	"github.com/filmil/go-vcd-parser/vcd"
 	"github.com/golang/glog"
 )
 
-func run(r io.Reader, filename string) (*vcd.File, error) {
-
-	parser := vcd.NewParser[vcd.File]()
-	ast, err := parser.Parse(filename, r)
-	if err != nil {
-		return nil, fmt.Errorf("parse error: %w", err)
+// describe returns err, with the offending source line if it is a parse error.
+func describe(err error) string {
+	var perr *vcd.ParseError
+	if errors.As(err, &perr) {
+		return perr.Detail()
 	}
+	return err.Error()
+}
+
+// stringsFlag is a flag that may be given more than once.
+type stringsFlag []string
+
+func (self *stringsFlag) String() string {
+	return strings.Join(*self, ",")
+}
 
-	return ast, nil
+func (self *stringsFlag) Set(v string) error {
+	*self = append(*self, v)
+	return nil
+}
+
+// filter returns the filter that the flags ask for, or nil if they ask for
+// none.
+func filter(globs, regexps, scopes []string, from, to uint64) (*vcd.Filter, error) {
+	ret := &vcd.Filter{Globs: globs, Scopes: scopes}
+	for _, r := range regexps {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("bad --regexp: %w", err)
+		}
+		ret.Regexps = append(ret.Regexps, re)
+	}
+	if from > to {
+		return nil, fmt.Errorf("--from=%v is after --to=%v", from, to)
+	}
+	if from != 0 || to != math.MaxUint64 {
+		ret.Window = &vcd.Window{From: from, To: to}
+	}
+	if len(globs)+len(regexps)+len(scopes) == 0 && ret.Window == nil {
+		return nil, nil
+	}
+	return ret, nil
 }
 
 func main() {
 	var inFile, outFile, outFmt, signalFile string
-	flag.StringVar(&inFile, "in", "", "Input filename, VCD file (required)")
+	var lenient bool
+	var workers int
+	var globs, regexps, scopes stringsFlag
+	var from, to uint64
+	flag.StringVar(&inFile, "in", "", "Input filename, VCD or GHW file, possibly compressed, FST file, or - for stdin (required)")
 	flag.StringVar(&outFile, "out", "", "Output filename, parsed vcd.File (required)")
-	flag.StringVar(&outFmt, "format", "", "Output format to use: json, sqlite")
+	flag.StringVar(&outFmt, "format", "", "Output format to use: json, sqlite, fst")
 	flag.StringVar(&signalFile, "signals", "", "Signals CSV file to write (optional)")
 	flag.IntVar(&cvt.MaxTx, "max-tx", 1000000, "Number of ops in a transaction")
+	flag.BoolVar(&lenient, "lenient", false, "Skip malformed commands instead of failing")
+	flag.Var(&globs, "glob", "Convert only the signals with paths that match this glob, such as /top/*/clk; repeatable")
+	flag.Var(&regexps, "regexp", "Convert only the signals with paths that match this regular expression; repeatable")
+	flag.Var(&scopes, "scope", "Convert only the signals in this scope and its subscopes, such as /top/cpu; repeatable")
+	flag.Uint64Var(&from, "from", 0, "Convert only the value changes from this time on")
+	flag.Uint64Var(&to, "to", math.MaxUint64, "Convert only the value changes up to this time")
+	flag.IntVar(&workers, "workers", 1, "Number of goroutines that parse the value changes, 0 for one per CPU")
 	flag.Parse()
 
 	pwd, _ := os.Getwd()
@@ -49,32 +99,60 @@ func main() {
 		glog.Errorf("flag --out=... is required")
 		os.Exit(1)
 	}
-	if (outFmt != "json") && (outFmt != "sqlite") {
-		glog.Errorf("flag --format=json|sqlite is required")
+	if (outFmt != "json") && (outFmt != "sqlite") && (outFmt != "fst") {
+		glog.Errorf("flag --format=json|sqlite|fst is required")
 		os.Exit(1)
 	}
 
-	file, err := os.Open(inFile)
-	if err != nil {
-		glog.Errorf("error opening: %v: %v", inFile, err)
-		os.Exit(1)
+	filename := inFile
+	if inFile == vcd.Stdin {
+		filename = "<stdin>"
 	}
-
-	b := bufio.NewReaderSize(file, 1000000)
-
-	start := time.Now()
-	glog.Infof("parsing input from: %v", inFile)
-	ast, err := run(b, inFile)
+	opts := []vcd.ReaderOption{vcd.WithFilename(filename), vcd.WithWorkers(workers)}
+	if lenient {
+		opts = append(opts, vcd.WithLenient())
+	}
+	f, err := filter(globs, regexps, scopes, from, to)
 	if err != nil {
-		glog.Errorf("error: %v: %v", inFile, err)
+		glog.Errorf("%v", err)
 		os.Exit(1)
 	}
+	if f != nil {
+		opts = append(opts, vcd.WithFilter(f))
+	}
+	var r *vcd.Reader
+	if inFile != vcd.Stdin && fst.IsFile(inFile) {
+		if r, err = fst.Open(inFile, opts...); err != nil {
+			glog.Errorf("error opening: %v: %v", inFile, err)
+			os.Exit(1)
+		}
+	} else {
+		file, err := vcd.Open(inFile)
+		if err != nil {
+			glog.Errorf("error opening: %v: %v", inFile, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		b := bufio.NewReaderSize(file, 1000000)
+		if ghw.Is(b) {
+			r = ghw.NewReader(b, opts...)
+		} else {
+			r = vcd.NewReader(b, opts...)
+		}
+	}
+	defer r.Close()
 
-	endLoad := time.Now()
-	glog.Infof("parsing took: %v", endLoad.Sub(start))
+	glog.Infof("parsing input from: %v", inFile)
 	glog.Infof("writing output to: %v", outFile)
-	startWrite := time.Now()
+	start := time.Now()
 	if outFmt == "json" {
+		// JSON output is a single document, so the whole file is needed.
+		ast, err := r.ReadAll()
+		if err != nil {
+			glog.Errorf("parse error: %v", describe(err))
+			os.Exit(1)
+		}
+		glog.Infof("parsing took: %v", time.Since(start))
 		of, err := os.Create(outFile)
 		if err != nil {
 			glog.Errorf("error: %v: %v", outFile, err)
@@ -92,6 +170,23 @@ func main() {
 		}
 	}
 
+	if outFmt == "fst" {
+		w, err := fst.Create(outFile)
+		if err != nil {
+			glog.Errorf("error: %v: %v", outFile, err)
+			os.Exit(1)
+		}
+		if err := w.WriteReader(r); err != nil {
+			w.Close()
+			glog.Errorf("could not convert: %v", describe(err))
+			os.Exit(1)
+		}
+		if err := w.Close(); err != nil {
+			glog.Errorf("could not write: %v: %v", outFile, err)
+			os.Exit(1)
+		}
+	}
+
 	if outFmt == "sqlite" {
 		_, err := os.Stat(outFile)
 		if err == nil || os.IsExist(err) {
@@ -104,15 +199,23 @@ func main() {
 			glog.Errorf("could not stat: %v: %v", outFile, err)
 			os.Exit(1)
 		}
-		ctx := context.Background()
+		// Interrupting stops the conversion cleanly.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
 		dbx, err := db.OpenDB(ctx, outFile)
 		if err != nil {
 			glog.Errorf("could not open database: %v: %v", outFile, err)
 			os.Exit(1)
 		}
 		defer dbx.Close()
-		if err := cvt.Convert(ctx, ast, dbx); err != nil {
-			glog.Errorf("could not convert: %v", err)
+		var hash string
+		if inFile != vcd.Stdin {
+			if hash, err = cvt.FileHash(inFile); err != nil {
+				glog.Warningf("did not hash the input: %v", err)
+			}
+		}
+		if err := cvt.ConvertReader(ctx, r, dbx, cvt.WithSource(filename, hash)); err != nil {
+			glog.Errorf("could not convert: %v", describe(err))
 			os.Exit(1)
 		}
 
@@ -149,7 +252,12 @@ func main() {
 			}
 		}
 	}
-	endWrite := time.Now()
-	glog.Infof("Done. Writing took: %v", endWrite.Sub(startWrite))
+	for _, d := range r.Diagnostics() {
+		glog.Warningf("skipped: %v", d.Detail())
+	}
+	if n := r.DiagnosticCount(); n > 0 {
+		glog.Warningf("skipped %v malformed commands", n)
+	}
+	glog.Infof("Done. Conversion took: %v", time.Since(start))
 
 }
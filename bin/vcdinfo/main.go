@@ -0,0 +1,120 @@
+// vcdinfo prints a summary of the header of a VCD file, without reading the
+// value changes.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/filmil/go-vcd-parser/fst"
+	"github.com/filmil/go-vcd-parser/ghw"
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/golang/glog"
+)
+
+// describe returns err, with the offending source line if it is a parse error.
+func describe(err error) string {
+	var perr *vcd.ParseError
+	if errors.As(err, &perr) {
+		return perr.Detail()
+	}
+	return err.Error()
+}
+
+func main() {
+	var inFile, glob string
+	var vars, lenient bool
+	flag.StringVar(&inFile, "in", "", "Input filename, VCD or GHW file, possibly compressed, FST file, or - for stdin (required)")
+	flag.BoolVar(&vars, "vars", false, "List the variables")
+	flag.StringVar(&glob, "glob", "", "List only the variables with paths that match this glob, such as /top/*")
+	flag.BoolVar(&lenient, "lenient", false, "Skip malformed declarations instead of failing")
+	flag.Parse()
+
+	if inFile == "" {
+		glog.Errorf("flag --in=... is required")
+		os.Exit(1)
+	}
+	filename := inFile
+	if inFile == vcd.Stdin {
+		filename = "<stdin>"
+	}
+	opts := []vcd.ReaderOption{vcd.WithFilename(filename)}
+	if lenient {
+		opts = append(opts, vcd.WithLenient())
+	}
+	var (
+		h   *vcd.Header
+		err error
+	)
+	if inFile != vcd.Stdin && fst.IsFile(inFile) {
+		r, oerr := fst.Open(inFile, opts...)
+		if oerr != nil {
+			glog.Errorf("error opening: %v: %v", inFile, oerr)
+			os.Exit(1)
+		}
+		defer r.Close()
+		h, err = r.Header()
+	} else {
+		file, oerr := vcd.Open(inFile)
+		if oerr != nil {
+			glog.Errorf("error opening: %v: %v", inFile, oerr)
+			os.Exit(1)
+		}
+		defer file.Close()
+		b := bufio.NewReader(file)
+		if ghw.Is(b) {
+			h, err = ghw.NewReader(b, opts...).Header()
+		} else {
+			h, err = vcd.ParseHeader(b, opts...)
+		}
+	}
+	if err != nil {
+		glog.Errorf("parse error: %v", describe(err))
+		os.Exit(1)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	fmt.Fprintf(w, "file:      %v\n", filename)
+	if h.Date != "" {
+		fmt.Fprintf(w, "date:      %v\n", h.Date)
+	}
+	if h.Version != "" {
+		fmt.Fprintf(w, "version:   %v\n", h.Version)
+	}
+	for _, c := range h.Comments {
+		fmt.Fprintf(w, "comment:   %v\n", c)
+	}
+	if h.Timescale != nil {
+		fmt.Fprintf(w, "timescale: %v\n", h.Timescale)
+	}
+	var scopes int
+	h.Hierarchy.Walk(func(*vcd.Scope) error {
+		scopes++
+		return nil
+	})
+	codes := map[string]bool{}
+	for _, v := range h.Hierarchy.Vars() {
+		codes[v.Code] = true
+	}
+	// Not counting the root scope.
+	fmt.Fprintf(w, "scopes:    %v\n", scopes-1)
+	fmt.Fprintf(w, "variables: %v (%v signals)\n", len(h.Hierarchy.Vars()), len(codes))
+
+	if !vars && glob == "" {
+		return
+	}
+	list := h.Hierarchy.Vars()
+	if glob != "" {
+		if list, err = h.Hierarchy.Glob(glob); err != nil {
+			glog.Errorf("bad --glob: %v", err)
+			os.Exit(1)
+		}
+	}
+	for _, v := range list {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", v.Path, v.VarType, v.Size, v.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package cvt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/filmil/go-vcd-parser/db"
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/golang/glog"
+)
+
+// PipelineDepth is the number of batches of value changes that may wait for
+// the database during a conversion. When the database falls behind, reading
+// the VCD file waits for it.
+var PipelineDepth = 4
+
+// cmdChunk is the number of simulation commands that are read before they
+// are handed to batching, and cmdBuffer the number of such chunks that may
+// wait for it. Handing the commands over one by one is slow.
+const (
+	cmdChunk  = 256
+	cmdBuffer = 16
+)
+
+// change is a value change at a time.
+type change struct {
+	ts uint64
+	vc *vcd.ValueChangeT
+}
+
+// timeRange is the range of the simulation times of a conversion. ok is
+// false if there were none.
+type timeRange struct {
+	first, last uint64
+	ok          bool
+}
+
+// add extends the range to ts.
+func (self *timeRange) add(ts uint64) {
+	if !self.ok {
+		self.first, self.ok = ts, true
+	}
+	self.last = ts
+}
+
+// insertValues inserts the value changes of the simulation commands from
+// next, in three stages that run concurrently: reading the commands,
+// batching their value changes by MaxTx, and writing each batch in a
+// transaction of its own on conn. The stages are connected by bounded
+// channels. The first error of any stage, or the cancellation of ctx, stops
+// all of them, and is returned. As reading is not interruptible, this waits
+// for the command being read. Returns the range of the simulation times.
+func insertValues(ctx context.Context, conn *sql.Conn, next nextFn) (timeRange, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	cmds := make(chan []*vcd.SimulationCommandT, cmdBuffer)
+	batches := make(chan []change, PipelineDepth)
+	// The batches that were written go back for reuse.
+	free := make(chan []change, PipelineDepth+2)
+
+	var (
+		wg    sync.WaitGroup
+		times timeRange
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(cmds)
+		if err := readCommands(ctx, next, cmds); err != nil {
+			cancel(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(batches)
+		if err := batchChanges(ctx, cmds, batches, free, &times); err != nil {
+			cancel(err)
+		}
+	}()
+	if err := writeBatches(ctx, conn, batches, free); err != nil {
+		cancel(err)
+	}
+	wg.Wait()
+	// The cause is nil only if no stage failed, and ctx was not canceled.
+	return times, context.Cause(ctx)
+}
+
+// readCommands sends the commands from next to cmds, up to the end of the
+// input.
+func readCommands(ctx context.Context, next nextFn, cmds chan<- []*vcd.SimulationCommandT) error {
+	chunk := make([]*vcd.SimulationCommandT, 0, cmdChunk)
+	send := func() bool {
+		select {
+		case cmds <- chunk:
+			chunk = make([]*vcd.SimulationCommandT, 0, cmdChunk)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for ctx.Err() == nil {
+		e, err := next()
+		if err == io.EOF {
+			if len(chunk) > 0 {
+				send()
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if chunk = append(chunk, e); len(chunk) == cmdChunk && !send() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// batchChanges sends the value changes of the commands from cmds to batches,
+// MaxTx at a time. The batches are taken from free, if there are any. The
+// simulation times are added to times.
+func batchChanges(ctx context.Context, cmds <-chan []*vcd.SimulationCommandT,
+	batches chan<- []change, free <-chan []change, times *timeRange) error {
+	var (
+		timestamp uint64
+		batch     []change
+	)
+	send := func() bool {
+		select {
+		case batches <- batch:
+			select {
+			case batch = <-free:
+			default:
+				batch = make([]change, 0, MaxTx)
+			}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for chunk := range cmds {
+		for _, e := range chunk {
+			switch {
+			case e.SimulationTime != nil:
+				ts, err := e.SimulationTime.Value()
+				if err != nil {
+					return err
+				}
+				timestamp = ts
+				times.add(ts)
+				if glog.V(3) {
+					glog.Infof("cvt.Convert: add timestamp: %v", ts)
+				}
+			case e.Vcdclose != nil:
+				glog.V(2).Infof("cvt.Convert: vcdclose at: %+v", e.Vcdclose.SimulationTime)
+			}
+			for _, vc := range e.ValueChanges() {
+				batch = append(batch, change{ts: timestamp, vc: vc})
+				if len(batch) >= MaxTx && !send() {
+					return nil
+				}
+			}
+		}
+	}
+	if len(batch) > 0 && ctx.Err() == nil {
+		send()
+	}
+	return nil
+}
+
+// writeBatches writes each batch from batches in a transaction of its own,
+// and then hands it to free.
+func writeBatches(ctx context.Context, conn *sql.Conn, batches <-chan []change, free chan<- []change) error {
+	for {
+		var batch []change
+		select {
+		case b, ok := <-batches:
+			if !ok {
+				return nil
+			}
+			batch = b
+		case <-ctx.Done():
+			return nil
+		}
+		if err := writeBatch(ctx, conn, batch); err != nil {
+			return err
+		}
+		clear(batch)
+		select {
+		case free <- batch[:0]:
+		default:
+		}
+	}
+}
+
+func writeBatch(ctx context.Context, conn *sql.Conn, batch []change) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not create a value change tx: %w", err)
+	}
+	defer tx.Rollback()
+	w, err := db.NewValueWriter(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, c := range batch {
+		if err := writeValueChange(ctx, w, c.ts, c.vc); err != nil {
+			return fmt.Errorf("could not add value change: %w", err)
+		}
+	}
+	if err := w.Flush(ctx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not add value change: %w", err)
+	}
+	return nil
+}
@@ -3,8 +3,13 @@ package cvt
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/davecgh/go-spew/spew"
@@ -23,15 +28,97 @@ func InsertSignal(ctx context.Context, tx *sql.Tx,
 	return nil
 }
 
+// InsertVar adds the variable v of the hierarchy as a signal, with its
+// metadata. scope is the Id of its scope, 0 for none.
+func InsertVar(ctx context.Context, tx *sql.Tx, v *vcd.Var, scope int64) error {
+	msb, lsb := bitRange(v.VarT)
+	info := db.SignalInfo{
+		ScopeId:   scope,
+		LocalName: v.Id.Name,
+		Raw:       v.Id.RawString(),
+		Msb:       msb,
+		Lsb:       lsb,
+		Attrs:     attrs(v.Attrs),
+	}
+	// The names in the database have an extra `/` in front of the paths.
+	if err := db.AddSignalInfo(ctx, tx, "/"+v.Path, v.GetVarKind(), v.Code, v.Size, info); err != nil {
+		return fmt.Errorf("cvt.InsertVar: error in tx: %w", err)
+	}
+	return nil
+}
+
+// bitRange returns the declared bit range of v: the range of a port, or else
+// the last index of its reference. Returns nils if there is none.
+func bitRange(v *vcd.VarT) (*int, *int) {
+	idx := v.Range
+	if n := len(v.Id.Indices); idx == nil && n > 0 {
+		idx = v.Id.Indices[n-1]
+	}
+	switch {
+	case idx == nil:
+		return nil, nil
+	case idx.Index != nil:
+		return idx.Index, idx.Index
+	}
+	return idx.MsbIndex, idx.LsbIndex
+}
+
+// attrs returns the attributes as the database has them, one per line.
+func attrs(as []*vcd.AttrT) string {
+	var ret []string
+	for _, a := range as {
+		ret = append(ret, a.String())
+	}
+	return strings.Join(ret, "\n")
+}
+
+// InsertScope adds a scope, and returns its Id. parent is the Id of the
+// parent scope, 0 for top level scopes.
+func InsertScope(ctx context.Context, tx *sql.Tx,
+	name, localName string, kind vcd.ScopeKindCode, parent int64) (int64, error) {
+	id, err := db.AddScope(ctx, tx, name, localName, kind, parent)
+	if err != nil {
+		return 0, fmt.Errorf("cvt.InsertScope: error in tx: %w", err)
+	}
+	return id, nil
+}
+
+// InsertEnumTable records the names of the values of the enum signal with
+// the given code.
+func InsertEnumTable(ctx context.Context, tx *sql.Tx, code string, t *vcd.EnumTableT) error {
+	for i, name := range t.Names {
+		if err := db.AddEnumValue(ctx, tx, code, t.Values[i].String(), name); err != nil {
+			return fmt.Errorf("cvt.InsertEnumTable: error in tx: %w", err)
+		}
+	}
+	return nil
+}
+
 func InsertValueChange(ctx context.Context, tx *sql.Tx, ts uint64, vc *vcd.ValueChangeT) error {
-	glog.V(4).Infof("cvt.InsertValueChange: %v, %v, %v",
-		vc.GetIdCode(), vc.GetValue(), spew.Sdump(*vc))
+	if glog.V(4) {
+		glog.Infof("cvt.InsertValueChange: %v, %v, %v",
+			vc.GetIdCode(), vc.GetValue(), spew.Sdump(*vc))
+	}
+	if p := vc.PortValueChange; p != nil {
+		if err := db.AddPortValue(ctx, tx, ts, p.IdCode, p.GetValue(), p.Strength0, p.Strength1); err != nil {
+			return fmt.Errorf("cvt.InsertValueChange: could not add port value: %w", err)
+		}
+		return nil
+	}
 	if err := db.AddValue(ctx, tx, ts, vc.GetIdCode(), vc.GetValue()); err != nil {
 		return fmt.Errorf("cvt.InsertValueChange: could not add value: %w", err)
 	}
 	return nil
 }
 
+// writeValueChange adds a value change with w.
+func writeValueChange(ctx context.Context, w *db.ValueWriter, ts uint64, vc *vcd.ValueChangeT) error {
+	if p := vc.PortValueChange; p != nil {
+		return w.AddPort(ctx, ts, p.IdCode, p.GetValue(), p.Strength0, p.Strength1)
+	}
+	return w.Add(ctx, ts, vc.GetIdCode(), vc.GetValue())
+}
+
 // MaxTx is the maximum number of operations in a transaction.
 var MaxTx int = 100000
 
@@ -62,111 +149,255 @@ func InsertValueChanges(ctx context.Context, txf TxFactory, timestamp uint64, vc
 	return nil
 }
 
-// Convert translates a parsed VCD file into an empty database.
-func Convert(ctx context.Context, vcdFile *vcd.File, dbf *sql.DB) error {
-	scope := []string{"/"}
+// nextFn returns the next simulation command, or io.EOF if there are none.
+type nextFn func() (*vcd.SimulationCommandT, error)
 
-	var txf TxFactory = func() (*sql.Tx, error) {
-		return dbf.Begin()
+// Option configures a conversion.
+type Option func(*options)
+
+type options struct {
+	filter     *vcd.Filter
+	readerOpts []vcd.ReaderOption
+
+	// The source file, for Metadata.
+	filename, hash string
+}
+
+// WithFilter converts only the signals and the time window that f selects.
+// See vcd.WithFilter.
+func WithFilter(f *vcd.Filter) Option {
+	return func(o *options) {
+		o.filter = f
 	}
+}
 
-	var count int
-	tx, err := txf()
+// WithReaderOptions gives options to the reader that ConvertStream makes,
+// such as vcd.WithFilename or vcd.WithWorkers.
+func WithReaderOptions(opts ...vcd.ReaderOption) Option {
+	return func(o *options) {
+		o.readerOpts = append(o.readerOpts, opts...)
+	}
+}
+
+// WithSource records the name of the VCD file, and the SHA-256 of its
+// contents in hex as FileHash returns it, in the Metadata table. Either may
+// be empty. ConvertReader and ConvertStream take the name from the reader if
+// none is given.
+func WithSource(filename, hash string) Option {
+	return func(o *options) {
+		o.filename, o.hash = filename, hash
+	}
+}
+
+// FileHash returns the SHA-256 of the contents of the named file, in hex.
+func FileHash(name string) (string, error) {
+	f, err := os.Open(name)
 	if err != nil {
-		return fmt.Errorf("cvt.Convert: could not create a value change tx")
+		return "", fmt.Errorf("cvt.FileHash: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("cvt.FileHash: %v: %w", name, err)
 	}
-	for _, e := range vcdFile.DeclarationCommand {
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Convert translates a parsed VCD file into an empty database. The entire
+// file must be in memory for this; see ConvertStream for large files. A
+// parsed file does not keep the whitespace between the words of `$date`,
+// `$version` and `$comment`, so their texts are recorded without it, such as
+// `MonJan1` for `Mon Jan 1`; ConvertReader keeps single spaces.
+func Convert(ctx context.Context, vcdFile *vcd.File, dbf *sql.DB, opts ...Option) error {
+	cmds := vcdFile.SimulationCommand
+	next := func() (*vcd.SimulationCommandT, error) {
+		if len(cmds) == 0 {
+			return nil, io.EOF
+		}
+		ret := cmds[0]
+		cmds = cmds[1:]
+		return ret, nil
+	}
+	meta := &db.Metadata{}
+	for _, d := range vcdFile.DeclarationCommand {
 		switch {
-		case e.EndDefinitions != nil:
-			glog.V(2).Infof("cvt.Convert: enddefinitions found")
+		case d.Date != nil:
+			meta.Date = declText("$date", *d.Date)
+		case d.Version != nil:
+			meta.Version = declText("$version", *d.Version)
+		case d.CommentText != nil:
+			meta.Comments = append(meta.Comments, declText("$comment", *d.CommentText))
+		}
+	}
+	return convert(ctx, vcdFile.DeclarationCommand, next, dbf, meta, opts)
+}
+
+// declText returns the text of a parsed declaration, such as `$dateMonJan1$end`,
+// without the keyword kw and the `$end`.
+func declText(kw, text string) string {
+	body, _, _ := strings.Cut(strings.TrimPrefix(text, kw), "$end")
+	return body
+}
+
+// ConvertReader translates a VCD file read from r into an empty database.
+// Unlike Convert, it does not need the entire VCD file in memory. A filter
+// may be given here, or to r with vcd.WithFilter, which reads the same.
+func ConvertReader(ctx context.Context, r *vcd.Reader, dbf *sql.DB, opts ...Option) error {
+	h, err := r.Header()
+	if err != nil {
+		return fmt.Errorf("cvt.ConvertReader: %w", err)
+	}
+	meta := &db.Metadata{
+		Date:     h.Date,
+		Version:  h.Version,
+		Comments: h.Comments,
+		Filename: r.Filename(),
+	}
+	return convert(ctx, h.Declarations, r.Next, dbf, meta, opts)
+}
+
+// ConvertStream translates the VCD file read from r into an empty database,
+// as it reads it. Only the declarations and a simulation command at a time
+// are kept in memory, so that files of any length convert in bounded memory.
+// The value changes are written in transactions of MaxTx each, as Convert
+// does.
+func ConvertStream(ctx context.Context, r io.Reader, dbf *sql.DB, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	vr := vcd.NewReader(r, o.readerOpts...)
+	defer vr.Close()
+	if err := ConvertReader(ctx, vr, dbf, opts...); err != nil {
+		return fmt.Errorf("cvt.ConvertStream: %w", err)
+	}
+	return nil
+}
+
+// convert translates the declarations, and the simulation commands from next,
+// into dbf. The rest of meta is filled in from them and from opts.
+func convert(ctx context.Context, decls []*vcd.DeclarationCommandT, next nextFn, dbf *sql.DB, meta *db.Metadata, opts []Option) (err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.filename != "" {
+		meta.Filename = o.filename
+	}
+	meta.Hash = o.hash
+	for _, d := range decls {
+		if d.Timescale != nil {
+			meta.Timescale = d.Timescale
 			break
-		case e.Scope != nil:
-			scope = append(scope, e.Scope.Id)
-		case e.Upscope != nil:
-			if len(scope) < 2 {
-				continue
-			}
-			scope = scope[0 : len(scope)-1]
-		case e.Var != nil:
-			count++
-			v := e.Var
-			name := strings.Join(append(scope, v.Id.String()), "/")
-			if err := InsertSignal(ctx, tx, name, v.GetVarKind(), v.Code, v.Size); err != nil {
-				return fmt.Errorf("cvt.Convert: %w", err)
-			}
-			if count != 0 && count%MaxTx == 0 {
-				if err := tx.Commit(); err != nil {
-					return fmt.Errorf("cvt.Convert: could not add value change: %w", err)
-				}
-				tx, err = txf()
-				if err != nil {
-					return fmt.Errorf("cvt.Convert: could not create a value change tx")
-				}
-			}
 		}
 	}
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("cvt.Convert: could not add value change: %w", err)
+	vcd.LinkAttributes(decls)
+	if o.filter != nil {
+		if decls, next, err = o.filter.Apply(decls, next); err != nil {
+			return fmt.Errorf("cvt.Convert: %w", err)
+		}
 	}
+	h := vcd.NewHierarchy(decls)
 
-	var timestamp uint64
-	count = 0
-	tx, err = txf()
+	// The settings for loading in bulk are for one connection, so all the
+	// transactions use the same one.
+	conn, err := dbf.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("cvt.Convert: could not get a connection: %w", err)
+	}
+	defer conn.Close()
+	restore, err := db.BulkLoad(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("cvt.Convert: %w", err)
+	}
+	// Once, whether the conversion succeeded or not, so that the database
+	// gets its indexes back. ctx may be done by then.
+	defer func() {
+		if rerr := restore(context.WithoutCancel(ctx)); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("cvt.Convert: %w", rerr))
+		}
+	}()
+
+	var txf TxFactory = func() (*sql.Tx, error) {
+		return conn.BeginTx(ctx, nil)
+	}
+
+	var count int
+	tx, err := txf()
 	if err != nil {
 		return fmt.Errorf("cvt.Convert: could not create a value change tx")
 	}
-	for _, e := range vcdFile.SimulationCommand {
-		switch {
-		case e.SimulationTime != nil:
-			s := e.SimulationTime
-			timestamp = s.Value()
-			glog.V(3).Infof("cvt.Convert: add timestamp: %v", timestamp)
-		case e.Dumpvars != nil:
-			d := e.Dumpvars
-			err := InsertValueChanges(ctx, txf, timestamp, d.ValueChange)
-			if err != nil {
-				return fmt.Errorf("cvt.Convert: dumpvars %w", err)
-			}
-		case e.Dumpall != nil:
-			d := e.Dumpall
-			err := InsertValueChanges(ctx, txf, timestamp, d.ValueChange)
-			if err != nil {
-				return fmt.Errorf("cvt.Convert: dumpall %w", err)
-			}
-		case e.Dumpon != nil:
-			d := e.Dumpon
-			err := InsertValueChanges(ctx, txf, timestamp, d.ValueChange)
-			if err != nil {
-				return fmt.Errorf("cvt.Convert: dumpon %w", err)
-			}
-		case e.Dumpoff != nil:
-			d := e.Dumpoff
-			err := InsertValueChanges(ctx, txf, timestamp, d.ValueChange)
+	// If the conversion fails, the transaction in progress is rolled back,
+	// so that it does not keep the database locked. After a commit, this
+	// does nothing.
+	defer func() {
+		tx.Rollback()
+	}()
+	// The Ids of the scopes in the database, whose names have an extra `/`
+	// in front of the paths, as those of signals. The root scope has none.
+	ids := map[*vcd.Scope]int64{}
+	err = h.Walk(func(s *vcd.Scope) error {
+		if s.Parent != nil {
+			id, err := InsertScope(ctx, tx, "/"+s.Path, s.Name, s.Kind, ids[s.Parent])
 			if err != nil {
-				return fmt.Errorf("cvt.Convert: dumpoff %w", err)
+				return err
 			}
-		case e.ValueChange != nil:
+			ids[s] = id
+		}
+		for _, v := range s.Vars {
 			count++
-			v := e.ValueChange
-			err := InsertValueChange(ctx, tx, timestamp, v)
-			if err != nil {
-				return fmt.Errorf("cvt.Convert: could not add value change: %w", err)
+			if err := InsertVar(ctx, tx, v, ids[s]); err != nil {
+				return err
+			}
+			if v.EnumTable != nil {
+				if err := InsertEnumTable(ctx, tx, v.Code, v.EnumTable); err != nil {
+					return err
+				}
 			}
-			if count != 0 && count%MaxTx == 0 {
+			if count%MaxTx == 0 {
 				if err := tx.Commit(); err != nil {
-					return fmt.Errorf("cvt.Convert: could not add value change: %w", err)
+					return fmt.Errorf("could not add signal: %w", err)
 				}
+				var err error
 				tx, err = txf()
 				if err != nil {
-					return fmt.Errorf("cvt.Convert: could not create a value change tx")
+					return fmt.Errorf("could not create a signal tx")
 				}
 			}
-		default:
-			glog.V(3).Infof("unprocessed: %+v", e)
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cvt.Convert: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cvt.Convert: could not add signal: %w", err)
+	}
+	times, err := insertValues(ctx, conn, next)
+	if err != nil {
+		return fmt.Errorf("cvt.Convert: %w", err)
+	}
+	if times.ok {
+		meta.FirstTimestamp, meta.LastTimestamp = &times.first, &times.last
+	}
+	if err := insertMetadata(ctx, conn, meta); err != nil {
+		return fmt.Errorf("cvt.Convert: %w", err)
+	}
+	return nil
+}
+
+// insertMetadata records meta in a transaction of its own.
+func insertMetadata(ctx context.Context, conn *sql.Conn, meta *db.Metadata) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not create a metadata tx: %w", err)
+	}
+	defer tx.Rollback()
+	if err := db.SetMetadata(ctx, tx, meta); err != nil {
+		return err
 	}
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("cvt.Convert: could not add value change: %w", err)
+		return fmt.Errorf("could not add metadata: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,648 @@
+package cvt
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/db"
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+const testVCD = `
+$timescale 1 ns $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 4 " data[3:0] $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+0!
+b0 "
+$end
+#10
+1!
+b1010 "
+#20
+0!
+$dumpall 0! b1010 " $end
+`
+
+func openTestDB(t *testing.T, ctx context.Context) *sql.DB {
+	t.Helper()
+	dbx, err := db.OpenDB(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	t.Cleanup(func() { dbx.Close() })
+	return dbx
+}
+
+func values(t *testing.T, dbx *sql.DB) []string {
+	t.Helper()
+	rows, err := dbx.Query(`
+        SELECT      Signals.Name, Svalues.Timestamp, Svalues.Value
+        FROM        Svalues INNER JOIN Signals
+        ON          Svalues.Code = Signals.Code
+        ORDER BY    Svalues.Id;`)
+	if err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	defer rows.Close()
+	var ret []string
+	for rows.Next() {
+		var (
+			name, value string
+			ts          uint64
+		)
+		if err := rows.Scan(&name, &ts, &value); err != nil {
+			t.Fatalf("could not scan: %v", err)
+		}
+		ret = append(ret, fmt.Sprintf("%v@%v=%v", name, ts, value))
+	}
+	return ret
+}
+
+var expectedValues = []string{
+	"//top/clk@0=0", "//top/data[3:0]@0=0",
+	"//top/clk@10=1", "//top/data[3:0]@10=1010",
+	"//top/clk@20=0",
+	"//top/clk@20=0", "//top/data[3:0]@20=1010",
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	f, err := vcd.NewParser[vcd.File]().ParseString("test.vcd", testVCD)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	dbx := openTestDB(t, ctx)
+	if err := Convert(ctx, f, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	if v := values(t, dbx); !reflect.DeepEqual(v, expectedValues) {
+		t.Errorf("\nwant: %v\ngot:  %v", expectedValues, v)
+	}
+}
+
+func TestConvertReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r := vcd.NewReader(strings.NewReader(testVCD), vcd.WithFilename("test.vcd"))
+	dbx := openTestDB(t, ctx)
+	if err := ConvertReader(ctx, r, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	if v := values(t, dbx); !reflect.DeepEqual(v, expectedValues) {
+		t.Errorf("\nwant: %v\ngot:  %v", expectedValues, v)
+	}
+}
+
+func TestConvertStream(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx := openTestDB(t, ctx)
+	if err := ConvertStream(ctx, strings.NewReader(testVCD), dbx, WithReaderOptions(vcd.WithFilename("test.vcd"))); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	if v := values(t, dbx); !reflect.DeepEqual(v, expectedValues) {
+		t.Errorf("\nwant: %v\ngot:  %v", expectedValues, v)
+	}
+}
+
+func TestConvertMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const input = `$date
+    Mon Jan  1 00:00:00 2024
+$end
+$version nvc 1.11 $end
+$comment first $end
+$comment second   one $end
+$timescale 10 ps $end
+$scope module top $end
+$var wire 1 ! clk $end
+$upscope $end
+$enddefinitions $end
+#5
+0!
+#10
+1!
+#30
+`
+	name := filepath.Join(t.TempDir(), "test.vcd")
+	if err := os.WriteFile(name, []byte(input), 0o644); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	hash, err := FileHash(name)
+	if err != nil {
+		t.Fatalf("could not hash: %v", err)
+	}
+	sum := sha256.Sum256([]byte(input))
+	if want := hex.EncodeToString(sum[:]); hash != want {
+		t.Errorf("FileHash: want: %v, got: %v", want, hash)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		filename string
+		hash     string
+	}{
+		{"reader", []Option{WithReaderOptions(vcd.WithFilename("in.vcd"))}, "in.vcd", ""},
+		{"source", []Option{WithReaderOptions(vcd.WithFilename("in.vcd")), WithSource(name, hash)}, name, hash},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			dbx := openTestDB(t, ctx)
+			if err := ConvertStream(ctx, strings.NewReader(input), dbx, test.opts...); err != nil {
+				t.Fatalf("could not convert: %v", err)
+			}
+			m, err := db.GetMetadata(ctx, dbx)
+			if err != nil {
+				t.Fatalf("could not get metadata: %v", err)
+			}
+			actual := fmt.Sprintf("%v|%q|%q|%q|%v-%v|%v|%v",
+				m.Timescale, m.Date, m.Version, m.Comments,
+				*m.FirstTimestamp, *m.LastTimestamp, m.Filename, m.Hash)
+			expected := fmt.Sprintf(`10 ps|"Mon Jan 1 00:00:00 2024"|"nvc 1.11"|["first" "second one"]|5-30|%v|%v`,
+				test.filename, test.hash)
+			if actual != expected {
+				t.Errorf("\nwant:\n%v\ngot:\n%v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestConvertParsedMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const input = `$date
+    Mon Jan  1 00:00:00 2024
+$end
+$version nvc $end
+$comment first $end
+$comment second   one $end
+$timescale 10 ps $end
+$scope module top $end
+$var wire 1 ! clk $end
+$upscope $end
+$enddefinitions $end
+#5
+0!
+`
+	f, err := vcd.NewParser[vcd.File]().ParseString("test.vcd", input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	dbx := openTestDB(t, ctx)
+	if err := Convert(ctx, f, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	m, err := db.GetMetadata(ctx, dbx)
+	if err != nil {
+		t.Fatalf("could not get metadata: %v", err)
+	}
+	actual := fmt.Sprintf("%v|%q|%q|%q", m.Timescale, m.Date, m.Version, m.Comments)
+	const expected = `10 ps|"MonJan100:00:002024"|"nvc"|["first" "secondone"]`
+	if actual != expected {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", expected, actual)
+	}
+}
+
+// dumpReader makes a VCD file of n value changes as it is read, so that
+// it is never in memory as a whole.
+type dumpReader struct {
+	n, i int
+	buf  []byte
+}
+
+func (self *dumpReader) Read(p []byte) (int, error) {
+	for len(self.buf) == 0 {
+		switch {
+		case self.i == 0:
+			self.buf = []byte("$scope module top $end\n$var wire 1 ! clk $end\n$upscope $end\n$enddefinitions $end\n")
+		case self.i > self.n:
+			return 0, io.EOF
+		default:
+			self.buf = fmt.Appendf(nil, "#%d\n%d!\n", self.i, self.i%2)
+		}
+		self.i++
+	}
+	n := copy(p, self.buf)
+	self.buf = self.buf[n:]
+	return n, nil
+}
+
+func TestConvertStreamLarge(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx := openTestDB(t, ctx)
+	const n = 20000
+	if err := ConvertStream(ctx, &dumpReader{n: n}, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	var count, last int
+	if err := dbx.QueryRow(`SELECT COUNT(*), MAX(Timestamp) FROM Svalues;`).Scan(&count, &last); err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	if count != n || last != n {
+		t.Errorf("want: %v values until %v, got: %v until %v", n, n, count, last)
+	}
+}
+
+// TestConvertStreamError checks that a failed conversion does not leave the
+// database locked.
+func TestConvertStreamError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx := openTestDB(t, ctx)
+	if err := ConvertStream(ctx, strings.NewReader(testVCD+"\n#x\n"), dbx); err == nil {
+		t.Fatalf("want an error")
+	}
+	if _, err := dbx.ExecContext(ctx, `DELETE FROM Svalues;`); err != nil {
+		t.Errorf("the database is not usable: %v", err)
+	}
+}
+
+// cancelingReader cancels the conversion after n bytes are read.
+type cancelingReader struct {
+	r      io.Reader
+	n      int
+	cancel func()
+}
+
+func (self *cancelingReader) Read(p []byte) (int, error) {
+	if self.n <= 0 {
+		self.cancel()
+	}
+	n, err := self.r.Read(p[:min(len(p), 4096)])
+	self.n -= n
+	return n, err
+}
+
+func TestConvertStreamCancel(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dbx := openTestDB(t, ctx)
+	r := &cancelingReader{r: &dumpReader{n: 1000000}, n: 100000, cancel: cancel}
+	if err := ConvertStream(ctx, r, dbx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want: %v, got: %v", context.Canceled, err)
+	}
+	if _, err := dbx.Exec(`DELETE FROM Svalues;`); err != nil {
+		t.Errorf("the database is not usable: %v", err)
+	}
+	checkValueIndex(t, dbx)
+}
+
+// checkValueIndex checks that the index of the values is there, which
+// loading in bulk drops for a while.
+func checkValueIndex(t *testing.T, dbx *sql.DB) {
+	t.Helper()
+	var index string
+	if err := dbx.QueryRow(`
+        SELECT name FROM sqlite_master
+        WHERE type = 'index' AND name = 'SvaluesByCodeAndTimestamp';`).Scan(&index); err != nil {
+		t.Errorf("the index is not restored: %v", err)
+	}
+}
+
+// TestConvertStreamWriteError checks that the errors of writing come out.
+func TestConvertStreamWriteError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx := openTestDB(t, ctx)
+	if _, err := dbx.Exec(`
+        CREATE TRIGGER Full BEFORE INSERT ON Svalues WHEN NEW.Timestamp > 100
+        BEGIN
+            SELECT RAISE(ABORT, 'the disk is full');
+        END;`); err != nil {
+		t.Fatalf("could not create the trigger: %v", err)
+	}
+	err := ConvertStream(ctx, &dumpReader{n: 1000}, dbx)
+	if err == nil || !strings.Contains(err.Error(), "the disk is full") {
+		t.Errorf("want the error of the trigger, got: %v", err)
+	}
+	checkValueIndex(t, dbx)
+}
+
+func TestConvertFilter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	f, err := vcd.NewParser[vcd.File]().ParseString("test.vcd", testVCD)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	dbx := openTestDB(t, ctx)
+	filter := &vcd.Filter{Globs: []string{"/top/clk"}, Window: &vcd.Window{From: 15, To: 20}}
+	if err := Convert(ctx, f, dbx, WithFilter(filter)); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	// The value at the start of the window is carried over from 10.
+	expected := []string{"//top/clk@15=1", "//top/clk@20=0", "//top/clk@20=0"}
+	if v := values(t, dbx); !reflect.DeepEqual(v, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, v)
+	}
+	var count int
+	if err := dbx.QueryRow(`SELECT COUNT(*) FROM Signals;`).Scan(&count); err != nil || count != 1 {
+		t.Errorf("want 1 signal, got: %v, %v", count, err)
+	}
+	// The file itself is left as it was.
+	if last := f.SimulationCommand[len(f.SimulationCommand)-1]; len(last.Dumpall.ValueChange) != 2 {
+		t.Errorf("the file was changed: %+v", last.Dumpall)
+	}
+}
+
+const testEVCD = `
+$timescale 1 ns $end
+$scope module top $end
+$var port 1 <0 clk $end
+$var port [3:0] <1 data $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpports
+pD 6 0 <0
+pDDDD 6 0 <1
+$end
+#10
+pU 0 6 <0
+p0101 6 6 <1
+$vcdclose #20 $end
+`
+
+func TestConvertEVCD(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r := vcd.NewReader(strings.NewReader(testEVCD), vcd.WithFilename("test.vcd"))
+	dbx := openTestDB(t, ctx)
+	if err := ConvertReader(ctx, r, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	rows, err := dbx.Query(`
+        SELECT      Signals.Name, Signals.Size, Svalues.Timestamp, Svalues.Value,
+                    Svalues.Strength0, Svalues.Strength1
+        FROM        Svalues INNER JOIN Signals
+        ON          Svalues.Code = Signals.Code
+        ORDER BY    Svalues.Id;`)
+	if err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	defer rows.Close()
+	var actual []string
+	for rows.Next() {
+		var (
+			name, value, s0, s1 string
+			size                int
+			ts                  uint64
+		)
+		if err := rows.Scan(&name, &size, &ts, &value, &s0, &s1); err != nil {
+			t.Fatalf("could not scan: %v", err)
+		}
+		actual = append(actual, fmt.Sprintf("%v(%v)@%v=%v/%v/%v", name, size, ts, value, s0, s1))
+	}
+	expected := []string{
+		"//top/clk(1)@0=D/6/0", "//top/data(4)@0=DDDD/6/0",
+		"//top/clk(1)@10=U/0/6", "//top/data(4)@10=0101/6/6",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, actual)
+	}
+}
+
+func TestConvertScopes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const input = `
+$scope module top $end
+$scope interface bus_if $end
+$var wire 1 ! valid $end
+$upscope $end
+$scope vhdl_for_generate gen $end
+$scope vhdl_process p $end
+$upscope $end
+$upscope $end
+$upscope $end
+$scope module top $end
+$scope task t $end
+$upscope $end
+$scope interface bus_if $end
+$var wire 1 ! valid $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+`
+	r := vcd.NewReader(strings.NewReader(input), vcd.WithFilename("test.vcd"))
+	dbx := openTestDB(t, ctx)
+	if err := ConvertReader(ctx, r, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	rows, err := dbx.Query(`
+        SELECT      s.Name, s.Kind, IFNULL(p.Name, '')
+        FROM        Scopes AS s
+        LEFT JOIN   Scopes AS p
+        ON          s.Parent = p.Id
+        ORDER BY    s.Name;`)
+	if err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	defer rows.Close()
+	var actual []string
+	for rows.Next() {
+		var (
+			name, parent string
+			kind         vcd.ScopeKindCode
+		)
+		if err := rows.Scan(&name, &kind, &parent); err != nil {
+			t.Fatalf("could not scan: %v", err)
+		}
+		actual = append(actual, fmt.Sprintf("%v:%v<%v", name, kind, parent))
+	}
+	expected := []string{
+		fmt.Sprintf("//top:%v<", vcd.ScopeKindModule),
+		fmt.Sprintf("//top/bus_if:%v<//top", vcd.ScopeKindInterface),
+		fmt.Sprintf("//top/gen:%v<//top", vcd.ScopeKindVHDLForGenerate),
+		fmt.Sprintf("//top/gen/p:%v<//top/gen", vcd.ScopeKindVHDLProcess),
+		fmt.Sprintf("//top/t:%v<//top", vcd.ScopeKindTask),
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, actual)
+	}
+}
+
+func TestConvertSignalInfo(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const input = `
+$var wire 1 ! rst $end
+$scope module top $end
+$attrbegin misc 02 STD_LOGIC_VECTOR 1030 $end
+$var wire 8 " data [7:0] $end
+$var wire 1 # \bus[3] [1] $end
+$scope module cpu $end
+$var port [3:0] <0 p $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+`
+	r := vcd.NewReader(strings.NewReader(input), vcd.WithFilename("test.vcd"))
+	dbx := openTestDB(t, ctx)
+	if err := ConvertReader(ctx, r, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	rows, err := dbx.Query(`
+        SELECT      Signals.Name, IFNULL(Scopes.Name, ''), Signals.LocalName,
+                    Signals.Raw, IFNULL(Signals.Msb, ''), IFNULL(Signals.Lsb, ''),
+                    IFNULL(Signals.Attrs, '')
+        FROM        Signals
+        LEFT JOIN   Scopes
+        ON          Signals.ScopeId = Scopes.Id
+        ORDER BY    Signals.Name;`)
+	if err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	defer rows.Close()
+	var actual []string
+	for rows.Next() {
+		var name, scope, local, raw, msb, lsb, attrs string
+		if err := rows.Scan(&name, &scope, &local, &raw, &msb, &lsb, &attrs); err != nil {
+			t.Fatalf("could not scan: %v", err)
+		}
+		actual = append(actual, fmt.Sprintf("%v<%v %q %q [%v:%v] %q", name, scope, local, raw, msb, lsb, attrs))
+	}
+	expected := []string{
+		`//rst< "rst" "rst" [:] ""`,
+		`//top/bus[3][1]<//top "bus[3]" "\\bus[3] [1]" [1:1] ""`,
+		`//top/cpu/p<//top/cpu "p" "p" [3:0] ""`,
+		`//top/data[7:0]<//top "data" "data[7:0]" [7:0] "misc 02 STD_LOGIC_VECTOR 1030"`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+// TestConvertEscapedNames checks that names with a `/` can not be taken for
+// scopes.
+func TestConvertEscapedNames(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const input = `
+$scope module top $end
+$var wire 1 ! \a/b $end
+$var wire 1 " \gen.blk[0] $end
+$scope module a $end
+$var wire 1 # b $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+`
+	r := vcd.NewReader(strings.NewReader(input), vcd.WithFilename("test.vcd"))
+	dbx := openTestDB(t, ctx)
+	if err := ConvertReader(ctx, r, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	rows, err := dbx.Query(`
+        SELECT      Name, Code
+        FROM        Signals
+        ORDER BY    Name;`)
+	if err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	defer rows.Close()
+	var actual []string
+	for rows.Next() {
+		var name, code string
+		if err := rows.Scan(&name, &code); err != nil {
+			t.Fatalf("could not scan: %v", err)
+		}
+		actual = append(actual, name+":"+code)
+	}
+	expected := []string{
+		`//top/a%2Fb:!`,
+		`//top/a/b:#`,
+		`//top/gen.blk[0]:"`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, actual)
+	}
+}
+
+func TestConvertEnum(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const input = `
+$attrbegin misc 07 state_t 3 IDLE RUN WAIT 00 01 10 1 $end
+$scope module top $end
+$attrbegin misc 07 1 $end
+$var logic 2 ! state $end
+$upscope $end
+$enddefinitions $end
+#0
+b0 !
+#10
+b10 !
+#20
+b11 !
+`
+	f, err := vcd.NewParser[vcd.File]().ParseString("test.vcd", input)
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	dbx := openTestDB(t, ctx)
+	if err := Convert(ctx, f, dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	rows, err := dbx.Query(`
+        SELECT      Svalues.Timestamp, Svalues.Value, IFNULL(EnumValues.Name, '')
+        FROM        Svalues LEFT JOIN EnumValues
+        ON          ` + db.EnumValueJoin + `
+        ORDER BY    Svalues.Id;`)
+	if err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	defer rows.Close()
+	var actual []string
+	for rows.Next() {
+		var (
+			value, name string
+			ts          uint64
+		)
+		if err := rows.Scan(&ts, &value, &name); err != nil {
+			t.Fatalf("could not scan: %v", err)
+		}
+		actual = append(actual, fmt.Sprintf("%v=%v(%v)", ts, value, name))
+	}
+	expected := []string{"0=0(IDLE)", "10=10(WAIT)", "20=11()"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, actual)
+	}
+}
+
+// BenchmarkConvertStream converts a synthetic dump of b.N value changes.
+func BenchmarkConvertStream(b *testing.B) {
+	ctx := context.Background()
+	dbx, err := db.OpenDB(ctx, filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("could not open DB: %v", err)
+	}
+	defer dbx.Close()
+	b.ResetTimer()
+	if err := ConvertStream(ctx, &dumpReader{n: b.N}, dbx); err != nil {
+		b.Fatalf("could not convert: %v", err)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "changes/s")
+}
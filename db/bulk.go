@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// valueColumns is the number of columns that ValueWriter sets per row.
+const valueColumns = 5
+
+// ValueBatch is the number of rows that ValueWriter inserts at once. SQLite
+// allows up to 32766 parameters in a statement.
+const ValueBatch = 200
+
+// insertValues returns the statement that inserts n value changes.
+func insertValues(n int) string {
+	row := "(?" + strings.Repeat(", ?", valueColumns-1) + ")"
+	return `INSERT INTO Svalues(Timestamp, Code, Value, Strength0, Strength1) VALUES ` +
+		row + strings.Repeat(", "+row, n-1)
+}
+
+// ValueWriter adds value changes to the Svalues table in bulk. It keeps the
+// value changes until it has ValueBatch of them, and then inserts them all
+// with one prepared statement. Call Flush to insert the rest before the
+// transaction is committed.
+type ValueWriter struct {
+	tx   *sql.Tx
+	stmt *sql.Stmt // Inserts ValueBatch rows.
+	args []any
+}
+
+// NewValueWriter returns a ValueWriter that inserts in tx. It is valid as
+// long as tx is.
+func NewValueWriter(ctx context.Context, tx *sql.Tx) (*ValueWriter, error) {
+	stmt, err := tx.PrepareContext(ctx, insertValues(ValueBatch))
+	if err != nil {
+		return nil, fmt.Errorf("db.NewValueWriter: could not prepare: %w", err)
+	}
+	return &ValueWriter{
+		tx:   tx,
+		stmt: stmt,
+		args: make([]any, 0, ValueBatch*valueColumns),
+	}, nil
+}
+
+// Add adds a value change, as AddValue does.
+func (self *ValueWriter) Add(ctx context.Context, timestamp uint64, code, value string) error {
+	return self.add(ctx, timestamp, code, value, nil, nil)
+}
+
+// AddPort adds a value change of an extended VCD port, as AddPortValue
+// does.
+func (self *ValueWriter) AddPort(ctx context.Context,
+	timestamp uint64, code, value, strength0, strength1 string) error {
+	return self.add(ctx, timestamp, code, value, strength0, strength1)
+}
+
+func (self *ValueWriter) add(ctx context.Context,
+	timestamp uint64, code, value string, strength0, strength1 any) error {
+	self.args = append(self.args, int64(timestamp), code, value, strength0, strength1)
+	if len(self.args) < cap(self.args) {
+		return nil
+	}
+	_, err := self.stmt.ExecContext(ctx, self.args...)
+	self.args = self.args[:0]
+	if err != nil {
+		return fmt.Errorf("db.ValueWriter: could not insert: %w", err)
+	}
+	return nil
+}
+
+// Flush inserts the value changes that were added since the last insert,
+// and closes the prepared statement. The ValueWriter may not be used after.
+func (self *ValueWriter) Flush(ctx context.Context) error {
+	defer self.stmt.Close()
+	if len(self.args) == 0 {
+		return nil
+	}
+	n := len(self.args) / valueColumns
+	glog.V(3).Infof("db.ValueWriter: flushing %v rows", n)
+	_, err := self.tx.ExecContext(ctx, insertValues(n), self.args...)
+	self.args = self.args[:0]
+	if err != nil {
+		return fmt.Errorf("db.ValueWriter: could not flush: %w", err)
+	}
+	return nil
+}
+
+// BulkLoad prepares the connection conn for adding many rows: it keeps the
+// rollback journal in memory, does not wait for the writes to reach the
+// disk, and drops the indexes of Svalues. A crash during the load may leave
+// the database corrupt, which is no loss for a database that is being made
+// from a VCD file.
+//
+// The returned function creates the indexes again and restores the
+// settings; call it when done, whether the load succeeded or not.
+func BulkLoad(ctx context.Context, conn *sql.Conn) (func(context.Context) error, error) {
+	var journal string
+	var synchronous int
+	if err := conn.QueryRowContext(ctx, `PRAGMA journal_mode;`).Scan(&journal); err != nil {
+		return nil, fmt.Errorf("db.BulkLoad: could not get the journal mode: %w", err)
+	}
+	if err := conn.QueryRowContext(ctx, `PRAGMA synchronous;`).Scan(&synchronous); err != nil {
+		return nil, fmt.Errorf("db.BulkLoad: could not get the sync mode: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `
+        PRAGMA journal_mode = MEMORY;
+        PRAGMA synchronous = OFF;
+        DROP INDEX IF EXISTS SvaluesByCodeAndTimestamp;
+        `); err != nil {
+		return nil, fmt.Errorf("db.BulkLoad: %w", err)
+	}
+	return func(ctx context.Context) error {
+		if _, err := conn.ExecContext(ctx, createValueIndexes); err != nil {
+			return fmt.Errorf("db.BulkLoad: could not create the indexes: %w", err)
+		}
+		// PRAGMA does not take parameters.
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(`
+            PRAGMA journal_mode = %s;
+            PRAGMA synchronous = %d;
+            `, journal, synchronous)); err != nil {
+			return fmt.Errorf("db.BulkLoad: could not restore the settings: %w", err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/golang/glog"
+)
+
+// Metadata describes the VCD file that a database was converted from.
+type Metadata struct {
+	// Timescale is nil if the file declares none.
+	Timescale *vcd.TimescaleT
+	// The texts of `$date`, `$version` and the `$comment`s among the
+	// declarations, as in vcd.Header.
+	Date     string
+	Version  string
+	Comments []string
+	// FirstTimestamp and LastTimestamp are the first and the last simulation
+	// times, nil if there are none.
+	FirstTimestamp *uint64
+	LastTimestamp  *uint64
+	// Filename and Hash are the name of the file, and the SHA-256 of its
+	// contents in hex. Empty if they are not known.
+	Filename string
+	Hash     string
+}
+
+// SetMetadata records m as the metadata of the database, in place of any
+// that was recorded before.
+func SetMetadata(ctx context.Context, tx *sql.Tx, m *Metadata) error {
+	glog.V(2).Infof("db.SetMetadata: %+v", m)
+	var (
+		number *int64
+		unit   *string
+	)
+	if t := m.Timescale; t != nil && t.Unit != nil {
+		u := t.Unit.String()
+		number, unit = &t.Number, &u
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM Metadata;`); err != nil {
+		return fmt.Errorf("db.SetMetadata: could not clear: %w", err)
+	}
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO Metadata(
+            TimescaleNumber, TimescaleUnit, Date, Version, Comments,
+            FirstTimestamp, LastTimestamp, Filename, Hash)
+        VALUES(?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?, NULLIF(?, ''), NULLIF(?, ''));
+        `,
+		number, unit, m.Date, m.Version, strings.Join(m.Comments, "\n"),
+		m.FirstTimestamp, m.LastTimestamp, m.Filename, m.Hash)
+	if err != nil {
+		return fmt.Errorf("db.SetMetadata: could not exec tx: %w", err)
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata of the database. Returns an empty
+// Metadata if none was recorded.
+func GetMetadata(ctx context.Context, dbx *sql.DB) (*Metadata, error) {
+	var (
+		ret                           Metadata
+		number                        sql.NullInt64
+		unit, date, version, comments sql.NullString
+		filename, hash                sql.NullString
+		firstTimestamp, lastTimestamp sql.NullInt64
+	)
+	err := dbx.QueryRowContext(ctx, `
+        SELECT      TimescaleNumber, TimescaleUnit, Date, Version, Comments,
+                    FirstTimestamp, LastTimestamp, Filename, Hash
+        FROM        Metadata;
+        `).Scan(&number, &unit, &date, &version, &comments,
+		&firstTimestamp, &lastTimestamp, &filename, &hash)
+	if err == sql.ErrNoRows {
+		return &ret, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("db.GetMetadata: %w", err)
+	}
+	if number.Valid && unit.Valid {
+		u, err := vcd.ParseTimeUnit(unit.String)
+		if err != nil {
+			return nil, fmt.Errorf("db.GetMetadata: %w", err)
+		}
+		ret.Timescale = &vcd.TimescaleT{Number: number.Int64, Unit: u}
+	}
+	ret.Date, ret.Version = date.String, version.String
+	if comments.Valid {
+		ret.Comments = strings.Split(comments.String, "\n")
+	}
+	if firstTimestamp.Valid {
+		ret.FirstTimestamp = ptr(uint64(firstTimestamp.Int64))
+	}
+	if lastTimestamp.Valid {
+		ret.LastTimestamp = ptr(uint64(lastTimestamp.Int64))
+	}
+	ret.Filename, ret.Hash = filename.String, hash.String
+	return &ret, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -85,6 +85,15 @@ func CreateDBFile(name string) (bool, error) {
 	return needsInit, nil
 }
 
+// createValueIndexes creates the indexes of Svalues. BulkLoad drops them
+// while loading.
+const createValueIndexes = `
+        CREATE INDEX IF NOT EXISTS
+            SvaluesByCodeAndTimestamp
+        ON
+            Svalues(Code, Timestamp, Value);
+`
+
 // CreateSchema schedules a transactional schema creation.
 func CreateSchema(ctx context.Context, tx *sql.Tx) error {
 	_, err := tx.ExecContext(ctx, `
@@ -93,7 +102,22 @@ func CreateSchema(ctx context.Context, tx *sql.Tx) error {
                 Name STRING PRIMARY KEY,
                 Type INTEGER NOT NULL,
                 Code STRING NOT NULL,
-                Size INTEGER NOT NULL
+                Size INTEGER NOT NULL,
+                -- NULL for the signals outside of any scope.
+                ScopeId INTEGER,
+                -- The name in the scope, without escapes and indices: data.
+                LocalName TEXT,
+                -- The reference as the VCD file has it, with escapes: \bus[3] [1].
+                Raw TEXT,
+                -- The declared bit range, from the indices of the reference
+                -- or the range of a port. Both are the index of a bit
+                -- select, such as bus[3]. NULL if there are none.
+                Msb INTEGER,
+                Lsb INTEGER,
+                -- The attributes declared before the signal, one per line,
+                -- as they are in $attrbegin: misc 02 STD_LOGIC 1030.
+                Attrs TEXT,
+                FOREIGN KEY(ScopeId) REFERENCES Scopes(Id)
             );
 
         CREATE INDEX
@@ -101,20 +125,72 @@ func CreateSchema(ctx context.Context, tx *sql.Tx) error {
         ON
             Signals(Code, Name);
 
+        CREATE INDEX
+            SignalsByScope
+        ON
+            Signals(ScopeId);
+
+        CREATE TABLE
+            Scopes(
+                Id INTEGER PRIMARY KEY,
+                -- The full name, as those of signals: //top/cpu.
+                Name TEXT NOT NULL UNIQUE,
+                -- The name in the parent scope, without escapes: cpu.
+                LocalName TEXT NOT NULL,
+                Kind INTEGER NOT NULL,
+                -- NULL for the top level scopes.
+                Parent INTEGER,
+                FOREIGN KEY(Parent) REFERENCES Scopes(Id)
+            );
+
+        CREATE INDEX
+            ScopesByParent
+        ON
+            Scopes(Parent);
+
+        -- The names of the values of enum signals.
+        CREATE TABLE
+            EnumValues(
+                Code STRING NOT NULL,
+                Value TEXT NOT NULL,
+                Name TEXT NOT NULL,
+                PRIMARY KEY(Code, Value)
+            );
+
+        -- The VCD file that the database was converted from, in a single
+        -- row. See Metadata.
+        CREATE TABLE
+            Metadata(
+                -- The timescale, such as 10 and ps. NULL if the file
+                -- declares none.
+                TimescaleNumber INTEGER,
+                TimescaleUnit TEXT,
+                Date TEXT,
+                Version TEXT,
+                -- The comments among the declarations, one per line.
+                Comments TEXT,
+                -- The first and the last simulation times. NULL if there
+                -- are none.
+                FirstTimestamp INTEGER,
+                LastTimestamp INTEGER,
+                Filename TEXT,
+                -- The SHA-256 of the contents of the file, in hex.
+                Hash TEXT
+            );
+
         CREATE TABLE
             Svalues(
                 Id INTEGER PRIMARY KEY AUTOINCREMENT,
                 Timestamp INTEGER NOT NULL,
                 Code STRING NOT NULL,
-                Value STRING NOT NULL,
+                Value TEXT NOT NULL,
+                -- Set for extended VCD ports only.
+                Strength0 TEXT,
+                Strength1 TEXT,
                 FOREIGN KEY(Code) REFERENCES Signals(Code)
             );
 
-        CREATE INDEX
-            SvaluesByCodeAndTimestamp
-        ON
-            Svalues(Code, Timestamp, Value);
-        `)
+        `+createValueIndexes)
 	if err != nil {
 		return fmt.Errorf("could not create schema: %w", err)
 	}
@@ -123,23 +199,119 @@ func CreateSchema(ctx context.Context, tx *sql.Tx) error {
 
 func AddSignal(ctx context.Context, tx *sql.Tx,
 	name string, kindCode vcd.VarKindCode, code string, size int) error {
+	if err := AddSignalInfo(ctx, tx, name, kindCode, code, size, SignalInfo{}); err != nil {
+		return fmt.Errorf("db/AddSignal: %w", err)
+	}
+	return nil
+}
+
+// SignalInfo is the metadata of a signal besides its name, kind, code and
+// size. The zero value leaves all of it unset.
+type SignalInfo struct {
+	// ScopeId is the Id of the scope that declares the signal, as AddScope
+	// returns it, or 0 for none.
+	ScopeId   int64
+	LocalName string
+	Raw       string
+	// Msb and Lsb are the declared bit range, nil if there is none.
+	Msb, Lsb *int
+	// Attrs are the attributes of the signal, one per line.
+	Attrs string
+}
+
+// AddSignalInfo adds a signal, as AddSignal does, along with its metadata.
+func AddSignalInfo(ctx context.Context, tx *sql.Tx,
+	name string, kindCode vcd.VarKindCode, code string, size int, info SignalInfo) error {
 	glog.V(2).Infof(
-		"db/addSignal: name=%q; kindCode=%v code=%q size=%v",
-		name, kindCode, code, size)
+		"db/addSignal: name=%q; kindCode=%v code=%q size=%v info=%+v",
+		name, kindCode, code, size, info)
 	_, err := tx.ExecContext(ctx, `
-    INSERT INTO Signals(Name, Type, Code, Size)
-            VALUES(?, ?, ?, ?);
+    INSERT INTO Signals(Name, Type, Code, Size, ScopeId, LocalName, Raw, Msb, Lsb, Attrs)
+            VALUES(?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''), ?, ?, NULLIF(?, ''));
         `,
-		name, kindCode.Int(), code, size)
+		name, kindCode.Int(), code, size,
+		info.ScopeId, info.LocalName, info.Raw, info.Msb, info.Lsb, info.Attrs)
 	if err != nil {
 		glog.V(1).Infof(
 			"db/addSignal: name=%q; kindCode=%v code=%q size=%v",
 			name, kindCode, code, size)
-		return fmt.Errorf("db/AddSignal: could not exec tx(%q,%v,%q,%d): %w", name, kindCode, code, size, err)
+		return fmt.Errorf("db/AddSignalInfo: could not exec tx(%q,%v,%q,%d): %w", name, kindCode, code, size, err)
+	}
+	return nil
+}
+
+// AddScope adds a scope by its full name, and returns its Id. localName is
+// the name of the scope in its parent. A scope may be opened more than once
+// in a VCD file; only the first one is recorded, and its Id is returned for
+// the others. parent is the Id of the parent scope, 0 for top level scopes.
+func AddScope(ctx context.Context, tx *sql.Tx,
+	name, localName string, kindCode vcd.ScopeKindCode, parent int64) (int64, error) {
+	glog.V(2).Infof("db.AddScope: name=%q; kindCode=%v parent=%v", name, kindCode, parent)
+	_, err := tx.ExecContext(ctx, `
+        INSERT OR IGNORE INTO Scopes(Name, LocalName, Kind, Parent)
+        VALUES(?, ?, ?, NULLIF(?, 0));
+        `,
+		name, localName, kindCode.Int(), parent)
+	if err != nil {
+		return 0, fmt.Errorf("db.AddScope: could not exec tx(%q,%v,%v): %w", name, kindCode, parent, err)
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, `SELECT Id FROM Scopes WHERE Name = ?;`, name).Scan(&id); err != nil {
+		return 0, fmt.Errorf("db.AddScope: could not get the id of %q: %w", name, err)
+	}
+	return id, nil
+}
+
+// AddEnumValue records the name of a value of the enum signal with the given
+// code.
+func AddEnumValue(ctx context.Context, tx *sql.Tx, code, value, name string) error {
+	glog.V(2).Infof("db.AddEnumValue: code=%q value=%q name=%q", code, value, name)
+	_, err := tx.ExecContext(ctx, `
+        INSERT OR IGNORE INTO EnumValues(Code, Value, Name)
+        VALUES(?, ?, ?);
+        `,
+		code, value, name)
+	if err != nil {
+		return fmt.Errorf("db.AddEnumValue: could not exec tx(%q,%q,%q): %w", code, value, name, err)
 	}
 	return nil
 }
 
+// EnumValueJoin is the condition for joining EnumValues to Svalues. It
+// ignores leading zeros, which writers may or may not write. The values of
+// enums are always known.
+const EnumValueJoin = `
+        EnumValues.Code = Svalues.Code
+    AND LTRIM(EnumValues.Value, '0') = LTRIM(Svalues.Value, '0')`
+
+// FourState returns an SQL expression for the value in column, such as
+// `Svalues.Value`, mapped to the four values of Verilog as
+// vcd.Value.FourState maps it: L is 0, H is 1, and U, W and don't-care are x.
+// Only the values of signals whose kind, in kindColumn such as
+// `Signals.Type`, has bit vector values are mapped, and only if they are
+// made of the nine letters of std_logic. Others, such as reals and strings,
+// even a string `h`, are left alone.
+func FourState(column, kindColumn string) string {
+	return fmt.Sprintf(`
+        CASE WHEN %[2]s IN (%[3]s)
+              OR LOWER(%[1]s) GLOB '*[^01xzuwlh-]*' THEN %[1]s
+        ELSE REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(
+            LOWER(%[1]s), 'l', '0'), 'h', '1'), 'u', 'x'), 'w', 'x'), '-', 'x')
+        END`, column, kindColumn, notVectorKinds)
+}
+
+// notVectorKinds are the kinds of signals whose values are not bit vectors,
+// as an SQL list.
+var notVectorKinds = func() string {
+	var ret []string
+	for k := vcd.VarKindCode(0); k < vcd.VarKindUnknown; k++ {
+		if k.Encoding() != vcd.EncodingVector {
+			ret = append(ret, fmt.Sprint(int(k)))
+		}
+	}
+	return strings.Join(ret, ", ")
+}()
+
 func FindSignalByName(ctx context.Context, tx *sql.Tx, name string) *sql.Row {
 	glog.V(2).Infof(
 		"db/FindSignal: name=%v", name,
@@ -156,9 +328,12 @@ func FindSignalByName(ctx context.Context, tx *sql.Tx, name string) *sql.Row {
 	return res
 }
 
+// AddValue adds a value change. To add many, ValueWriter is much faster.
 func AddValue(ctx context.Context, tx *sql.Tx,
 	timestamp uint64, code string, value string) error {
-	glog.V(2).Infof("db.AddValue: timestamp=%d; code=%q value=%q", timestamp, code, value)
+	if glog.V(2) {
+		glog.Infof("db.AddValue: timestamp=%d; code=%q value=%q", timestamp, code, value)
+	}
 	_, err := tx.ExecContext(ctx, `
         INSERT INTO Svalues(Timestamp, Code, Value) VALUES (?, ?, ?)
     `, timestamp, code, value)
@@ -170,6 +345,24 @@ func AddValue(ctx context.Context, tx *sql.Tx,
 	return nil
 }
 
+// AddPortValue adds a value change of an extended VCD port, which also has
+// the strengths of its 0 and 1 components.
+func AddPortValue(ctx context.Context, tx *sql.Tx,
+	timestamp uint64, code string, value, strength0, strength1 string) error {
+	if glog.V(2) {
+		glog.Infof("db.AddPortValue: timestamp=%d; code=%q value=%q strengths=%q,%q",
+			timestamp, code, value, strength0, strength1)
+	}
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO Svalues(Timestamp, Code, Value, Strength0, Strength1)
+        VALUES (?, ?, ?, ?, ?)
+    `, timestamp, code, value, strength0, strength1)
+	if err != nil {
+		return fmt.Errorf("db.AddPortValue: could not exec tx: %w", err)
+	}
+	return nil
+}
+
 func FindValueById(ctx context.Context, tx *sql.Tx, id uint64) *sql.Row {
 	glog.V(2).Infof("db.FindValueById: id=%v", id)
 	res := tx.QueryRowContext(ctx, `
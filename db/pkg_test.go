@@ -2,6 +2,9 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/filmil/go-vcd-parser/vcd"
@@ -56,3 +59,235 @@ func TestInsertRead(t *testing.T) {
 		t.Fatalf("could not commit: %v", err)
 	}
 }
+
+func TestFourState(t *testing.T) {
+	t.Parallel()
+	db, err := sql.Open(SqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer db.Close()
+	tests := []struct {
+		input    string
+		kind     vcd.VarKindCode
+		expected string
+	}{
+		{"ux01zwlh-", vcd.VarKindLogic, "xx01zx01x"},
+		{"UX01ZWLH-", vcd.VarKindLogic, "xx01zx01x"},
+		{"10xz", vcd.VarKindWire, "10xz"},
+		{"h", vcd.VarKindWire, "1"},
+		{"L", vcd.VarKindUnknown, "0"},
+		{"a", vcd.VarKindWire, "a"},
+		{"q", vcd.VarKindWire, "q"},
+		{"?", vcd.VarKindWire, "?"},
+		{"1.5", vcd.VarKindReal, "1.5"},
+		{"hello", vcd.VarKindString, "hello"},
+		{"h", vcd.VarKindString, "h"},
+		{"-", vcd.VarKindString, "-"},
+		{"1", vcd.VarKindReal, "1"},
+		{"", vcd.VarKindWire, ""},
+	}
+	for _, test := range tests {
+		var actual string
+		if err := db.QueryRow(`SELECT `+FourState("?1", "?2"), test.input, test.kind).Scan(&actual); err != nil {
+			t.Fatalf("FourState(%q, %v): %v", test.input, test.kind, err)
+		}
+		if actual != test.expected {
+			t.Errorf("FourState(%q, %v): want: %q, got: %q", test.input, test.kind, test.expected, actual)
+		}
+	}
+}
+
+func TestValueWriter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx, err := OpenDB(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer dbx.Close()
+	conn, err := dbx.Conn(ctx)
+	if err != nil {
+		t.Fatalf("could not get a connection: %v", err)
+	}
+	defer conn.Close()
+	restore, err := BulkLoad(ctx, conn)
+	if err != nil {
+		t.Fatalf("could not set up: %v", err)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("could not create tx: %v", err)
+	}
+	w, err := NewValueWriter(ctx, tx)
+	if err != nil {
+		t.Fatalf("could not make the writer: %v", err)
+	}
+	// A full batch, and a part of one.
+	const n = ValueBatch + 3
+	for i := 0; i < n-1; i++ {
+		if err := w.Add(ctx, uint64(i), "!", "1"); err != nil {
+			t.Fatalf("could not add: %v", err)
+		}
+	}
+	if err := w.AddPort(ctx, n-1, "<0", "D", "6", "0"); err != nil {
+		t.Fatalf("could not add: %v", err)
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatalf("could not flush: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not commit: %v", err)
+	}
+	if err := restore(ctx); err != nil {
+		t.Fatalf("could not restore: %v", err)
+	}
+	var count, last int
+	var strength string
+	if err := dbx.QueryRow(`
+        SELECT COUNT(*), MAX(Timestamp), MAX(IFNULL(Strength0, ''))
+        FROM Svalues;`).Scan(&count, &last, &strength); err != nil {
+		t.Fatalf("could not query: %v", err)
+	}
+	if count != n || last != n-1 || strength != "6" {
+		t.Errorf("want: %v values until %v, got: %v until %v, strength %q", n, n-1, count, last, strength)
+	}
+	var index string
+	if err := dbx.QueryRow(`
+        SELECT name FROM sqlite_master
+        WHERE type = 'index' AND name = 'SvaluesByCodeAndTimestamp';`).Scan(&index); err != nil {
+		t.Errorf("the index is not restored: %v", err)
+	}
+	var synchronous int
+	if err := conn.QueryRowContext(ctx, `PRAGMA synchronous;`).Scan(&synchronous); err != nil || synchronous == 0 {
+		t.Errorf("the sync mode is not restored: %v, %v", synchronous, err)
+	}
+}
+
+// benchmarkValues adds b.N value changes with add, in transactions of 100000.
+func benchmarkValues(b *testing.B, bulk bool,
+	add func(ctx context.Context, tx *sql.Tx, i int) (flush func() error, err error)) {
+	ctx := context.Background()
+	dbx, err := OpenDB(ctx, filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("could not open: %v", err)
+	}
+	defer dbx.Close()
+	conn, err := dbx.Conn(ctx)
+	if err != nil {
+		b.Fatalf("could not get a connection: %v", err)
+	}
+	defer conn.Close()
+	if bulk {
+		restore, err := BulkLoad(ctx, conn)
+		if err != nil {
+			b.Fatalf("could not set up: %v", err)
+		}
+		defer restore(ctx)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			b.Fatalf("could not create tx: %v", err)
+		}
+		var flush func() error
+		for j := 0; j < 100000 && i < b.N; i, j = i+1, j+1 {
+			if flush, err = add(ctx, tx, i); err != nil {
+				b.Fatalf("could not add: %v", err)
+			}
+		}
+		if flush != nil {
+			if err := flush(); err != nil {
+				b.Fatalf("could not flush: %v", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			b.Fatalf("could not commit: %v", err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "changes/s")
+}
+
+// BenchmarkAddValue adds value changes one by one, as the conversion used
+// to.
+func BenchmarkAddValue(b *testing.B) {
+	benchmarkValues(b, false, func(ctx context.Context, tx *sql.Tx, i int) (func() error, error) {
+		return nil, AddValue(ctx, tx, uint64(i), "!", "1")
+	})
+}
+
+// BenchmarkValueWriter adds value changes in bulk, as the conversion does.
+func BenchmarkValueWriter(b *testing.B) {
+	var (
+		w  *ValueWriter
+		in *sql.Tx
+	)
+	benchmarkValues(b, true, func(ctx context.Context, tx *sql.Tx, i int) (func() error, error) {
+		if tx != in {
+			var err error
+			if w, err = NewValueWriter(ctx, tx); err != nil {
+				return nil, err
+			}
+			in = tx
+		}
+		return func() error { return w.Flush(ctx) }, w.Add(ctx, uint64(i), "!", "1")
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx, err := OpenDB(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer dbx.Close()
+	m, err := GetMetadata(ctx, dbx)
+	if err != nil {
+		t.Fatalf("could not get: %v", err)
+	}
+	if !reflect.DeepEqual(m, &Metadata{}) {
+		t.Errorf("want no metadata, got: %+v", m)
+	}
+
+	unit, err := vcd.ParseTimeUnit("ps")
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	first, last := uint64(5), uint64(1000)
+	tests := []*Metadata{
+		{Date: "old"},
+		{
+			Timescale:      &vcd.TimescaleT{Number: 10, Unit: unit},
+			Date:           "Mon Jan 1 00:00:00 2024",
+			Version:        "nvc 1.11",
+			Comments:       []string{"first", "second"},
+			FirstTimestamp: &first,
+			LastTimestamp:  &last,
+			Filename:       "test.vcd",
+			Hash:           "abcd",
+		},
+	}
+	// Each replaces the one before.
+	for _, test := range tests {
+		tx, err := dbx.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("could not create tx: %v", err)
+		}
+		if err := SetMetadata(ctx, tx, test); err != nil {
+			t.Fatalf("could not set: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("could not commit: %v", err)
+		}
+		m, err := GetMetadata(ctx, dbx)
+		if err != nil {
+			t.Fatalf("could not get: %v", err)
+		}
+		if !reflect.DeepEqual(m, test) {
+			t.Errorf("\nwant:\n%+v\ngot:\n%+v", test, m)
+		}
+	}
+}
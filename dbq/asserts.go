@@ -2,6 +2,8 @@ package dbq
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 func (self Timestamp) Testify(t *testing.T) *Timestamp {
 	t.Helper()
 	if self.Error() != nil {
-		t.Fatalf("lookup error:\n\t%v", self.name, self.Error())
+		t.Fatalf("lookup error on signal %q:\n\t%v", self.name, self.Error())
 		return nil
 	}
 	if self.IsNone() {
@@ -37,17 +39,46 @@ func Testify01[V any](t *testing.T, f func() (V, error)) V {
 	return v
 }
 
+// Diff returns the time from sooner to later. The difference is exact,
+// and then truncated to nanoseconds; see Timestamp.D.
 func Diff(sooner, later *Timestamp) time.Duration {
-	d := later.D() - sooner.D()
-	return d
+	switch {
+	case sooner.infty && later.infty:
+		return 0
+	case later.infty:
+		return math.MaxInt64
+	case sooner.infty:
+		return math.MinInt64
+	}
+	d := new(big.Int).Sub(later.femtoseconds(), sooner.femtoseconds())
+	return duration(d)
 }
 
+// After reports whether the timestamp is later than other. Timestamps are
+// compared exactly, in their timescales, so even those less than a
+// nanosecond apart are not the same.
 func (self Timestamp) After(other *Timestamp) bool {
-	return self.D()-other.D() > 0
+	return self.compare(other) > 0
 }
 
+// Before reports whether the timestamp is sooner than other, as exactly as
+// After.
 func (self Timestamp) Before(other *Timestamp) bool {
-	return !self.Eq(other.T()) && !self.After(other)
+	return self.compare(other) < 0
+}
+
+// compare returns -1, 0 or +1 as the timestamp is sooner than, at the same
+// time as, or later than other. TimestampInfty is later than all others.
+func (self Timestamp) compare(other *Timestamp) int {
+	switch {
+	case self.infty && other.infty:
+		return 0
+	case self.infty:
+		return 1
+	case other.infty:
+		return -1
+	}
+	return self.femtoseconds().Cmp(other.femtoseconds())
 }
 
 func IsDuration(dur time.Duration, hp time.Duration) (time.Duration, error) {
@@ -66,9 +97,7 @@ func IsDurationApprox(sooner, later *Timestamp, d time.Duration) error {
 	if sooner.After(later) {
 		return fmt.Errorf("duration mismatch:\n\tduration %v on signal %q should be sooner than %v on signal %q", sooner.D(), sooner.name, later.D(), later.name)
 	}
-	ds := sooner.D()
-	dl := later.D()
-	res, err := IsDuration(dl-ds, d)
+	res, err := IsDuration(Diff(sooner, later), d)
 	if err != nil {
 		return fmt.Errorf("duration %v mismatch between:\n\t(1) timestamp %v on signal %q\n\t(2) timestamp %v on siqnal %q:\n\tdoes not fulfill requested duration: %v\n\t%w",
 			res, sooner.D(), sooner.name, later.D(), later.name, d, err)
@@ -88,7 +117,7 @@ func IsClock(from *Timestamp, clk *Signal, freq float64) error {
 	if cts1.Error() != nil {
 		return fmt.Errorf(
 			"check signal %v has frequency %vHz:\n\t"+
-				"value '1' on %q could not be found after %v:\n\t",
+				"value '1' on %q could not be found after %v:\n\t%w",
 			clk,
 			fmhz,
 			from.name, from.D(), cts1.Error(),
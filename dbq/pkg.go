@@ -6,19 +6,27 @@ import (
 	"flag"
 	"fmt"
 	"math"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/filmil/go-vcd-parser/db"
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/filmil/go-vcd-parser/wave"
 	"github.com/golang/glog"
 )
 
 var (
 	// TimestampInfty is a timestamp that is larger than any conceivable timestamp.
+	// After, Before and Diff take it as later than any other, whatever its
+	// timescale.
 	TimestampInfty = Timestamp{
-		ts: ptr[uint64](math.MaxUint64),
+		ts:    ptr[uint64](math.MaxUint64),
+		infty: true,
 	}
 	TimestampNone = ptr(Timestamp{})
 
@@ -29,6 +37,10 @@ var (
 
 	testDbName string
 	testDb     *sql.DB
+
+	// DefaultTimescale is the timescale of the timestamps of databases and
+	// stores that do not record one.
+	DefaultTimescale = vcd.TimescaleT{Number: 1, Unit: &vcd.TimeUnit{PicoSecond: true}}
 )
 
 func init() {
@@ -55,6 +67,10 @@ type Timestamp struct {
 	err  error
 	name string
 	val  string
+	// The timescale of ts, DefaultTimescale if nil.
+	scale *vcd.TimescaleT
+	// Set only in TimestampInfty.
+	infty bool
 }
 
 // Pretty-prints a Timestamp.
@@ -91,19 +107,149 @@ func (self Timestamp) T() uint64 {
 	return *self.ts
 }
 
+// D returns the time of the timestamp as a duration, in the timescale of the
+// database or store that it is from. Durations shorter than a nanosecond are
+// truncated, and those longer than time.Duration allows, about 292 years,
+// saturate. Compare timestamps with After and Before, which are exact.
+//
+// REQUIRES: self.IsNone() == false
 func (self Timestamp) D() time.Duration {
-	// Assumes sim resolution of 1s.
-	return time.Duration(self.T()) * time.Nanosecond / 1000
+	if self.infty {
+		return math.MaxInt64
+	}
+	return duration(self.femtoseconds())
+}
+
+// femtoseconds returns the time of the timestamp in femtoseconds, exactly.
+//
+// REQUIRES: self.IsNone() == false
+func (self Timestamp) femtoseconds() *big.Int {
+	scale := self.scale
+	if scale == nil {
+		scale = &DefaultTimescale
+	}
+	ret := new(big.Int).SetUint64(self.T())
+	ret.Mul(ret, big.NewInt(scale.Number))
+	return ret.Mul(ret, big.NewInt(unitFemtoseconds(scale.Unit)))
+}
+
+// unitFemtoseconds returns the number of femtoseconds in the unit.
+func unitFemtoseconds(u *vcd.TimeUnit) int64 {
+	switch {
+	case u.Second:
+		return 1e15
+	case u.MilliSecond:
+		return 1e12
+	case u.MicroSecond:
+		return 1e9
+	case u.NanoSecond:
+		return 1e6
+	case u.PicoSecond:
+		return 1e3
+	}
+	return 1
+}
+
+// duration returns fs femtoseconds as a duration, truncated to nanoseconds.
+// Durations that are out of the range of time.Duration saturate.
+func duration(fs *big.Int) time.Duration {
+	ns := new(big.Int).Quo(fs, big.NewInt(1e6))
+	switch {
+	case !ns.IsInt64() && ns.Sign() > 0:
+		return math.MaxInt64
+	case !ns.IsInt64():
+		return math.MinInt64
+	}
+	return time.Duration(ns.Int64())
 }
 
 type Instance struct {
 	db *sql.DB
+	// If set, the queries go to the store instead of db.
+	store *wave.Store
+	// If set, values are compared as four-state values.
+	fourState bool
+
+	// The timescale of the timestamps, set on first use.
+	scaleOnce sync.Once
+	scale     *vcd.TimescaleT
+}
+
+// Option is an option of New and NewFromStore.
+type Option func(*Instance)
+
+// WithFourState makes the queries compare values as Verilog does, with only
+// four states: L is taken as 0, H as 1, and U, W and don't-care as x, so that
+// FindFirst("1") finds H too. The values are returned as they were dumped.
+func WithFourState() Option {
+	return func(i *Instance) {
+		i.fourState = true
+	}
 }
 
-func New(db *sql.DB) *Instance {
-	return &Instance{
+func New(db *sql.DB, opts ...Option) *Instance {
+	ret := &Instance{
 		db: db,
 	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// Timescale returns the timescale of the timestamps: the one that the
+// Metadata table of the database records, or the one that the file of the
+// store declares. DefaultTimescale if there is none.
+func (self *Instance) Timescale() vcd.TimescaleT {
+	return *self.timescale()
+}
+
+func (self *Instance) timescale() *vcd.TimescaleT {
+	self.scaleOnce.Do(func() {
+		var ts *vcd.TimescaleT
+		if self.store != nil {
+			ts = self.store.Timescale()
+		} else if m, err := db.GetMetadata(context.TODO(), self.db); err != nil {
+			glog.Warningf("dbq: no timescale, assuming %v: %v", DefaultTimescale, err)
+		} else {
+			ts = m.Timescale
+		}
+		if ts == nil || ts.Unit == nil {
+			ts = &DefaultTimescale
+		}
+		self.scale = ts
+	})
+	return self.scale
+}
+
+// value returns v, a value of a signal of the kind, as the queries compare
+// it. See db.FourState.
+func (self *Instance) value(kind vcd.VarKindCode, v string) string {
+	if !self.fourState || kind.Encoding() != vcd.EncodingVector ||
+		v == "" || strings.Trim(strings.ToLower(v), "01xzuwlh-") != "" {
+		return v
+	}
+	return vcd.MustParseValue(v).FourState().String()
+}
+
+// valueEq returns the SQL condition that Svalues.Value is equal to the
+// second parameter of the query, as the queries compare values. The query
+// must join Signals.
+func (self *Instance) valueEq() string {
+	if self.fourState {
+		return db.FourState("Svalues.Value", "Signals.Type") + " = " +
+			db.FourState("?2", "Signals.Type")
+	}
+	return "Svalues.Value = ?2"
+}
+
+// match returns a function that matches the values equal to v in the
+// signal s of the store.
+func (self *Instance) match(s *wave.Signal, v string) func(string) bool {
+	v = self.value(s.Kind, v)
+	return func(d string) bool {
+		return self.value(s.Kind, d) == v
+	}
 }
 
 func (self *Instance) Signal(name string) *Signal {
@@ -119,7 +265,7 @@ type Signal struct {
 }
 
 func (self Signal) String() string {
-	return fmt.Sprintf(self.name)
+	return self.name
 }
 
 func (self Signal) Name() string {
@@ -128,8 +274,9 @@ func (self Signal) Name() string {
 
 func (self *Signal) findSignal(t *Timestamp, val string, q string) *Timestamp {
 	ret := &Timestamp{
-		name: self.name,
-		val:  val,
+		name:  self.name,
+		val:   val,
+		scale: self.i.timescale(),
 	}
 	if t.IsNone() {
 		return ret
@@ -161,6 +308,12 @@ func (self *Signal) findSignal(t *Timestamp, val string, q string) *Timestamp {
 }
 
 func (self *Signal) FindBefore(t *Timestamp, val string) *Timestamp {
+	if self.i.store != nil && !t.IsNone() {
+		return self.storeTimestamp(val, func(s *wave.Signal) (uint64, string, bool) {
+			ts, ok := s.FindBeforeFunc(t.T(), self.i.match(s, val))
+			return ts, val, ok
+		})
+	}
 	return self.findSignal(t, val,
 		`
         -- Finds the first matching value before the given timestamp.
@@ -169,13 +322,19 @@ func (self *Signal) FindBefore(t *Timestamp, val string) *Timestamp {
         INNER JOIN  Signals
         ON          Svalues.Code=Signals.Code
         WHERE       Signals.Name=?
-          AND       Svalues.Value=?
+          AND       `+self.i.valueEq()+`
           AND       Svalues.Timestamp < ?;
         `,
 	)
 }
 
 func (self *Signal) FindAfter(t *Timestamp, val string) *Timestamp {
+	if self.i.store != nil && !t.IsNone() {
+		return self.storeTimestamp(val, func(s *wave.Signal) (uint64, string, bool) {
+			ts, ok := s.FindAfterFunc(t.T(), self.i.match(s, val))
+			return ts, val, ok
+		})
+	}
 	return self.findSignal(t, val,
 		`
         -- Finds first timestamp from the beginning of time at which the given
@@ -185,15 +344,16 @@ func (self *Signal) FindAfter(t *Timestamp, val string) *Timestamp {
         INNER JOIN  Signals
         ON          Svalues.Code=Signals.Code
         WHERE       Signals.Name=?
-          AND       Svalues.Value=?
+          AND       `+self.i.valueEq()+`
           AND       Svalues.Timestamp > ?;
         `,
 	)
 }
 
 type Value struct {
-	val *string
-	err error
+	val  *string
+	name string
+	err  error
 }
 
 func (self Value) Error() error {
@@ -209,8 +369,38 @@ func (self Value) IsNone() bool {
 	return self.val == nil
 }
 
+// Name returns the name of the value, if the signal is an enum and the
+// value has a name. Returns an empty string otherwise.
+func (self Value) Name() string {
+	return self.name
+}
+
+// kind returns the kind of the signal, as far as comparing its values needs
+// it: VarKindUnknown if the values compare as they are, or if the signal is
+// unknown.
+func (self *Signal) kind() vcd.VarKindCode {
+	if !self.i.fourState {
+		return vcd.VarKindUnknown
+	}
+	if self.i.store != nil {
+		s, err := self.wave()
+		if err != nil {
+			return vcd.VarKindUnknown
+		}
+		return s.Kind
+	}
+	ret := vcd.VarKindUnknown
+	self.i.db.QueryRowContext(context.TODO(), `
+        SELECT      Type
+        FROM        Signals
+        WHERE       Name = ?;
+        `, self.name).Scan(&ret)
+	return ret
+}
+
 func (self *Signal) EqAt(t *Timestamp, v string) *Timestamp {
-	if self.ValueAtP(t).V() == v {
+	kind := self.kind()
+	if self.i.value(kind, self.ValueAtP(t).V()) == self.i.value(kind, v) {
 		return t
 	}
 	return nil
@@ -219,6 +409,11 @@ func (self *Signal) EqAt(t *Timestamp, v string) *Timestamp {
 // ValueAtP returns the value of the signal exactly at the timestamp - including
 // when there is a signal change exactly at the timestamp.
 func (self *Signal) ValueAtP(t *Timestamp) *Value {
+	if self.i.store != nil {
+		return self.storeValue(func(s *wave.Signal) (string, bool) {
+			return s.ValueAt(t.T())
+		})
+	}
 	var ret Value
 	ctx := context.TODO()
 	dbx := self.i.db
@@ -233,9 +428,11 @@ func (self *Signal) ValueAtP(t *Timestamp) *Value {
         -- Find the value at the most recent transition before the given
         -- timestamp.
         -- TODO: Perhaps introduce a WITH table?
-        SELECT      Svalues.Value
+        SELECT      Svalues.Value, IFNULL(EnumValues.Name, '')
         FROM        Svalues INNER JOIN  Signals
         ON          Svalues.Code = Signals.Code
+        LEFT JOIN   EnumValues
+        ON          `+db.EnumValueJoin+`
         WHERE       Signals.Name = ?
           AND       Svalues.Timestamp = (
             SELECT      MAX(Svalues.Timestamp)
@@ -248,12 +445,12 @@ func (self *Signal) ValueAtP(t *Timestamp) *Value {
         `,
 		self.name, self.name, t.T())
 	if rows.Next() {
-		var val string
-		err := rows.Scan(&val)
+		var val, name string
+		err := rows.Scan(&val, &name)
 		if err != nil {
 			ret.err = err
 		}
-		ret.val = &val
+		ret.val, ret.name = &val, name
 	} else {
 		if rows.Err() != nil {
 			ret.err = rows.Err()
@@ -265,6 +462,11 @@ func (self *Signal) ValueAtP(t *Timestamp) *Value {
 }
 
 func (self *Signal) ValueAt(t *Timestamp) *Value {
+	if self.i.store != nil {
+		return self.storeValue(func(s *wave.Signal) (string, bool) {
+			return s.ValueBefore(t.T())
+		})
+	}
 	var ret Value
 	ctx := context.TODO()
 	dbx := self.i.db
@@ -279,9 +481,11 @@ func (self *Signal) ValueAt(t *Timestamp) *Value {
         -- Find the value at the most recent transition before the given
         -- timestamp.
         -- TODO: Perhaps introduce a WITH table?
-        SELECT      Svalues.Value
+        SELECT      Svalues.Value, IFNULL(EnumValues.Name, '')
         FROM        Svalues INNER JOIN  Signals
         ON          Svalues.Code = Signals.Code
+        LEFT JOIN   EnumValues
+        ON          `+db.EnumValueJoin+`
         WHERE       Signals.Name = ?
           AND       Svalues.Timestamp = (
             SELECT      MAX(Svalues.Timestamp)
@@ -294,12 +498,12 @@ func (self *Signal) ValueAt(t *Timestamp) *Value {
         `,
 		self.name, self.name, t.T())
 	if rows.Next() {
-		var val string
-		err := rows.Scan(&val)
+		var val, name string
+		err := rows.Scan(&val, &name)
 		if err != nil {
 			ret.err = err
 		}
-		ret.val = &val
+		ret.val, ret.name = &val, name
 	} else {
 		if rows.Err() != nil {
 			ret.err = rows.Err()
@@ -309,9 +513,16 @@ func (self *Signal) ValueAt(t *Timestamp) *Value {
 }
 
 func (self *Signal) FindFirst(val string) *Timestamp {
+	if self.i.store != nil {
+		return self.storeTimestamp(val, func(s *wave.Signal) (uint64, string, bool) {
+			ts, ok := s.FindFirstFunc(self.i.match(s, val))
+			return ts, val, ok
+		})
+	}
 	ret := &Timestamp{
-		name: self.name,
-		val:  val,
+		name:  self.name,
+		val:   val,
+		scale: self.i.timescale(),
 	}
 	ctx := context.TODO()
 	dbx := self.i.db
@@ -330,7 +541,7 @@ func (self *Signal) FindFirst(val string) *Timestamp {
         INNER JOIN  Signals
         ON          Svalues.Code=Signals.Code
         WHERE       Signals.Name=?
-          AND       Svalues.Value=?;
+          AND       `+self.i.valueEq()+`;
         `,
 		self.name, val)
 	if err != nil {
@@ -347,7 +558,12 @@ func (self *Signal) FindFirst(val string) *Timestamp {
 }
 
 func (self *Signal) PrevChange(t *Timestamp) *Timestamp {
-	var ret Timestamp
+	if self.i.store != nil {
+		return self.storeTimestamp("", func(s *wave.Signal) (uint64, string, bool) {
+			return s.PrevChange(t.T())
+		})
+	}
+	ret := Timestamp{scale: self.i.timescale()}
 	ctx := context.TODO()
 	dbx := self.i.db
 	tx, err := dbx.Begin()
@@ -393,7 +609,12 @@ func (self *Signal) PrevChange(t *Timestamp) *Timestamp {
 // NextChange finds the *next* timestamp at which the signal changes value,
 // starting from the given timestamp `t`.
 func (self *Signal) NextChange(t *Timestamp) *Timestamp {
-	var ret Timestamp
+	if self.i.store != nil {
+		return self.storeTimestamp("", func(s *wave.Signal) (uint64, string, bool) {
+			return s.NextChange(t.T())
+		})
+	}
+	ret := Timestamp{scale: self.i.timescale()}
 	ctx := context.TODO()
 	dbx := self.i.db
 	tx, err := dbx.Begin()
@@ -2,7 +2,9 @@ package dbq
 
 import (
 	"context"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/filmil/go-vcd-parser/db"
@@ -25,7 +27,7 @@ func TestBasic(t *testing.T) {
 		//
 		// //clk   ________/~~~~~~~~~~...
 		//         ^0      ^100
-		TimeValues([]dbt.TimeValue{{0, "0"}, {100, "Z"}}...)
+		TimeValues([]dbt.TimeValue{{Time: 0, Value: "0"}, {Time: 100, Value: "Z"}}...)
 
 	// Create a query engine.
 	q := New(dbx)
@@ -44,6 +46,86 @@ func TestBasic(t *testing.T) {
 
 }
 
+// TestDefaultTimescale checks the durations of a database that records no
+// timescale.
+func TestDefaultTimescale(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	dbx, err := db.OpenDB(ctx, dbt.NewMemDB())
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	dbt.New(dbx, ctx).
+		Signal("//clk", vcd.VarKindLogic, 1).
+		TimeValues([]dbt.TimeValue{{Time: 0, Value: "0"}, {Time: 1500, Value: "1"}}...)
+
+	q := New(dbx)
+	if ts := q.Timescale(); ts.String() != "1 ps" {
+		t.Errorf("want: 1 ps, got: %v", ts)
+	}
+	if ts := q.Signal("//clk").FindFirst("1"); ts.IsNone() || ts.D() != time.Nanosecond {
+		t.Errorf("want: 1ns, got: %+v", ts)
+	}
+}
+
+// TestTimestampCompare checks that timestamps compare exactly in fine
+// timescales, and that long durations saturate.
+func TestTimestampCompare(t *testing.T) {
+	t.Parallel()
+	fs := &vcd.TimescaleT{Number: 1, Unit: &vcd.TimeUnit{FemtoSecond: true}}
+	ps := &vcd.TimescaleT{Number: 100, Unit: &vcd.TimeUnit{PicoSecond: true}}
+	s := &vcd.TimescaleT{Number: 100, Unit: &vcd.TimeUnit{Second: true}}
+	at := func(n uint64, scale *vcd.TimescaleT) *Timestamp {
+		return &Timestamp{ts: &n, scale: scale}
+	}
+	tests := []struct {
+		name          string
+		sooner, later *Timestamp
+		diff          time.Duration
+	}{
+		{"fs", at(1000, fs), at(1001, fs), 0},
+		{"ps", at(1, ps), at(2, ps), 0},
+		{"fs and ps", at(100000, fs), at(2, ps), 0},
+		{"ps and fs", at(1, ps), at(100001, fs), 0},
+		{"ns apart", at(0, fs), at(2500000, fs), 2 * time.Nanosecond},
+		{"saturated", at(0, s), at(math.MaxUint64, s), math.MaxInt64},
+	}
+	for _, test := range tests {
+		if !test.later.After(test.sooner) || test.sooner.After(test.later) {
+			t.Errorf("%v: After: want %v after %v", test.name, test.later.T(), test.sooner.T())
+		}
+		if !test.sooner.Before(test.later) || test.later.Before(test.sooner) {
+			t.Errorf("%v: Before: want %v before %v", test.name, test.sooner.T(), test.later.T())
+		}
+		if d := Diff(test.sooner, test.later); d != test.diff {
+			t.Errorf("%v: Diff: want: %v, got: %v", test.name, test.diff, d)
+		}
+	}
+	if d := at(math.MaxUint64, s).D(); d != math.MaxInt64 {
+		t.Errorf("D: want: %v, got: %v", time.Duration(math.MaxInt64), d)
+	}
+	if a, b := at(2, ps), at(200000, fs); a.After(b) || a.Before(b) {
+		t.Errorf("want %v and %v at the same time", a, b)
+	}
+	// Later than TimestampInfty would be, if it had the default timescale.
+	late := at(math.MaxUint64/1000, &vcd.TimescaleT{Number: 1, Unit: &vcd.TimeUnit{MilliSecond: true}})
+	for _, ts := range []*Timestamp{late, at(math.MaxUint64, s), &TimestampZero} {
+		if !TimestampInfty.After(ts) || ts.After(&TimestampInfty) || !ts.Before(&TimestampInfty) || TimestampInfty.Before(ts) {
+			t.Errorf("want %v before TimestampInfty", ts.T())
+		}
+		if d := Diff(ts, &TimestampInfty); d != math.MaxInt64 {
+			t.Errorf("Diff to TimestampInfty: want: %v, got: %v", time.Duration(math.MaxInt64), d)
+		}
+	}
+	if TimestampInfty.After(&TimestampInfty) || Diff(&TimestampInfty, &TimestampInfty) != 0 {
+		t.Errorf("want TimestampInfty at the same time as itself")
+	}
+	if !TimestampZero.Before(late) || Diff(&TimestampZero, at(3, s)) != 300*time.Second {
+		t.Errorf("want TimestampZero at time zero in any timescale")
+	}
+}
+
 func TestValueAt(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -59,7 +141,7 @@ func TestValueAt(t *testing.T) {
 		//
 		// //clk   ________/~~~~~~~~~~...
 		//         ^0      ^100
-		TimeValues([]dbt.TimeValue{{0, "0"}, {100, "Z"}, {200, "1"}}...)
+		TimeValues([]dbt.TimeValue{{Time: 0, Value: "0"}, {Time: 100, Value: "Z"}, {Time: 200, Value: "1"}}...)
 
 	// Create a query engine.
 	q := New(dbx)
@@ -116,9 +198,9 @@ func TestFindFirst(t *testing.T) {
 	// //clk2 XXXX1111XXXX2222XXXX2222
 	// //clk3 XXXX3333XXXX2222XXXX3333
 	//        ^0  ^100^200^300^400^500
-	s1i.TimeValues([]dbt.TimeValue{{0, "X"}, {100, "1"}, {200, "X"}, {300, "1"}, {400, "X"}, {500, "1"}}...)
-	s2i.TimeValues([]dbt.TimeValue{{0, "X"}, {100, "1"}, {200, "X"}, {300, "2"}, {400, "X"}, {500, "2"}}...)
-	s3i.TimeValues([]dbt.TimeValue{{0, "X"}, {100, "3"}, {200, "X"}, {300, "2"}, {400, "X"}, {500, "3"}}...)
+	s1i.TimeValues([]dbt.TimeValue{{Time: 0, Value: "X"}, {Time: 100, Value: "1"}, {Time: 200, Value: "X"}, {Time: 300, Value: "1"}, {Time: 400, Value: "X"}, {Time: 500, Value: "1"}}...)
+	s2i.TimeValues([]dbt.TimeValue{{Time: 0, Value: "X"}, {Time: 100, Value: "1"}, {Time: 200, Value: "X"}, {Time: 300, Value: "2"}, {Time: 400, Value: "X"}, {Time: 500, Value: "2"}}...)
+	s3i.TimeValues([]dbt.TimeValue{{Time: 0, Value: "X"}, {Time: 100, Value: "3"}, {Time: 200, Value: "X"}, {Time: 300, Value: "2"}, {Time: 400, Value: "X"}, {Time: 500, Value: "3"}}...)
 
 	// Create a query engine.
 	q := New(dbx)
@@ -145,3 +227,43 @@ func TestFindFirst(t *testing.T) {
 	}
 
 }
+
+func TestEnumNames(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	dbx, err := db.OpenDB(ctx, dbt.NewMemDB())
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	i := dbt.New(dbx, ctx)
+	i.
+		Signal("//state", vcd.VarKindLogic, 2).
+		// Enum tables need not write the leading zeros.
+		EnumNames([]dbt.EnumName{{Value: "0", Name: "IDLE"}, {Value: "1", Name: "RUN"}, {Value: "10", Name: "WAIT"}}...).
+		TimeValues([]dbt.TimeValue{{Time: 0, Value: "00"}, {Time: 100, Value: "10"}, {Time: 200, Value: "11"}}...)
+
+	q := New(dbx)
+	s := q.Signal("//state")
+	tests := []struct {
+		ts          uint64
+		value, name string
+	}{
+		{50, "00", "IDLE"},
+		{150, "10", "WAIT"},
+		{250, "11", ""},
+	}
+	for _, test := range tests {
+		v := s.ValueAt(&Timestamp{ts: &test.ts})
+		if v.Error() != nil {
+			t.Fatalf("at %v: %v", test.ts, v.Error())
+		}
+		if v.IsNone() || v.V() != test.value || v.Name() != test.name {
+			t.Errorf("at %v: want: %v (%v), got: %v", test.ts, test.value, test.name, spew.Sdump(v))
+		}
+	}
+	ts := uint64(100)
+	if v := s.ValueAtP(&Timestamp{ts: &ts}); v.Name() != "WAIT" {
+		t.Errorf("want: WAIT, got: %v", spew.Sdump(v))
+	}
+}
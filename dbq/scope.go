@@ -0,0 +1,222 @@
+package dbq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// Scope is a scope in the hierarchy of the signals, such as the module
+// `//top/cpu`. Its name is a prefix of the names of the signals under it.
+type Scope struct {
+	i         *Instance
+	name      string
+	localName string
+	kind      vcd.ScopeKindCode
+
+	// id is the Id of the scope in the database.
+	id int64
+	// s is the scope in the store.
+	s *vcd.Scope
+}
+
+func (self Scope) String() string {
+	return self.name
+}
+
+// Name returns the full name of the scope, such as `//top/cpu`.
+func (self Scope) Name() string {
+	return self.name
+}
+
+// LocalName returns the name of the scope in its parent, without escapes,
+// such as `cpu`.
+func (self Scope) LocalName() string {
+	return self.localName
+}
+
+// Kind returns the kind of the scope, such as vcd.ScopeKindModule.
+func (self Scope) Kind() vcd.ScopeKindCode {
+	return self.kind
+}
+
+// Scopes returns the top level scopes, in the order of declaration.
+func (self *Instance) Scopes() ([]*Scope, error) {
+	if self.store != nil {
+		return self.storeScopes(self.store.Hierarchy().Root.Children), nil
+	}
+	ret, err := self.queryScopes(`
+        SELECT      Id, Name, LocalName, Kind
+        FROM        Scopes
+        WHERE       Parent IS NULL
+        ORDER BY    Id;
+        `)
+	if err != nil {
+		return nil, fmt.Errorf("dbq.Instance.Scopes: %w", err)
+	}
+	return ret, nil
+}
+
+// Scope returns the scope with the full name, such as `//top/cpu`. As with
+// signals, the names of a store, such as `/top/cpu`, work too.
+func (self *Instance) Scope(name string) (*Scope, error) {
+	var ret []*Scope
+	if self.store != nil {
+		h := self.store.Hierarchy()
+		s := h.Scope(name)
+		if s == nil && strings.HasPrefix(name, "//") {
+			s = h.Scope(name[1:])
+		}
+		if s != nil && s.Parent != nil {
+			ret = self.storeScopes([]*vcd.Scope{s})
+		}
+	} else {
+		var err error
+		ret, err = self.queryScopes(`
+            SELECT      Id, Name, LocalName, Kind
+            FROM        Scopes
+            WHERE       Name = ?;
+            `, name)
+		if err != nil {
+			return nil, fmt.Errorf("dbq.Instance.Scope: %w", err)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("dbq: unknown scope: %q", name)
+	}
+	return ret[0], nil
+}
+
+// Children returns the scopes directly in the scope, in the order of
+// declaration.
+func (self *Scope) Children() ([]*Scope, error) {
+	if self.s != nil {
+		return self.i.storeScopes(self.s.Children), nil
+	}
+	ret, err := self.i.queryScopes(`
+        SELECT      Id, Name, LocalName, Kind
+        FROM        Scopes
+        WHERE       Parent = ?
+        ORDER BY    Id;
+        `, self.id)
+	if err != nil {
+		return nil, fmt.Errorf("dbq.Scope.Children: %q: %w", self.name, err)
+	}
+	return ret, nil
+}
+
+// Signals returns the signals declared directly in the scope, in the order
+// of declaration.
+func (self *Scope) Signals() ([]*Signal, error) {
+	if self.s != nil {
+		return self.i.storeSignals(self.s, false), nil
+	}
+	ret, err := self.i.querySignals(`
+        SELECT      Name
+        FROM        Signals
+        WHERE       ScopeId = ?
+        ORDER BY    rowid;
+        `, self.id)
+	if err != nil {
+		return nil, fmt.Errorf("dbq.Scope.Signals: %q: %w", self.name, err)
+	}
+	return ret, nil
+}
+
+// AllSignals returns all signals under the scope: those in it, and those in
+// the scopes in it, recursively. The signals of a scope come before those of
+// its children.
+func (self *Scope) AllSignals() ([]*Signal, error) {
+	if self.s != nil {
+		return self.i.storeSignals(self.s, true), nil
+	}
+	ret, err := self.i.querySignals(`
+        WITH RECURSIVE
+            Under(Id)
+        AS (
+            SELECT      ?
+            UNION ALL
+            SELECT      Scopes.Id
+            FROM        Scopes
+            INNER JOIN  Under
+            ON          Scopes.Parent = Under.Id
+        )
+        SELECT      Name
+        FROM        Signals
+        WHERE       ScopeId IN Under
+        ORDER BY    rowid;
+        `, self.id)
+	if err != nil {
+		return nil, fmt.Errorf("dbq.Scope.AllSignals: %q: %w", self.name, err)
+	}
+	return ret, nil
+}
+
+// queryScopes returns the scopes that q selects, as Id, Name, LocalName and
+// Kind.
+func (self *Instance) queryScopes(q string, args ...any) ([]*Scope, error) {
+	rows, err := self.db.QueryContext(context.TODO(), q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []*Scope
+	for rows.Next() {
+		s := &Scope{i: self}
+		if err := rows.Scan(&s.id, &s.name, &s.localName, &s.kind); err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	return ret, rows.Err()
+}
+
+// querySignals returns the signals that q selects, by name.
+func (self *Instance) querySignals(q string, args ...any) ([]*Signal, error) {
+	rows, err := self.db.QueryContext(context.TODO(), q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []*Signal
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		ret = append(ret, self.Signal(name))
+	}
+	return ret, rows.Err()
+}
+
+// storeScopes returns the scopes of the store, named as in a database.
+func (self *Instance) storeScopes(ss []*vcd.Scope) []*Scope {
+	var ret []*Scope
+	for _, s := range ss {
+		ret = append(ret, &Scope{
+			i:         self,
+			name:      "/" + s.Path,
+			localName: s.Name,
+			kind:      s.Kind,
+			s:         s,
+		})
+	}
+	return ret
+}
+
+// storeSignals returns the signals in the scope s of the store, and those
+// under it if all is set.
+func (self *Instance) storeSignals(s *vcd.Scope, all bool) []*Signal {
+	var ret []*Signal
+	for _, v := range s.Vars {
+		ret = append(ret, self.Signal("/"+v.Path))
+	}
+	if all {
+		for _, c := range s.Children {
+			ret = append(ret, self.storeSignals(c, all)...)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,135 @@
+package dbq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/cvt"
+	"github.com/filmil/go-vcd-parser/db"
+	"github.com/filmil/go-vcd-parser/dbt"
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/filmil/go-vcd-parser/wave"
+)
+
+const scopeTestVCD = `
+$var wire 1 ! rst $end
+$scope module top $end
+$var wire 1 " clk $end
+$scope module cpu $end
+$var wire 8 # pc [7:0] $end
+$scope function alu $end
+$var wire 1 $ carry $end
+$upscope $end
+$upscope $end
+$scope module \io/uart $end
+$var wire 1 % tx $end
+$upscope $end
+$var wire 1 & done $end
+$upscope $end
+$scope module other $end
+$upscope $end
+$enddefinitions $end
+#0
+0! 0" b0 # 0$ 0% 0&
+`
+
+// TestScope checks walking the hierarchy, from both the database and the
+// store.
+func TestScope(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx, err := db.OpenDB(ctx, dbt.NewMemDB())
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	if err := cvt.ConvertReader(ctx, vcd.NewReader(strings.NewReader(scopeTestVCD)), dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	s, err := wave.Load(vcd.NewReader(strings.NewReader(scopeTestVCD)))
+	if err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+
+	scopeNames := func(ss []*Scope) []string {
+		var ret []string
+		for _, s := range ss {
+			ret = append(ret, fmt.Sprintf("%v:%v:%v", s.Name(), s.LocalName(), s.Kind()))
+		}
+		return ret
+	}
+	signalNames := func(ss []*Signal) []string {
+		var ret []string
+		for _, s := range ss {
+			ret = append(ret, s.Name())
+		}
+		return ret
+	}
+	check := func(t *testing.T, what string, want, got []string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%v: %v", what, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%v:\nwant:\n%v\ngot:\n%v", what, want, got)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		i    *Instance
+	}{
+		{"db", New(dbx)},
+		{"store", NewFromStore(s)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			i := test.i
+			top, err := i.Scopes()
+			check(t, "Scopes", []string{
+				"//top:top:module",
+				"//other:other:module",
+			}, scopeNames(top), err)
+
+			children, err := top[0].Children()
+			check(t, "Children", []string{
+				"//top/cpu:cpu:module",
+				"//top/io%2Fuart:io/uart:module",
+			}, scopeNames(children), err)
+
+			signals, err := top[0].Signals()
+			check(t, "Signals", []string{"//top/clk", "//top/done"}, signalNames(signals), err)
+
+			all, err := top[0].AllSignals()
+			check(t, "AllSignals", []string{
+				"//top/clk",
+				"//top/done",
+				"//top/cpu/pc[7:0]",
+				"//top/cpu/alu/carry",
+				"//top/io%2Fuart/tx",
+			}, signalNames(all), err)
+
+			cpu, err := i.Scope("//top/cpu")
+			if err != nil {
+				t.Fatalf("Scope: %v", err)
+			}
+			all, err = cpu.AllSignals()
+			check(t, "AllSignals of cpu", []string{"//top/cpu/pc[7:0]", "//top/cpu/alu/carry"}, signalNames(all), err)
+
+			other, err := i.Scope("//other")
+			if err != nil {
+				t.Fatalf("Scope: %v", err)
+			}
+			children, err = other.Children()
+			check(t, "Children of other", nil, scopeNames(children), err)
+
+			if v := all[1].ValueAtP(&TimestampZero); v.Error() != nil || v.IsNone() || v.V() != "0" {
+				t.Errorf("want the value 0 of %v, got: %+v", all[1], v)
+			}
+			if _, err := i.Scope("//top/nope"); err == nil {
+				t.Errorf("want an error for an unknown scope")
+			}
+		})
+	}
+}
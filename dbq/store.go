@@ -0,0 +1,66 @@
+package dbq
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/filmil/go-vcd-parser/wave"
+)
+
+// NewFromStore makes an Instance that answers queries from an in-memory
+// waveform store instead of a database. The signals have the same names as
+// in a database that cvt makes, such as `//top/clk`; the names of the store,
+// such as `/top/clk`, work too.
+func NewFromStore(s *wave.Store, opts ...Option) *Instance {
+	ret := &Instance{
+		store: s,
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// wave returns the signal in the store.
+func (self *Signal) wave() (*wave.Signal, error) {
+	s := self.i.store.Lookup(self.name)
+	if s == nil && strings.HasPrefix(self.name, "//") {
+		s = self.i.store.Lookup(self.name[1:])
+	}
+	if s == nil {
+		return nil, fmt.Errorf("dbq: unknown signal: %q", self.name)
+	}
+	return s, nil
+}
+
+// storeTimestamp looks up a timestamp with fn in the store.
+func (self *Signal) storeTimestamp(val string, fn func(s *wave.Signal) (uint64, string, bool)) *Timestamp {
+	ret := &Timestamp{
+		name:  self.name,
+		val:   val,
+		scale: self.i.timescale(),
+	}
+	s, err := self.wave()
+	if err != nil {
+		ret.err = err
+		return ret
+	}
+	if ts, v, ok := fn(s); ok {
+		ret.ts, ret.val = &ts, v
+	}
+	return ret
+}
+
+// storeValue looks up a value with fn in the store.
+func (self *Signal) storeValue(fn func(s *wave.Signal) (string, bool)) *Value {
+	var ret Value
+	s, err := self.wave()
+	if err != nil {
+		ret.err = err
+		return &ret
+	}
+	if v, ok := fn(s); ok {
+		ret.val, ret.name = &v, s.Name(v)
+	}
+	return &ret
+}
@@ -0,0 +1,257 @@
+package dbq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filmil/go-vcd-parser/cvt"
+	"github.com/filmil/go-vcd-parser/db"
+	"github.com/filmil/go-vcd-parser/dbt"
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/filmil/go-vcd-parser/wave"
+)
+
+const storeTestVCD = `
+$attrbegin misc 07 state_t 3 IDLE RUN WAIT 00 01 10 1 $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 4 " data $end
+$attrbegin misc 07 1 $end
+$var logic 2 # state $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars 0! b0 " b0 # $end
+#10
+1!
+#15
+b1010 "
+b1 #
+#20
+0!
+#30
+1!
+b10 #
+#40
+0!
+b1111 "
+#50
+1!
+b0 #
+`
+
+// TestStoreParity checks that the store answers the queries as the database
+// does.
+func TestStoreParity(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx, err := db.OpenDB(ctx, dbt.NewMemDB())
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	if err := cvt.ConvertReader(ctx, vcd.NewReader(strings.NewReader(storeTestVCD)), dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	s, err := wave.Load(vcd.NewReader(strings.NewReader(storeTestVCD)))
+	if err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+	fromDB, fromStore := New(dbx), NewFromStore(s)
+
+	signals := map[string][]string{
+		"//top/clk":   {"0", "1"},
+		"//top/data":  {"0", "1010", "1111"},
+		"//top/state": {"0", "1", "10"},
+	}
+	for name, values := range signals {
+		d, st := fromDB.Signal(name), fromStore.Signal(name)
+		for ts := uint64(0); ts <= 60; ts += 5 {
+			at := &Timestamp{ts: ptr(ts)}
+			for _, v := range values {
+				q := fmt.Sprintf("%v at %v, %q", name, ts, v)
+				checkTimestamp(t, "FindBefore: "+q, d.FindBefore(at, v), st.FindBefore(at, v))
+				checkTimestamp(t, "FindAfter: "+q, d.FindAfter(at, v), st.FindAfter(at, v))
+			}
+			q := fmt.Sprintf("%v at %v", name, ts)
+			checkValue(t, "ValueAt: "+q, d.ValueAt(at), st.ValueAt(at))
+			checkValue(t, "ValueAtP: "+q, d.ValueAtP(at), st.ValueAtP(at))
+			checkTimestamp(t, "PrevChange: "+q, d.PrevChange(at), st.PrevChange(at))
+			checkTimestamp(t, "NextChange: "+q, d.NextChange(at), st.NextChange(at))
+		}
+		for _, v := range values {
+			checkTimestamp(t, fmt.Sprintf("FindFirst: %v, %q", name, v), d.FindFirst(v), st.FindFirst(v))
+		}
+	}
+
+	if v := fromStore.Signal("/top/state").ValueAtP(&Timestamp{ts: ptr[uint64](30)}); v.Name() != "WAIT" {
+		t.Errorf("want the name WAIT, got: %+v", v)
+	}
+	if ts := fromStore.Signal("//top/nope").FindFirst("1"); ts.Error() == nil {
+		t.Errorf("want an error for an unknown signal")
+	}
+}
+
+const fourStateTestVCD = `
+$scope module top $end
+$var logic 1 ! rst $end
+$var logic 4 " data $end
+$var string 1 # mode $end
+$upscope $end
+$enddefinitions $end
+#0
+U! bUUUU "
+sidle #
+#10
+H! b01LH "
+sh #
+#20
+L! b-W10 "
+`
+
+// TestFourState checks the comparisons of nine-state values, from both the
+// database and the store.
+func TestFourState(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx, err := db.OpenDB(ctx, dbt.NewMemDB())
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	if err := cvt.ConvertReader(ctx, vcd.NewReader(strings.NewReader(fourStateTestVCD)), dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	s, err := wave.Load(vcd.NewReader(strings.NewReader(fourStateTestVCD)))
+	if err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+	tests := []struct {
+		name, value string
+		expected    uint64
+	}{
+		{"//top/rst", "x", 0},
+		{"//top/rst", "1", 10},
+		{"//top/rst", "h", 10},
+		{"//top/rst", "0", 20},
+		{"//top/data", "0101", 10},
+		{"//top/data", "xx10", 20},
+		{"//top/data", "-w10", 20},
+		// Strings are not bits, even the one-letter ones.
+		{"//top/mode", "h", 10},
+	}
+	for _, q := range []*Instance{New(dbx, WithFourState()), NewFromStore(s, WithFourState())} {
+		for _, test := range tests {
+			ts := q.Signal(test.name).FindFirst(test.value)
+			if ts.Error() != nil || ts.IsNone() || !ts.Eq(test.expected) {
+				t.Errorf("FindFirst(%v, %q): want: %v, got: %+v", test.name, test.value, test.expected, ts)
+			}
+		}
+		at := &Timestamp{ts: ptr[uint64](15)}
+		if ts := q.Signal("//top/rst").FindBefore(at, "1"); ts.IsNone() || !ts.Eq(10) {
+			t.Errorf("FindBefore: want: 10, got: %+v", ts)
+		}
+		if ts := q.Signal("//top/rst").FindAfter(at, "0"); ts.IsNone() || !ts.Eq(20) {
+			t.Errorf("FindAfter: want: 20, got: %+v", ts)
+		}
+		if q.Signal("//top/data").EqAt(at, "0101") == nil {
+			t.Errorf("EqAt: want 0101 at 15")
+		}
+		if v := q.Signal("//top/data").ValueAt(at); v.IsNone() || v.V() != "01LH" {
+			t.Errorf("ValueAt: want the value as dumped, got: %+v", v)
+		}
+		if ts := q.Signal("//top/mode").FindFirst("1"); !ts.IsNone() {
+			t.Errorf("FindFirst: want no 1 in a string, got: %+v", ts)
+		}
+		if q.Signal("//top/mode").EqAt(at, "1") != nil || q.Signal("//top/mode").EqAt(at, "h") == nil {
+			t.Errorf("EqAt: want the string h at 15, and not 1")
+		}
+	}
+	// Without the option, the values compare as they are.
+	if ts := NewFromStore(s).Signal("//top/rst").FindFirst("1"); !ts.IsNone() {
+		t.Errorf("want no 1 without WithFourState, got: %+v", ts)
+	}
+}
+
+const timescaleTestVCD = `
+$timescale 10 ns $end
+$scope module top $end
+$var wire 1 ! clk $end
+$upscope $end
+$enddefinitions $end
+#0
+0!
+#5
+1!
+#10
+0!
+#15
+1!
+`
+
+// TestTimescale checks that the durations are in the timescale of the file,
+// from both the database and the store.
+func TestTimescale(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dbx, err := db.OpenDB(ctx, dbt.NewMemDB())
+	if err != nil {
+		t.Fatalf("could not open DB: %v", err)
+	}
+	if err := cvt.ConvertReader(ctx, vcd.NewReader(strings.NewReader(timescaleTestVCD)), dbx); err != nil {
+		t.Fatalf("could not convert: %v", err)
+	}
+	s, err := wave.Load(vcd.NewReader(strings.NewReader(timescaleTestVCD)))
+	if err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+	for _, q := range []*Instance{New(dbx), NewFromStore(s)} {
+		if ts := q.Timescale(); ts.String() != "10 ns" {
+			t.Errorf("Timescale: want: 10 ns, got: %v", ts)
+		}
+		clk := q.Signal("//top/clk")
+		ts := clk.FindFirst("1")
+		if ts.IsNone() || ts.D() != 50*time.Nanosecond {
+			t.Errorf("D: want: 50ns, got: %+v", ts)
+		}
+		if d := Diff(ts, clk.NextChange(ts)); d != 50*time.Nanosecond {
+			t.Errorf("Diff: want: 50ns, got: %v", d)
+		}
+		// A period of 100 ns.
+		if err := IsClock(&TimestampZero, clk, 10e6); err != nil {
+			t.Errorf("IsClock: %v", err)
+		}
+	}
+}
+
+// checkTimestamp compares timestamps. The database can not tell "not found"
+// apart from errors, so only what it finds is compared.
+func checkTimestamp(t *testing.T, q string, expected, actual *Timestamp) {
+	t.Helper()
+	if actual.Error() != nil {
+		t.Errorf("%v: error: %v", q, actual.Error())
+		return
+	}
+	if expected.Error() != nil || expected.IsNone() {
+		return
+	}
+	if actual.IsNone() || actual.T() != expected.T() || actual.ValueAt() != expected.ValueAt() {
+		t.Errorf("%v:\nwant: %v %q\ngot:  %v %q", q, expected, expected.ValueAt(), actual, actual.ValueAt())
+	}
+}
+
+func checkValue(t *testing.T, q string, expected, actual *Value) {
+	t.Helper()
+	if expected.Error() != nil || actual.Error() != nil {
+		t.Errorf("%v: errors: %v, %v", q, expected.Error(), actual.Error())
+		return
+	}
+	if expected.IsNone() != actual.IsNone() {
+		t.Errorf("%v: want none: %v, got none: %v", q, expected.IsNone(), actual.IsNone())
+		return
+	}
+	if !expected.IsNone() && (expected.V() != actual.V() || expected.Name() != actual.Name()) {
+		t.Errorf("%v:\nwant: %q %q\ngot:  %q %q", q, expected.V(), expected.Name(), actual.V(), actual.Name())
+	}
+}
@@ -26,6 +26,15 @@ func NewMemDB() string {
 	{
 		m.Lock()
 		counter++
+		if testdir == "" {
+			// Not running under bazel, use a fresh directory so that
+			// databases from previous runs do not get in the way.
+			dir, err := os.MkdirTemp("", "dbt")
+			if err != nil {
+				panic(fmt.Sprintf("could not create temp dir: %v", err))
+			}
+			testdir = dir
+		}
 		m.Unlock()
 	}
 	return fmt.Sprintf("%s/test.%d.db", testdir, counter)
@@ -102,6 +111,31 @@ func (self *Instance) Signal(name string, kind vcd.VarKindCode, size int) *Signa
 	}
 }
 
+// EnumName is the name of a value of an enum signal.
+type EnumName struct {
+	Value string
+	Name  string
+}
+
+// EnumNames records the names of the values of the signal.
+func (self *Signal) EnumNames(names ...EnumName) *Signal {
+	tx, err := self.parent.db.Begin()
+	if err != nil {
+		panic(fmt.Sprintf("could not start transaction: %v", err))
+	}
+	defer func() {
+		if err := tx.Commit(); err != nil {
+			glog.Warningf("could not commit enum names: %v", err)
+		}
+	}()
+	for _, n := range names {
+		if err := db.AddEnumValue(self.ctx, tx, self.code, n.Value, n.Name); err != nil {
+			panic(fmt.Sprintf("could not add enum name: %v", err))
+		}
+	}
+	return self
+}
+
 // TimeValues records the given time value pairs as a signal.
 //
 // Returns the parent `Instance` so that multiple signals could be added.
@@ -0,0 +1,256 @@
+package fst
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// errCorrupt is returned for data that can not be decoded.
+var errCorrupt = errors.New("corrupt data")
+
+// cursor reads the fields of a section one by one. The first failure is
+// kept in err, and all reads after it return zero values.
+type cursor struct {
+	b   []byte
+	err error
+}
+
+func (self *cursor) fail() {
+	if self.err == nil {
+		self.err = errCorrupt
+	}
+	self.b = nil
+}
+
+func (self *cursor) bytes(n int) []byte {
+	if n < 0 || n > len(self.b) {
+		self.fail()
+		return nil
+	}
+	ret := self.b[:n]
+	self.b = self.b[n:]
+	return ret
+}
+
+func (self *cursor) byte() byte {
+	if b := self.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uint64 reads a big-endian uint64, as in the fixed fields of the blocks.
+func (self *cursor) uint64() uint64 {
+	if b := self.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// varint reads an unsigned LEB128 number.
+func (self *cursor) varint() uint64 {
+	ret, n := binary.Uvarint(self.b)
+	if n <= 0 {
+		self.fail()
+		return 0
+	}
+	self.b = self.b[n:]
+	return ret
+}
+
+// svarint reads a signed LEB128 number. Unlike binary.Varint, it is not
+// zig-zag encoded.
+func (self *cursor) svarint() int64 {
+	var ret int64
+	var shift uint
+	for {
+		b := self.byte()
+		if self.err != nil {
+			return 0
+		}
+		ret |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				ret |= -1 << shift
+			}
+			return ret
+		}
+		if shift >= 64 {
+			self.fail()
+			return 0
+		}
+	}
+}
+
+// cstring reads a string that ends with a zero byte.
+func (self *cursor) cstring() string {
+	i := bytes.IndexByte(self.b, 0)
+	if i < 0 {
+		self.fail()
+		return ""
+	}
+	ret := string(self.b[:i])
+	self.b = self.b[i+1:]
+	return ret
+}
+
+// float64 reads a double in the byte order of the writer.
+func (self *cursor) float64(order binary.ByteOrder) float64 {
+	if b := self.bytes(8); b != nil {
+		return math.Float64frombits(order.Uint64(b))
+	}
+	return 0
+}
+
+// unzlib decompresses zlib data that is n bytes long uncompressed.
+func unzlib(data []byte, n uint64) ([]byte, error) {
+	z, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("zlib: %w", err)
+	}
+	return readFull(z, n, "zlib")
+}
+
+// gunzip decompresses gzip data that is n bytes long uncompressed.
+func gunzip(data []byte, n uint64) ([]byte, error) {
+	z, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	return readFull(z, n, "gzip")
+}
+
+func readFull(r io.Reader, n uint64, format string) ([]byte, error) {
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("%v: too long: %v", format, n)
+	}
+	ret := make([]byte, n)
+	if _, err := io.ReadFull(r, ret); err != nil {
+		return nil, fmt.Errorf("%v: %w", format, err)
+	}
+	return ret, nil
+}
+
+// unlz4 decompresses an LZ4 block that is n bytes long uncompressed.
+func unlz4(src []byte, n uint64) ([]byte, error) {
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("lz4: too long: %v", n)
+	}
+	dst := make([]byte, 0, n)
+	c := cursor{b: src}
+	for len(c.b) > 0 {
+		token := c.byte()
+		lits := c.length(int(token >> 4))
+		dst = append(dst, c.bytes(lits)...)
+		if len(c.b) == 0 || c.err != nil {
+			// The last sequence has only literals.
+			break
+		}
+		offset := int(c.byte()) | int(c.byte())<<8
+		match := c.length(int(token&0xf)) + 4
+		if offset == 0 || offset > len(dst) || c.err != nil {
+			return nil, fmt.Errorf("lz4: %w", errCorrupt)
+		}
+		dst = appendMatch(dst, offset, match)
+	}
+	if c.err != nil || uint64(len(dst)) != n {
+		return nil, fmt.Errorf("lz4: %w", errCorrupt)
+	}
+	return dst, nil
+}
+
+// length reads the rest of an LZ4 length that starts with the 4 bits n.
+func (self *cursor) length(n int) int {
+	if n < 15 {
+		return n
+	}
+	for {
+		b := self.byte()
+		n += int(b)
+		if b != 255 || self.err != nil {
+			return n
+		}
+	}
+}
+
+// appendMatch appends n bytes, copied from offset bytes back. The copy may
+// overlap what it appends.
+func appendMatch(dst []byte, offset, n int) []byte {
+	from := len(dst) - offset
+	for i := 0; i < n; i++ {
+		dst = append(dst, dst[from+i])
+	}
+	return dst
+}
+
+// unfastlz decompresses FastLZ data of level 1 or 2, that is n bytes long
+// uncompressed.
+func unfastlz(src []byte, n uint64) ([]byte, error) {
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("fastlz: too long: %v", n)
+	}
+	if len(src) == 0 {
+		return nil, fmt.Errorf("fastlz: %w", errCorrupt)
+	}
+	level := src[0]>>5 + 1
+	if level > 2 {
+		return nil, fmt.Errorf("fastlz: unknown level: %v", level)
+	}
+	dst := make([]byte, 0, n)
+	c := cursor{b: src[1:]}
+	ctrl := int(src[0] & 31)
+	for {
+		if ctrl < 32 {
+			// ctrl+1 literals.
+			dst = append(dst, c.bytes(ctrl+1)...)
+		} else {
+			length := ctrl>>5 - 1
+			offset := (ctrl & 31) << 8
+			if level == 1 {
+				if length == 6 {
+					length += int(c.byte())
+				}
+				offset += int(c.byte())
+			} else {
+				if length == 6 {
+					for {
+						b := c.byte()
+						length += int(b)
+						if b != 255 || c.err != nil {
+							break
+						}
+					}
+				}
+				b := int(c.byte())
+				offset += b
+				if b == 255 && offset == 31<<8+255 {
+					// A far match, with a 16-bit distance.
+					offset = int(c.byte())<<8 + int(c.byte()) + 8191
+				}
+			}
+			offset++
+			if offset > len(dst) || c.err != nil {
+				return nil, fmt.Errorf("fastlz: %w", errCorrupt)
+			}
+			dst = appendMatch(dst, offset, length+3)
+		}
+		if c.err != nil {
+			return nil, fmt.Errorf("fastlz: %w", errCorrupt)
+		}
+		if len(c.b) == 0 {
+			break
+		}
+		ctrl = int(c.byte())
+	}
+	if uint64(len(dst)) != n {
+		return nil, fmt.Errorf("fastlz: %w", errCorrupt)
+	}
+	return dst, nil
+}
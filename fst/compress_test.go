@@ -0,0 +1,56 @@
+package fst
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	t.Parallel()
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name     string
+		fn       func([]byte, uint64) ([]byte, error)
+		input    []byte
+		expected string
+	}{
+		{"lz4 match", unlz4, []byte("\x35abc\x03\x00"), "abcabcabcabc"},
+		{"lz4 long match", unlz4, []byte("\x1fa\x01\x00\xff\x19"), long},
+		{"lz4 literals", unlz4, lz4Literals([]byte(long)), long},
+		{"fastlz 1 match", unfastlz, []byte("\x02abc\xe0\x00\x02\x60\x02"), "abcabcabcabcabcab"},
+		{"fastlz 2 match", unfastlz, []byte("\x22abc\xe0\x00\x02"), "abcabcabcabc"},
+		{"fastlz literals", unfastlz, fastlzLiterals([]byte(long)), long},
+	}
+	for _, test := range tests {
+		actual, err := test.fn(test.input, uint64(len(test.expected)))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if string(actual) != test.expected {
+			t.Errorf("%v: want: %q, got: %q", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		fn    func([]byte, uint64) ([]byte, error)
+		input []byte
+		n     uint64
+	}{
+		{"lz4 offset", unlz4, []byte("\x35abc\x04\x00"), 12},
+		{"lz4 length", unlz4, []byte("\x30abc"), 4},
+		{"lz4 short", unlz4, []byte("\xf0\xff"), 400},
+		{"fastlz offset", unfastlz, []byte("\x02abc\xe0\x00\x03"), 12},
+		{"fastlz level", unfastlz, []byte("\x42abc"), 3},
+		{"fastlz short", unfastlz, []byte("\x05abc"), 6},
+	}
+	for _, test := range tests {
+		if _, err := test.fn(test.input, test.n); err == nil {
+			t.Errorf("%v: want an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package fst reads GTKWave's FST (Fast Signal Trace) waveform files. FST
+// files are much smaller than VCD files with the same contents, and are what
+// Verilator, Icarus and GHDL write when asked to keep the size down.
+//
+// The contents of an FST file come out as a vcd.Reader, with the same
+// declarations and simulation commands as the VCD file that GTKWave's fst2vcd
+// would make of it. So everything that reads VCD files, such as cvt, reads
+// FST files as well.
+package fst
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// The block types.
+const (
+	blockHeader        = 0
+	blockValues        = 1
+	blockBlackout      = 2
+	blockGeometry      = 3
+	blockHierarchy     = 4
+	blockValuesAlias   = 5
+	blockHierarchyLZ4  = 6
+	blockHierarchyLZ42 = 7 // Compressed with LZ4 twice.
+	blockValuesAlias2  = 8
+	blockZWrapper      = 254 // The entire file, compressed with gzip.
+	blockSkip          = 255
+)
+
+// headerLength is the length of the header block, past its type.
+const headerLength = 329
+
+// The records of the hierarchy that are not variables. The variables have
+// their type as the tag, see varKinds.
+const (
+	tagAttrbegin = 252
+	tagAttrend   = 253
+	tagScope     = 254
+	tagUpscope   = 255
+)
+
+// varKinds are the VCD kinds of the FST variable types.
+var varKinds = [...]vcd.VarKindCode{
+	vcd.VarKindEvent,
+	vcd.VarKindInteger,
+	vcd.VarKindParameter,
+	vcd.VarKindReal,
+	vcd.VarKindRealParameter,
+	vcd.VarKindReg,
+	vcd.VarKindSupply0,
+	vcd.VarKindSupply1,
+	vcd.VarKindTime,
+	vcd.VarKindTri,
+	vcd.VarKindTriand,
+	vcd.VarKindTrior,
+	vcd.VarKindTrireg,
+	vcd.VarKindTri0,
+	vcd.VarKindTri1,
+	vcd.VarKindWand,
+	vcd.VarKindWire,
+	vcd.VarKindWor,
+	// Ports have plain values in FST files, not those of extended VCD.
+	vcd.VarKindWire,
+	vcd.VarKindSparray,
+	vcd.VarKindRealtime,
+	vcd.VarKindString,
+	vcd.VarKindBit,
+	vcd.VarKindLogic,
+	vcd.VarKindInt,
+	vcd.VarKindShortint,
+	vcd.VarKindLongint,
+	vcd.VarKindByte,
+	vcd.VarKindEnum,
+	vcd.VarKindShortreal,
+}
+
+// typePort is the FST type of extended VCD ports.
+const typePort = 18
+
+// scopeKinds are the VCD kinds of the FST scope types.
+var scopeKinds = [...]vcd.ScopeKindCode{
+	vcd.ScopeKindModule,
+	vcd.ScopeKindTask,
+	vcd.ScopeKindFunction,
+	vcd.ScopeKindBegin,
+	vcd.ScopeKindFork,
+	vcd.ScopeKindGenerate,
+	vcd.ScopeKindStruct,
+	vcd.ScopeKindUnion,
+	vcd.ScopeKindClass,
+	vcd.ScopeKindInterface,
+	vcd.ScopeKindPackage,
+	vcd.ScopeKindProgram,
+	vcd.ScopeKindVHDLArchitecture,
+	vcd.ScopeKindVHDLProcedure,
+	vcd.ScopeKindVHDLFunction,
+	vcd.ScopeKindVHDLRecord,
+	vcd.ScopeKindVHDLProcess,
+	vcd.ScopeKindVHDLBlock,
+	vcd.ScopeKindVHDLForGenerate,
+	vcd.ScopeKindVHDLIfGenerate,
+	vcd.ScopeKindVHDLGenerate,
+	vcd.ScopeKindVHDLPackage,
+}
+
+// NewReader returns a Reader of the FST file r, which is size bytes long.
+// FST files keep the declarations at the end, so r must allow random
+// access. Errors in the file come out of the Reader, starting with
+// Declarations.
+func NewReader(r io.ReaderAt, size int64, opts ...vcd.ReaderOption) *vcd.Reader {
+	return vcd.NewSourceReader(&source{r: r, size: size}, opts...)
+}
+
+// Open opens the named FST file. Close the Reader when done with it.
+func Open(name string, opts ...vcd.ReaderOption) (*vcd.Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("fst.Open: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("fst.Open: %w", err)
+	}
+	opts = append([]vcd.ReaderOption{vcd.WithFilename(name)}, opts...)
+	return vcd.NewSourceReader(&source{r: f, size: st.Size(), closer: f}, opts...), nil
+}
+
+// Is reports whether r starts like an FST file.
+func Is(r io.ReaderAt) bool {
+	var b [9]byte
+	if _, err := r.ReadAt(b[:], 0); err != nil {
+		return false
+	}
+	switch b[0] {
+	case blockHeader:
+		return binary.BigEndian.Uint64(b[1:]) == headerLength
+	case blockZWrapper:
+		return true
+	}
+	return false
+}
+
+// IsFile reports whether the named file is an FST file. Any error opening
+// it makes it not one.
+func IsFile(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return Is(f)
+}
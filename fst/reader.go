@@ -0,0 +1,760 @@
+package fst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// source is the vcd.Source of an FST file.
+type source struct {
+	r      io.ReaderAt
+	size   int64
+	closer io.Closer // Closed with the Reader, may be nil.
+
+	// From the header block.
+	timescale int8
+	version   string
+	date      string
+	order     binary.ByteOrder // Of the doubles.
+	// timezero is added to the times in the file, to get those of the
+	// simulation.
+	timezero int64
+
+	blocks []block // The value change blocks, in order.
+
+	// By handle - 1, from the geometry block.
+	lengths []int // In bits. 0 for strings.
+	reals   []bool
+	// By handle - 1, from the hierarchy. The code is empty if no variable
+	// has the handle.
+	codes     []string
+	encodings []vcd.ValueEncoding
+
+	next  int // The next block to read.
+	queue []*vcd.SimulationCommandT
+	last  []*string // The last value handed out, by handle - 1.
+	time  *uint64   // The last timestamp handed out.
+}
+
+// block is the position of a block in the file. The position is that of
+// its length, right after its type.
+type block struct {
+	kind   byte
+	pos    int64
+	length int64
+}
+
+func (self *source) Close() error {
+	if self.closer == nil {
+		return nil
+	}
+	return self.closer.Close()
+}
+
+// read reads n bytes at pos.
+func (self *source) read(pos, n int64) ([]byte, error) {
+	if pos < 0 || n < 0 || pos+n > self.size {
+		return nil, fmt.Errorf("read past the end: %v bytes at %v", n, pos)
+	}
+	ret := make([]byte, n)
+	if _, err := self.r.ReadAt(ret, pos); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Header reads the blocks that describe the file, and returns the
+// declarations of the file as VCD text.
+func (self *source) Header() ([]byte, error) {
+	hier, err := self.scan()
+	if err != nil {
+		return nil, fmt.Errorf("fst: %w", err)
+	}
+	ret, err := self.hierarchy(*hier)
+	if err != nil {
+		return nil, fmt.Errorf("fst: hierarchy: %w", err)
+	}
+	return ret, nil
+}
+
+// scan finds the blocks of the file, and reads the header and the geometry.
+// Returns the hierarchy block.
+func (self *source) scan() (*block, error) {
+	var header, geometry, hier *block
+	for pos := int64(0); pos+9 <= self.size; {
+		b, err := self.read(pos, 9)
+		if err != nil {
+			return nil, err
+		}
+		bl := block{kind: b[0], pos: pos + 1, length: int64(binary.BigEndian.Uint64(b[1:]))}
+		if bl.length < 8 || bl.pos+bl.length > self.size {
+			// A block that a writer did not finish; the ones before
+			// it are still good.
+			break
+		}
+		switch bl.kind {
+		case blockZWrapper:
+			if pos != 0 {
+				return nil, fmt.Errorf("compressed file in the middle of a file")
+			}
+			if err := self.unwrap(bl); err != nil {
+				return nil, err
+			}
+			return self.scan()
+		case blockHeader:
+			header = &bl
+		case blockValues, blockValuesAlias, blockValuesAlias2:
+			self.blocks = append(self.blocks, bl)
+		case blockGeometry:
+			geometry = &bl
+		case blockHierarchy, blockHierarchyLZ4, blockHierarchyLZ42:
+			hier = &bl
+		}
+		// Blackout blocks only tell when dumping was off.
+		pos = bl.pos + bl.length
+	}
+	switch {
+	case header == nil:
+		return nil, fmt.Errorf("no header block")
+	case geometry == nil:
+		return nil, fmt.Errorf("no geometry block")
+	case hier == nil:
+		return nil, fmt.Errorf("no hierarchy block")
+	}
+	if err := self.header(*header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if err := self.geometry(*geometry); err != nil {
+		return nil, fmt.Errorf("geometry: %w", err)
+	}
+	return hier, nil
+}
+
+// unwrap replaces the input with the contents of the gzip-compressed file
+// in bl.
+func (self *source) unwrap(bl block) error {
+	b, err := self.read(bl.pos, bl.length)
+	if err != nil {
+		return err
+	}
+	c := cursor{b: b}
+	c.uint64()
+	n := c.uint64()
+	if c.err != nil {
+		return c.err
+	}
+	data, err := gunzip(c.b, n)
+	if err != nil {
+		return err
+	}
+	self.r, self.size = bytes.NewReader(data), int64(len(data))
+	return nil
+}
+
+func (self *source) header(bl block) error {
+	b, err := self.read(bl.pos, bl.length)
+	if err != nil {
+		return err
+	}
+	c := cursor{b: b}
+	c.uint64()
+	c.uint64() // The start and end times.
+	c.uint64()
+	endian := c.bytes(8)
+	c.uint64() // The memory that the writer used.
+	c.uint64() // The numbers of scopes, variables, handles and blocks.
+	c.uint64()
+	c.uint64()
+	c.uint64()
+	self.timescale = int8(c.byte())
+	self.version = cstring(c.bytes(128))
+	self.date = cstring(c.bytes(119))
+	c.byte() // The type of the file, such as Verilog or VHDL.
+	self.timezero = int64(c.uint64())
+	if c.err != nil {
+		return c.err
+	}
+	switch e := math.E; {
+	case math.Float64frombits(binary.LittleEndian.Uint64(endian)) == e:
+		self.order = binary.LittleEndian
+	case math.Float64frombits(binary.BigEndian.Uint64(endian)) == e:
+		self.order = binary.BigEndian
+	default:
+		return fmt.Errorf("unknown byte order of doubles: % x", endian)
+	}
+	return nil
+}
+
+// cstring returns the text of a fixed-size field, up to the first zero
+// byte.
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (self *source) geometry(bl block) error {
+	b, err := self.read(bl.pos, bl.length)
+	if err != nil {
+		return err
+	}
+	c := cursor{b: b}
+	c.uint64()
+	n := c.uint64()
+	count := c.uint64()
+	if c.err != nil {
+		return c.err
+	}
+	data := c.b
+	if uint64(len(data)) != n {
+		if data, err = unzlib(data, n); err != nil {
+			return err
+		}
+	}
+	c = cursor{b: data}
+	for i := uint64(0); i < count && c.err == nil; i++ {
+		switch l := c.varint(); l {
+		case 0:
+			self.lengths = append(self.lengths, 8)
+			self.reals = append(self.reals, true)
+		case 0xffffffff:
+			self.lengths = append(self.lengths, 0)
+			self.reals = append(self.reals, false)
+		default:
+			self.lengths = append(self.lengths, int(l))
+			self.reals = append(self.reals, false)
+		}
+	}
+	return c.err
+}
+
+// records reads the hierarchy block, and returns its records
+// uncompressed.
+func (self *source) records(bl block) ([]byte, error) {
+	b, err := self.read(bl.pos, bl.length)
+	if err != nil {
+		return nil, err
+	}
+	c := cursor{b: b}
+	c.uint64()
+	n := c.uint64()
+	var data []byte
+	switch bl.kind {
+	case blockHierarchy:
+		data = c.b
+		if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+			data, err = gunzip(data, n)
+		}
+	case blockHierarchyLZ4:
+		data, err = unlz4(c.b, n)
+	case blockHierarchyLZ42:
+		m := c.varint()
+		if data, err = unlz4(c.b, m); err == nil {
+			data, err = unlz4(data, n)
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// hierarchy reads the hierarchy block, and writes out the declarations.
+func (self *source) hierarchy(bl block) ([]byte, error) {
+	data, err := self.records(bl)
+	if err != nil {
+		return nil, err
+	}
+	var ret bytes.Buffer
+	w := vcd.NewWriter(&ret)
+	if self.date != "" {
+		w.Date(self.date)
+	}
+	if self.version != "" {
+		w.Version(self.version)
+	}
+	number, unit, err := timescale(self.timescale)
+	if err != nil {
+		return nil, err
+	}
+	w.Timescale(number, unit)
+	self.codes = make([]string, len(self.lengths))
+	self.encodings = make([]vcd.ValueEncoding, len(self.lengths))
+	handle := 0
+	c := cursor{b: data}
+	for len(c.b) > 0 && c.err == nil {
+		switch tag := c.byte(); tag {
+		case tagScope:
+			kind := c.byte()
+			name := c.cstring()
+			c.cstring() // The component.
+			if int(kind) >= len(scopeKinds) {
+				return nil, fmt.Errorf("unknown scope type: %v: %q", kind, name)
+			}
+			w.DeclareScope(scopeKinds[kind], name)
+		case tagUpscope:
+			w.Upscope()
+		case tagAttrbegin:
+			kind := c.byte()
+			subtype := c.byte()
+			name := c.cstring()
+			arg := c.varint()
+			w.Attr(vcd.AttrKindCode(kind), int(subtype), name, int64(arg))
+		case tagAttrend:
+			w.Attrend()
+		default:
+			if int(tag) >= len(varKinds) {
+				return nil, fmt.Errorf("unknown variable type: %v", tag)
+			}
+			c.byte() // The direction.
+			name := c.cstring()
+			length := c.varint()
+			alias := c.varint()
+			if c.err != nil {
+				break
+			}
+			kind := varKinds[tag]
+			size := max(1, int(length))
+			if alias == 0 {
+				handle++
+				if handle > len(self.codes) {
+					return nil, fmt.Errorf("more handles than in the geometry: %v", handle)
+				}
+				code, _ := w.DeclareVar(kind, size, name)
+				self.codes[handle-1] = code
+				self.encodings[handle-1] = kind.Encoding()
+				if self.reals[handle-1] {
+					self.encodings[handle-1] = vcd.EncodingReal
+				}
+				break
+			}
+			if alias > uint64(handle) {
+				return nil, fmt.Errorf("alias of an unknown handle: %v: %q", alias, name)
+			}
+			w.DeclareAlias(kind, size, name, self.codes[alias-1])
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	w.EndDefinitions()
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	self.last = make([]*string, len(self.codes))
+	return ret.Bytes(), nil
+}
+
+// timescale returns the VCD timescale of the exponent exp, such as 100 ps
+// for -10.
+func timescale(exp int8) (int64, string, error) {
+	units := []struct {
+		exp  int
+		name string
+	}{{0, "s"}, {-3, "ms"}, {-6, "us"}, {-9, "ns"}, {-12, "ps"}, {-15, "fs"}}
+	for _, u := range units {
+		if int(exp) >= u.exp {
+			number := int64(1)
+			for i := u.exp; i < int(exp); i++ {
+				number *= 10
+			}
+			return number, u.name, nil
+		}
+	}
+	return 0, "", fmt.Errorf("timescale too fine: 1e%v s", exp)
+}
+
+// Next returns the next simulation command. The value changes are read one
+// block at a time.
+func (self *source) Next() (*vcd.SimulationCommandT, error) {
+	for len(self.queue) == 0 {
+		if self.next == len(self.blocks) {
+			return nil, io.EOF
+		}
+		bl := self.blocks[self.next]
+		if err := self.values(bl); err != nil {
+			return nil, fmt.Errorf("fst: value change block at %v: %w", bl.pos-1, err)
+		}
+		self.next++
+	}
+	ret := self.queue[0]
+	self.queue[0] = nil
+	self.queue = self.queue[1:]
+	return ret, nil
+}
+
+// values reads a block of value changes into the queue.
+//
+// A block has the values of all signals at its start, the value changes of
+// each signal, an index of where those of each signal are, and a table of
+// the times of the changes. The changes refer to the times by their index
+// in the table.
+func (self *source) values(bl block) error {
+	b, err := self.read(bl.pos, bl.length)
+	if err != nil {
+		return err
+	}
+	c := cursor{b: b}
+	c.uint64()
+	start := c.uint64()
+	c.uint64() // The end time, and the memory needed to read the block.
+	c.uint64()
+
+	// The values at the start.
+	frameLen := c.varint()
+	frameCLen := c.varint()
+	frameCount := c.varint()
+	frame := c.bytes(int(frameCLen))
+	if c.err == nil && frameCLen != frameLen {
+		if frame, err = unzlib(frame, frameLen); err != nil {
+			return fmt.Errorf("values at the start: %w", err)
+		}
+	}
+	count := c.varint()
+	if c.err != nil {
+		return c.err
+	}
+	// The index is relative to the packing type.
+	vcStart := len(b) - len(c.b)
+	pack := c.byte()
+
+	// The time table is at the end.
+	if len(b)-vcStart < 24+8 {
+		return errCorrupt
+	}
+	t := cursor{b: b[len(b)-24:]}
+	timesLen := t.uint64()
+	timesCLen := t.uint64()
+	timesCount := t.uint64()
+	timesEnd := int64(len(b) - 24)
+	timesStart := timesEnd - int64(timesCLen)
+	if timesCLen > uint64(len(b)) || timesStart < int64(vcStart)+8 {
+		return errCorrupt
+	}
+	data := b[timesStart:timesEnd]
+	if timesCLen != timesLen {
+		if data, err = unzlib(data, timesLen); err != nil {
+			return fmt.Errorf("time table: %w", err)
+		}
+	}
+	t = cursor{b: data}
+	var times []uint64
+	for i, tt := uint64(0), uint64(0); i < timesCount && t.err == nil; i++ {
+		tt += t.varint()
+		times = append(times, tt)
+	}
+	if t.err != nil {
+		return fmt.Errorf("time table: %w", t.err)
+	}
+	if start, err = self.shift(start); err != nil {
+		return err
+	}
+	for i := range times {
+		if times[i], err = self.shift(times[i]); err != nil {
+			return err
+		}
+	}
+
+	// The index is right before the time table.
+	indexEnd := timesStart - 8
+	indexLen := int64(binary.BigEndian.Uint64(b[indexEnd:timesStart]))
+	indexStart := indexEnd - indexLen
+	if indexLen < 0 || indexStart <= int64(vcStart) {
+		return errCorrupt
+	}
+	offsets, lengths, err := index(b[indexStart:indexEnd], bl.kind, count, indexStart-int64(vcStart))
+	if err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+
+	// The values at the start go first, but only where they are news.
+	type startValue struct {
+		h  int
+		vc *vcd.ValueChangeT
+	}
+	var starts []startValue
+	f := cursor{b: frame}
+	for h := 0; h < int(min(frameCount, uint64(len(self.lengths)))) && f.err == nil; h++ {
+		var v string
+		switch l := self.lengths[h]; {
+		case self.reals[h]:
+			d := f.float64(self.order)
+			if math.IsNaN(d) {
+				// Never set.
+				continue
+			}
+			v = formatReal(d)
+		case l == 0:
+			continue
+		default:
+			v = string(f.bytes(l))
+		}
+		last := self.last[h]
+		if last != nil && *last == v {
+			// Most often, these are the values at the end of the
+			// block before.
+			continue
+		}
+		if last == nil && strings.Trim(v, "x") == "" {
+			// Never set, which VCD says by not giving a value.
+			continue
+		}
+		if vc := self.change(h, v); vc != nil {
+			starts = append(starts, startValue{h, vc})
+		}
+	}
+	if f.err != nil {
+		return fmt.Errorf("values at the start: %w", f.err)
+	}
+
+	// The changes of all signals, sorted by time.
+	byTime := make([][]*vcd.ValueChangeT, len(times))
+	// The signals that change right at the start, and so need no value from
+	// before.
+	changed := map[int]bool{}
+	for h, off := range offsets {
+		if off == 0 || h >= len(self.codes) {
+			continue
+		}
+		from, to := int64(vcStart)+off, int64(vcStart)+off+lengths[h]
+		if off < 0 || lengths[h] < 0 || to > indexStart {
+			return errCorrupt
+		}
+		err := self.signal(h, b[from:to], pack, func(i uint64, v string) error {
+			if i >= uint64(len(times)) {
+				return fmt.Errorf("time index out of range: %v", i)
+			}
+			if vc := self.change(h, v); vc != nil {
+				byTime[i] = append(byTime[i], vc)
+				changed[h] = changed[h] || times[i] == start
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("values of %q: %w", self.codes[h], err)
+		}
+	}
+	var changes []*vcd.ValueChangeT
+	for _, s := range starts {
+		if !changed[s.h] {
+			changes = append(changes, s.vc)
+		}
+	}
+	if len(changes) > 0 {
+		self.emitTime(start)
+		self.emit(changes)
+	}
+	for i, vcs := range byTime {
+		if len(vcs) > 0 {
+			self.emitTime(times[i])
+			self.emit(vcs)
+		}
+	}
+	return nil
+}
+
+// index reads the index of a value change block, and returns the offsets
+// and lengths of the value changes of each signal. The offset is 0 for a
+// signal without changes. end is the offset of the end of the last
+// changes.
+func index(b []byte, kind byte, count uint64, end int64) ([]int64, []int64, error) {
+	var offsets, lengths []int64
+	add := func(off, length int64) {
+		offsets = append(offsets, off)
+		lengths = append(lengths, length)
+	}
+	// prev is the index of the last signal with changes of its own. Their
+	// lengths are known once the next one starts.
+	prev, pos, alias := -1, int64(0), int64(0)
+	start := func(delta int64) {
+		pos += delta
+		if prev >= 0 {
+			lengths[prev] = pos - offsets[prev]
+		}
+		prev = len(offsets)
+		add(pos, 0)
+	}
+	c := cursor{b: b}
+	for len(c.b) > 0 && c.err == nil && uint64(len(offsets)) <= count {
+		if kind == blockValuesAlias2 {
+			if c.b[0]&1 == 0 {
+				for n := c.varint() >> 1; n > 0 && uint64(len(offsets)) <= count; n-- {
+					add(0, 0)
+				}
+				continue
+			}
+			// Aliases are negative: -1 for the first signal.
+			switch v := c.svarint() >> 1; {
+			case v > 0:
+				start(v)
+			case v < 0:
+				alias = v
+				add(0, alias)
+			default:
+				add(0, alias)
+			}
+			continue
+		}
+		switch v := c.varint(); {
+		case v == 0:
+			add(0, -int64(c.varint()))
+		case v&1 != 0:
+			start(int64(v >> 1))
+		default:
+			for n := v >> 1; n > 0 && uint64(len(offsets)) <= count; n-- {
+				add(0, 0)
+			}
+		}
+	}
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	if uint64(len(offsets)) > count {
+		return nil, nil, fmt.Errorf("more entries than signals: %v", count)
+	}
+	if prev >= 0 {
+		lengths[prev] = end - offsets[prev]
+	}
+	// Signals with the same changes as an earlier one share them.
+	for i := range offsets {
+		if offsets[i] != 0 || lengths[i] >= 0 {
+			continue
+		}
+		j := -lengths[i] - 1
+		if j >= int64(i) {
+			return nil, nil, fmt.Errorf("alias of a later signal: %v of %v", i, j)
+		}
+		offsets[i], lengths[i] = offsets[j], lengths[j]
+	}
+	return offsets, lengths, nil
+}
+
+// signal reads the value changes of the signal with the handle h+1 from b,
+// and calls fn with the time index and the value of each.
+func (self *source) signal(h int, b []byte, pack byte, fn func(i uint64, v string) error) error {
+	c := cursor{b: b}
+	n := c.varint()
+	if c.err != nil {
+		return c.err
+	}
+	data := c.b
+	if n != 0 {
+		var err error
+		switch pack {
+		case '4':
+			data, err = unlz4(data, n)
+		case 'F':
+			data, err = unfastlz(data, n)
+		default:
+			data, err = unzlib(data, n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c = cursor{b: data}
+	var i uint64
+	l := self.lengths[h]
+	for len(c.b) > 0 {
+		var v string
+		vli := c.varint()
+		switch {
+		case self.reals[h]:
+			i += vli >> 1
+			v = formatReal(c.float64(self.order))
+		case l == 0:
+			i += vli >> 1
+			v = string(c.bytes(int(c.varint())))
+		case l == 1:
+			if vli&1 != 0 {
+				i += vli >> 4
+				v = string("xzhuwl-?"[vli>>1&7])
+			} else {
+				i += vli >> 2
+				v = string('0' + byte(vli>>1&1))
+			}
+		case vli&1 == 0:
+			// Only 0s and 1s, packed into bits.
+			i += vli >> 1
+			v = unpack(c.bytes((l+7)/8), l)
+		default:
+			i += vli >> 1
+			v = string(c.bytes(l))
+		}
+		if c.err != nil {
+			return c.err
+		}
+		if err := fn(i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpack returns the n bits in b as 0s and 1s, the first bit in the top bit
+// of the first byte.
+func unpack(b []byte, n int) string {
+	if len(b) < (n+7)/8 {
+		return ""
+	}
+	ret := make([]byte, n)
+	for i := range ret {
+		ret[i] = '0' + b[i/8]>>(7-i%8)&1
+	}
+	return string(ret)
+}
+
+func formatReal(d float64) string {
+	return strconv.FormatFloat(d, 'g', -1, 64)
+}
+
+// change returns the value change of the signal with the handle h+1 to v,
+// or nil if the signal has no variable.
+func (self *source) change(h int, v string) *vcd.ValueChangeT {
+	code := self.codes[h]
+	if code == "" {
+		return nil
+	}
+	self.last[h] = &v
+	return vcd.NewValueChange(code, v, self.encodings[h])
+}
+
+// shift returns the time t of the file as a time of the simulation, which
+// is off by the time zero of the header. VCD has no times before zero.
+func (self *source) shift(t uint64) (uint64, error) {
+	z := self.timezero
+	switch {
+	case z < 0 && t < uint64(-z):
+		return 0, fmt.Errorf("time %v is before zero, with time zero %v", t, z)
+	case z > 0 && t > math.MaxUint64-uint64(z):
+		return 0, fmt.Errorf("time %v is too large, with time zero %v", t, z)
+	}
+	return t + uint64(z), nil
+}
+
+func (self *source) emitTime(t uint64) {
+	if self.time != nil && *self.time == t {
+		return
+	}
+	self.time = &t
+	self.queue = append(self.queue, &vcd.SimulationCommandT{
+		SimulationTime: &vcd.SimulationTimeT{DecimalNumber: "#" + strconv.FormatUint(t, 10)},
+	})
+}
+
+func (self *source) emit(vcs []*vcd.ValueChangeT) {
+	for _, vc := range vcs {
+		self.queue = append(self.queue, &vcd.SimulationCommandT{ValueChange: vc})
+	}
+}
@@ -0,0 +1,528 @@
+package fst
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// The encoding of FST files, as far as the tests need it. Compression with
+// LZ4 and FastLZ only makes literals, which the decompressors have to read
+// all the same.
+
+func putUint64(b *bytes.Buffer, v uint64) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func putVarint(b *bytes.Buffer, v uint64) {
+	b.Write(binary.AppendUvarint(nil, v))
+}
+
+func putSvarint(b *bytes.Buffer, v int64) {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			b.WriteByte(c)
+			return
+		}
+		b.WriteByte(c | 0x80)
+	}
+}
+
+func section(kind byte, body []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(kind)
+	putUint64(&b, uint64(len(body)+8))
+	b.Write(body)
+	return b.Bytes()
+}
+
+func zlibBytes(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func gzipBytes(data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func lz4Literals(data []byte) []byte {
+	var b bytes.Buffer
+	n := len(data)
+	b.WriteByte(byte(min(n, 15) << 4))
+	if n >= 15 {
+		for n -= 15; n >= 255; n -= 255 {
+			b.WriteByte(255)
+		}
+		b.WriteByte(byte(n))
+	}
+	b.Write(data)
+	return b.Bytes()
+}
+
+func fastlzLiterals(data []byte) []byte {
+	var b bytes.Buffer
+	for len(data) > 0 {
+		n := min(len(data), 32)
+		b.WriteByte(byte(n - 1))
+		b.Write(data[:n])
+		data = data[n:]
+	}
+	return b.Bytes()
+}
+
+func headerBlock(timescale int8, version, date string, timezero int64) []byte {
+	var b bytes.Buffer
+	for range 2 {
+		putUint64(&b, 0)
+	}
+	binary.Write(&b, binary.LittleEndian, math.E)
+	for range 5 {
+		putUint64(&b, 0)
+	}
+	b.WriteByte(byte(timescale))
+	b.Write(append([]byte(version), make([]byte, 128-len(version))...))
+	b.Write(append([]byte(date), make([]byte, 119-len(date))...))
+	b.WriteByte(0)
+	putUint64(&b, uint64(timezero))
+	return section(blockHeader, b.Bytes())
+}
+
+// geometryBlock takes the lengths of the signals: 0 for reals, and
+// 0xffffffff for strings.
+func geometryBlock(lengths ...uint64) []byte {
+	var data, b bytes.Buffer
+	for _, l := range lengths {
+		putVarint(&data, l)
+	}
+	putUint64(&b, uint64(data.Len()))
+	putUint64(&b, uint64(len(lengths)))
+	b.Write(zlibBytes(data.Bytes()))
+	return section(blockGeometry, b.Bytes())
+}
+
+// hier builds the records of a hierarchy.
+type hier struct {
+	bytes.Buffer
+}
+
+func (self *hier) scope(kind byte, name string) *hier {
+	self.WriteByte(tagScope)
+	self.WriteByte(kind)
+	self.WriteString(name + "\x00\x00")
+	return self
+}
+
+func (self *hier) upscope() *hier {
+	self.WriteByte(tagUpscope)
+	return self
+}
+
+func (self *hier) attr(kind, subtype byte, name string, arg uint64) *hier {
+	self.WriteByte(tagAttrbegin)
+	self.WriteByte(kind)
+	self.WriteByte(subtype)
+	self.WriteString(name + "\x00")
+	putVarint(&self.Buffer, arg)
+	return self
+}
+
+func (self *hier) variable(kind byte, name string, length, alias uint64) *hier {
+	self.WriteByte(kind)
+	self.WriteByte(0)
+	self.WriteString(name + "\x00")
+	putVarint(&self.Buffer, length)
+	putVarint(&self.Buffer, alias)
+	return self
+}
+
+func (self *hier) block(kind byte) []byte {
+	var b bytes.Buffer
+	putUint64(&b, uint64(self.Len()))
+	switch kind {
+	case blockHierarchy:
+		b.Write(gzipBytes(self.Bytes()))
+	case blockHierarchyLZ4:
+		b.Write(lz4Literals(self.Bytes()))
+	case blockHierarchyLZ42:
+		once := lz4Literals(self.Bytes())
+		putVarint(&b, uint64(len(once)))
+		b.Write(lz4Literals(once))
+	}
+	return section(kind, b.Bytes())
+}
+
+// change is a value change, at an index into the time table.
+type change struct {
+	i uint64
+	v string
+}
+
+// signal is a signal as far as its changes are concerned.
+type signal struct {
+	length  int // 0 for strings.
+	real    bool
+	changes []change
+	// alias is the handle of an earlier signal with the same changes,
+	// which are then not written again.
+	alias int
+}
+
+func (self signal) encode() []byte {
+	var b bytes.Buffer
+	prev := uint64(0)
+	for _, c := range self.changes {
+		delta := c.i - prev
+		prev = c.i
+		switch {
+		case self.real:
+			d, _ := strconv.ParseFloat(c.v, 64)
+			putVarint(&b, delta<<1)
+			binary.Write(&b, binary.LittleEndian, d)
+		case self.length == 0:
+			putVarint(&b, delta<<1)
+			putVarint(&b, uint64(len(c.v)))
+			b.WriteString(c.v)
+		case self.length == 1:
+			if c.v == "0" || c.v == "1" {
+				putVarint(&b, delta<<2|uint64(c.v[0]-'0')<<1)
+			} else {
+				putVarint(&b, delta<<4|uint64(strings.IndexByte("xzhuwl-?", c.v[0]))<<1|1)
+			}
+		case strings.Trim(c.v, "01") == "":
+			putVarint(&b, delta<<1)
+			packed := make([]byte, (self.length+7)/8)
+			for i := range self.length {
+				packed[i/8] |= (c.v[i] - '0') << (7 - i%8)
+			}
+			b.Write(packed)
+		default:
+			putVarint(&b, delta<<1|1)
+			b.WriteString(c.v)
+		}
+	}
+	return b.Bytes()
+}
+
+// valuesBlock makes a value change block. The frame has the values at the
+// start, in the order of the handles. The changes of the signals are
+// compressed with pack, where it makes them shorter.
+func valuesBlock(kind byte, pack byte, start uint64, frame []byte, times []uint64, signals []signal) []byte {
+	var b bytes.Buffer
+	putUint64(&b, start)
+	putUint64(&b, times[len(times)-1])
+	putUint64(&b, 0)
+	putVarint(&b, uint64(len(frame)))
+	zframe := zlibBytes(frame)
+	putVarint(&b, uint64(len(zframe)))
+	putVarint(&b, uint64(len(signals)))
+	b.Write(zframe)
+	putVarint(&b, uint64(len(signals)))
+	vcStart := b.Len()
+	b.WriteByte(pack)
+
+	var index bytes.Buffer
+	prev, zeros, prevAlias := 0, 0, 0
+	flush := func() {
+		if zeros > 0 {
+			putVarint(&index, uint64(zeros)<<1)
+			zeros = 0
+		}
+	}
+	for _, s := range signals {
+		switch {
+		case s.alias != 0:
+			flush()
+			if kind == blockValuesAlias2 {
+				if s.alias == prevAlias {
+					putSvarint(&index, 1)
+				} else {
+					putSvarint(&index, int64(-s.alias)<<1|1)
+				}
+			} else {
+				putVarint(&index, 0)
+				putVarint(&index, uint64(s.alias))
+			}
+			prevAlias = s.alias
+		case len(s.changes) == 0:
+			zeros++
+		default:
+			flush()
+			off := b.Len() - vcStart
+			data := s.encode()
+			var packed []byte
+			switch pack {
+			case 'Z':
+				packed = zlibBytes(data)
+			case '4':
+				packed = lz4Literals(data)
+			case 'F':
+				packed = fastlzLiterals(data)
+			}
+			if len(packed) < len(data) || pack != 'Z' {
+				putVarint(&b, uint64(len(data)))
+				b.Write(packed)
+			} else {
+				putVarint(&b, 0)
+				b.Write(data)
+			}
+			if kind == blockValuesAlias2 {
+				putSvarint(&index, int64(off-prev)<<1|1)
+			} else {
+				putVarint(&index, uint64(off-prev)<<1|1)
+			}
+			prev = off
+		}
+	}
+	flush()
+	b.Write(index.Bytes())
+	putUint64(&b, uint64(index.Len()))
+
+	var t bytes.Buffer
+	last := uint64(0)
+	for _, tt := range times {
+		putVarint(&t, tt-last)
+		last = tt
+	}
+	zt := zlibBytes(t.Bytes())
+	b.Write(zt)
+	putUint64(&b, uint64(t.Len()))
+	putUint64(&b, uint64(len(zt)))
+	putUint64(&b, uint64(len(times)))
+	return section(kind, b.Bytes())
+}
+
+func realBytes(d float64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(d))
+}
+
+// testFile returns an FST file with most of what the format has, and its
+// hierarchy block with the given type.
+func testFile(hierKind byte) []byte {
+	h := &hier{}
+	h.attr(0, vcd.AttrMiscEnumTable, "state_t 2 IDLE RUN 0 1", 1).
+		scope(0, "top").
+		variable(16, "clk", 1, 0).
+		variable(5, "data [3:0]", 4, 0).
+		attr(0, vcd.AttrMiscEnumTable, "", 1).
+		variable(23, "state", 1, 0).
+		scope(16, "p").
+		variable(16, "clk", 1, 1).
+		upscope().
+		variable(3, "r", 64, 0).
+		variable(21, "s", 0, 0).
+		variable(16, "clk2", 1, 0).
+		upscope()
+	signals := func(clk, data, state, r, s []change, clk2 int) []signal {
+		return []signal{
+			{length: 1, changes: clk},
+			{length: 4, changes: data},
+			{length: 1, changes: state},
+			{length: 8, real: true, changes: r},
+			{changes: s},
+			{length: 1, alias: clk2},
+		}
+	}
+	var b bytes.Buffer
+	b.Write(headerBlock(-10, "Test 1.0", "today", 0))
+	b.Write(valuesBlock(blockValuesAlias2, 'Z', 0,
+		append([]byte("xxxxx0"), append(realBytes(math.NaN()), 'x')...),
+		[]uint64{0, 10, 20},
+		signals(
+			[]change{{0, "0"}, {1, "1"}, {2, "0"}},
+			[]change{{1, "1010"}, {2, "10xz"}, {2, "11111111"[:4]}},
+			[]change{{1, "1"}},
+			[]change{{2, "1.5"}},
+			[]change{{1, "hello world"}},
+			1)))
+	b.Write(valuesBlock(blockValuesAlias, '4', 30,
+		append([]byte("01111"+"1"), append(realBytes(1.5), '0')...),
+		[]uint64{30, 40},
+		signals(
+			[]change{{0, "1"}, {1, "z"}, {1, "h"}},
+			[]change{{1, "0000"}},
+			nil,
+			nil,
+			[]change{{0, "bye"}},
+			1)))
+	b.Write(valuesBlock(blockValuesAlias2, 'F', 50,
+		append([]byte("h00001"), append(realBytes(1.5), 'h')...),
+		[]uint64{50},
+		signals([]change{{0, "0"}}, nil, nil, nil, nil, 0)))
+	b.Write(geometryBlock(1, 4, 1, 0, 0xffffffff, 1))
+	b.Write(h.block(hierKind))
+	return b.Bytes()
+}
+
+const testVCD = `$date today $end
+$version Test1.0 $end
+$timescale 100 ps $end
+$attrbegin misc 07 state_t 2 IDLE RUN 0 1 1 $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 4 " data[3:0] $end
+$attrbegin misc 07 1 $end
+$var logic 1 % state $end
+$scope vhdl_process p $end
+$var wire 1 ! clk $end
+$upscope $end
+$var real 64 & r $end
+$var string 1 ' s $end
+$var wire 1 ( clk2 $end
+$upscope $end
+$enddefinitions $end
+#0
+0 %
+0 !
+0 (
+#10
+1 !
+b1010 "
+1 %
+shello\x20world '
+1 (
+#20
+0 !
+b10xz "
+b1111 "
+r1.5 &
+0 (
+#30
+1 !
+sbye '
+1 (
+#40
+z !
+h !
+b0000 "
+z (
+h (
+#50
+0 !
+`
+
+// dump reads r and writes it out as VCD text.
+func dump(t *testing.T, r *vcd.Reader) string {
+	t.Helper()
+	f, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	var b bytes.Buffer
+	w := vcd.NewWriter(&b)
+	w.WriteFile(f)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	return b.String()
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+	for _, kind := range []byte{blockHierarchy, blockHierarchyLZ4, blockHierarchyLZ42} {
+		data := testFile(kind)
+		if !Is(bytes.NewReader(data)) {
+			t.Errorf("not taken for an FST file")
+		}
+		actual := dump(t, NewReader(bytes.NewReader(data), int64(len(data))))
+		if actual != testVCD {
+			t.Errorf("hierarchy block %v:\nwant:\n%v\ngot:\n%v", kind, testVCD, actual)
+		}
+	}
+}
+
+func TestReaderHeader(t *testing.T) {
+	t.Parallel()
+	data := testFile(blockHierarchy)
+	h, err := NewReader(bytes.NewReader(data), int64(len(data))).Header()
+	if err != nil {
+		t.Fatalf("could not read the header: %v", err)
+	}
+	if h.Date != "today" || h.Version != "Test 1.0" || h.Timescale.String() != "100 ps" {
+		t.Errorf("header: %+v", h)
+	}
+	v := h.Hierarchy.Var("/top/state")
+	if v == nil || v.EnumTable == nil || v.EnumTable.Name != "state_t" {
+		t.Errorf("enum: %+v", v)
+	}
+	if len(h.Hierarchy.Aliases("!")) != 2 {
+		t.Errorf("aliases: %+v", h.Hierarchy.Aliases("!"))
+	}
+}
+
+func TestReaderTimezero(t *testing.T) {
+	t.Parallel()
+	header := headerBlock(-10, "Test 1.0", "today", 0)
+	withTimezero := func(timezero int64) []byte {
+		data := testFile(blockHierarchy)
+		return append(headerBlock(-10, "Test 1.0", "today", timezero), data[len(header):]...)
+	}
+
+	data := withTimezero(5)
+	expected := strings.NewReplacer(
+		"#0\n", "#5\n", "#10\n", "#15\n", "#20\n", "#25\n",
+		"#30\n", "#35\n", "#40\n", "#45\n", "#50\n", "#55\n").Replace(testVCD)
+	if actual := dump(t, NewReader(bytes.NewReader(data), int64(len(data)))); actual != expected {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", expected, actual)
+	}
+
+	data = withTimezero(-5)
+	_, err := NewReader(bytes.NewReader(data), int64(len(data))).ReadAll()
+	if err == nil || !strings.Contains(err.Error(), "before zero") {
+		t.Errorf("want: an error for a time before zero, got: %v", err)
+	}
+}
+
+func TestReaderWrapped(t *testing.T) {
+	t.Parallel()
+	data := testFile(blockHierarchy)
+	var b bytes.Buffer
+	putUint64(&b, uint64(len(data)))
+	b.Write(gzipBytes(data))
+	wrapped := section(blockZWrapper, b.Bytes())
+	if !Is(bytes.NewReader(wrapped)) {
+		t.Errorf("not taken for an FST file")
+	}
+	if actual := dump(t, NewReader(bytes.NewReader(wrapped), int64(len(wrapped)))); actual != testVCD {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", testVCD, actual)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	t.Parallel()
+	data := testFile(blockHierarchy)
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "no header block"},
+		{"no hierarchy", data[:len(data)-len((&hier{}).block(blockHierarchy))-40], "no hierarchy block"},
+		{"not fst", []byte("$date today $end\n$enddefinitions $end\n"), "no header block"},
+	}
+	for _, test := range tests {
+		r := NewReader(bytes.NewReader(test.data), int64(len(test.data)))
+		_, err := r.Declarations()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: want: %q, got: %v", test.name, test.expected, err)
+		}
+	}
+	if Is(bytes.NewReader([]byte("$date"))) {
+		t.Errorf("VCD text taken for an FST file")
+	}
+}
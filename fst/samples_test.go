@@ -0,0 +1,381 @@
+package fst
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/filmil/go-vcd-parser/wave"
+)
+
+// samples returns the names of the FST files in testdata that have a VCD
+// file next to them, with the same contents. See testdata/README.md for how
+// to make them.
+func samples(t *testing.T) []string {
+	t.Helper()
+	names, err := filepath.Glob("testdata/*.fst")
+	if err != nil {
+		t.Fatalf("could not list the samples: %v", err)
+	}
+	var ret []string
+	for _, name := range names {
+		if _, err := os.Stat(vcdName(name)); err == nil {
+			ret = append(ret, name)
+		}
+	}
+	if len(ret) == 0 {
+		t.Skip("no FST files with VCD files in testdata, see testdata/README.md")
+	}
+	return ret
+}
+
+func vcdName(name string) string {
+	return strings.TrimSuffix(name, ".fst") + ".vcd"
+}
+
+// loadVCD reads the named VCD file into a store.
+func loadVCD(t *testing.T, name string) *wave.Store {
+	t.Helper()
+	f, err := vcd.Open(name)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer f.Close()
+	ret, err := wave.Load(vcd.NewReader(f, vcd.WithFilename(name)))
+	if err != nil {
+		t.Fatalf("could not read: %v: %v", name, err)
+	}
+	return ret
+}
+
+// changes returns the value changes of the signal, one per line. Vectors
+// are extended to their full width, as writers leave out leading zeros
+// differently. A first value that is all x is left out, as that is what a
+// signal that was never set has, if a writer gives it at all.
+func changes(s *wave.Signal) []string {
+	var ret []string
+	for i := range s.Len() {
+		v := s.Value(i)
+		if i == 0 && v != "" && strings.Trim(v, "xX") == "" {
+			continue
+		}
+		if b, err := vcd.ParseValue(v); err == nil && s.Size > 1 {
+			v = b.Extend(s.Size).String()
+		}
+		ret = append(ret, fmt.Sprintf("#%v %v", s.Time(i), v))
+	}
+	return ret
+}
+
+// compareStores reports where the signals of the two stores differ, by
+// their path names.
+func compareStores(t *testing.T, expected, actual *wave.Store) {
+	t.Helper()
+	if e, a := expected.Timescale(), actual.Timescale(); !reflect.DeepEqual(e, a) {
+		t.Errorf("timescale: want: %v, got: %v", e, a)
+	}
+	vars := expected.Hierarchy().Vars()
+	if e, a := len(vars), len(actual.Hierarchy().Vars()); e != a {
+		t.Errorf("number of variables: want: %v, got: %v", e, a)
+	}
+	for _, v := range vars {
+		e, a := expected.Lookup(v.Path), actual.Lookup(v.Path)
+		if a == nil {
+			t.Errorf("missing variable: %v", v.Path)
+			continue
+		}
+		if e.Size != a.Size {
+			t.Errorf("size of %v: want: %v, got: %v", v.Path, e.Size, a.Size)
+		}
+		if ec, ac := changes(e), changes(a); !reflect.DeepEqual(ec, ac) {
+			t.Errorf("changes of %v:\nwant:\n%v\ngot:\n%v",
+				v.Path, strings.Join(ec, "\n"), strings.Join(ac, "\n"))
+		}
+	}
+}
+
+// TestReaderSamples checks that the FST files that other tools wrote, such
+// as GTKWave's vcd2fst and Verilator, read the same as their VCD files.
+func TestReaderSamples(t *testing.T) {
+	t.Parallel()
+	for _, name := range samples(t) {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			r, err := Open(name)
+			if err != nil {
+				t.Fatalf("could not open: %v", err)
+			}
+			defer r.Close()
+			actual, err := wave.Load(r)
+			if err != nil {
+				t.Fatalf("could not read: %v", err)
+			}
+			compareStores(t, loadVCD(t, vcdName(name)), actual)
+		})
+	}
+}
+
+// scanFile returns the source of the FST file in data, scanned, and its
+// hierarchy block.
+func scanFile(t *testing.T, data []byte) (*source, block) {
+	t.Helper()
+	ret := &source{r: bytes.NewReader(data), size: int64(len(data))}
+	hier, err := ret.scan()
+	if err != nil {
+		t.Fatalf("could not scan: %v", err)
+	}
+	return ret, *hier
+}
+
+// compareWritten checks that the Writer makes the same header, geometry
+// and hierarchy blocks of the VCD file in r as another writer made in data.
+// The hierarchy is compared uncompressed, as compressors differ.
+func compareWritten(t *testing.T, data []byte, r io.Reader) {
+	t.Helper()
+	var b seekBuffer
+	w := NewWriter(&b)
+	if err := w.WriteReader(vcd.NewReader(r)); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	expected, expectedHier := scanFile(t, data)
+	actual, actualHier := scanFile(t, b.b)
+
+	eh, err := expected.read(0, 1+headerLength)
+	if err != nil {
+		t.Fatalf("could not read the header: %v", err)
+	}
+	ah, err := actual.read(0, 1+headerLength)
+	if err != nil {
+		t.Fatalf("could not read the header: %v", err)
+	}
+	// The memory that the writer used, and the number of value change
+	// blocks, are up to the writer.
+	for _, r := range [][2]int{{33, 41}, {65, 73}} {
+		clear(eh[r[0]:r[1]])
+		clear(ah[r[0]:r[1]])
+	}
+	if !bytes.Equal(eh, ah) {
+		t.Errorf("header:\nwant: % x\ngot:  % x", eh, ah)
+	}
+	if !reflect.DeepEqual(expected.lengths, actual.lengths) || !reflect.DeepEqual(expected.reals, actual.reals) {
+		t.Errorf("geometry: want: %v %v, got: %v %v",
+			expected.lengths, expected.reals, actual.lengths, actual.reals)
+	}
+	er, err := expected.records(expectedHier)
+	if err != nil {
+		t.Fatalf("could not read the hierarchy: %v", err)
+	}
+	ar, err := actual.records(actualHier)
+	if err != nil {
+		t.Fatalf("could not read the hierarchy: %v", err)
+	}
+	if !bytes.Equal(er, ar) {
+		t.Errorf("hierarchy:\nwant: %q\ngot:  %q", er, ar)
+	}
+}
+
+// TestWriterSamples checks that the Writer makes the same header, geometry
+// and hierarchy blocks of the VCD files as the other writers made of them.
+func TestWriterSamples(t *testing.T) {
+	t.Parallel()
+	for _, name := range samples(t) {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatalf("could not read: %v", err)
+			}
+			f, err := vcd.Open(vcdName(name))
+			if err != nil {
+				t.Fatalf("could not open: %v", err)
+			}
+			defer f.Close()
+			compareWritten(t, data, f)
+		})
+	}
+}
+
+// toolTestVCD is written to FST files by GTKWave's tools. The clk and the
+// bus of sub are aliases of those of top.
+const toolTestVCD = `$date today $end
+$version Test 1.0 $end
+$timescale 1 ns $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 8 " data[7:0] $end
+$var integer 32 # count $end
+$var real 64 $ r $end
+$scope module sub $end
+$var wire 1 ! clk $end
+$var reg 8 " bus[7:0] $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+0!
+b0 "
+b0 #
+r0 $
+$end
+#10
+1!
+b1010xz10 "
+b101 #
+r1.5 $
+#20
+0!
+b11111111 "
+#25
+1!
+r-2.25e-10 $
+#30
+0!
+b110 #
+`
+
+// tool returns the path of the named program, such as GTKWave's vcd2fst,
+// and skips the test if it is not installed.
+func tool(t *testing.T, name string) string {
+	t.Helper()
+	ret, err := exec.LookPath(name)
+	if err != nil {
+		t.Skipf("%v is not installed, see testdata/README.md", name)
+	}
+	return ret
+}
+
+// run runs the program with args, and fails the test if it fails.
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Fatalf("%v %v: %v\n%s", filepath.Base(name), strings.Join(args, " "), err, out)
+	}
+}
+
+// shiftTimes returns the VCD file in text with d added to its simulation
+// times.
+func shiftTimes(t *testing.T, text string, d uint64) string {
+	t.Helper()
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "#") {
+			continue
+		}
+		n, err := strconv.ParseUint(l[1:], 10, 64)
+		if err != nil {
+			t.Fatalf("not a time: %q", l)
+		}
+		lines[i] = fmt.Sprintf("#%v", n+d)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// loadString reads the VCD file in text into a store.
+func loadString(t *testing.T, text string) *wave.Store {
+	t.Helper()
+	ret, err := wave.Load(vcd.NewReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	return ret
+}
+
+// TestReaderVcd2fst checks that the FST files that GTKWave's vcd2fst writes,
+// with each of its encodings, read the same as the VCD files it was given.
+// vcd2fst writes the changes of aliases once, in blocks with dynamic
+// aliases. A `$timezero` of the VCD file goes to the header of the FST file,
+// and is added to the times when read.
+func TestReaderVcd2fst(t *testing.T) {
+	t.Parallel()
+	vcd2fst := tool(t, "vcd2fst")
+	tests := []struct {
+		name     string
+		flags    []string
+		timezero uint64
+	}{
+		{"plain", nil, 0},
+		{"fourpack", []string{"--fourpack"}, 0},
+		{"fastpack", []string{"--fastpack"}, 0},
+		{"compress", []string{"--compress"}, 0},
+		{"timezero", nil, 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			text := toolTestVCD
+			if test.timezero != 0 {
+				text = strings.Replace(text, "$enddefinitions",
+					fmt.Sprintf("$timezero %v $end\n$enddefinitions", test.timezero), 1)
+			}
+			dir := t.TempDir()
+			in, out := filepath.Join(dir, "in.vcd"), filepath.Join(dir, "out.fst")
+			if err := os.WriteFile(in, []byte(text), 0o644); err != nil {
+				t.Fatalf("could not write: %v", err)
+			}
+			run(t, vcd2fst, append(test.flags, "--vcdname", in, "--fstname", out)...)
+			r, err := Open(out)
+			if err != nil {
+				t.Fatalf("could not open: %v", err)
+			}
+			defer r.Close()
+			actual, err := wave.Load(r)
+			if err != nil {
+				t.Fatalf("could not read: %v", err)
+			}
+			compareStores(t, loadString(t, shiftTimes(t, toolTestVCD, test.timezero)), actual)
+		})
+	}
+}
+
+// TestWriterVcd2fst checks that the Writer makes the same header, geometry
+// and hierarchy blocks of a VCD file as GTKWave's vcd2fst does.
+func TestWriterVcd2fst(t *testing.T) {
+	t.Parallel()
+	vcd2fst := tool(t, "vcd2fst")
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.vcd"), filepath.Join(dir, "out.fst")
+	if err := os.WriteFile(in, []byte(toolTestVCD), 0o644); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	run(t, vcd2fst, "--vcdname", in, "--fstname", out)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	compareWritten(t, data, strings.NewReader(toolTestVCD))
+}
+
+// TestWriterFst2vcd checks that GTKWave's fst2vcd reads the files that the
+// Writer makes, with the same value changes.
+func TestWriterFst2vcd(t *testing.T) {
+	t.Parallel()
+	fst2vcd := tool(t, "fst2vcd")
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.fst"), filepath.Join(dir, "out.vcd")
+	f, err := os.Create(in)
+	if err != nil {
+		t.Fatalf("could not create: %v", err)
+	}
+	w := NewWriter(f)
+	if err := w.WriteReader(vcd.NewReader(strings.NewReader(toolTestVCD))); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	run(t, fst2vcd, "--fstname", in, "--output", out)
+	compareStores(t, loadString(t, toolTestVCD), loadVCD(t, out))
+}
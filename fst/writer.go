@@ -0,0 +1,731 @@
+package fst
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// BlockSize is the number of bytes of value changes that a Writer keeps in
+// memory before it writes them out as a block.
+const BlockSize = 1 << 25
+
+// Writer writes FST files. It takes the same calls as vcd.Writer:
+//
+//	w, err := fst.Create("dump.fst")
+//	w.DeclareScope(vcd.ScopeKindModule, "top")
+//	clk, err := w.DeclareVar(vcd.VarKindWire, 1, "clk")
+//	w.Upscope()
+//	w.EndDefinitions()
+//	w.Time(0)
+//	w.Change(clk, "0")
+//	// ...
+//	err := w.Close()
+//
+// The value changes are kept in memory until there are about BlockSize
+// bytes of them, and then written out as a compressed block. The header at
+// the start of the file is only complete once Close writes it again, so the
+// output must allow seeking. Once a method fails, all later calls return the
+// same error.
+type Writer struct {
+	ws     io.WriteSeeker
+	w      *bufio.Writer
+	closer io.Closer // Closed by Close, may be nil.
+	err    error
+
+	date, version string
+	timescale     int8
+
+	hier        bytes.Buffer // The records of the hierarchy.
+	depth       int          // The number of open scopes.
+	scopes      int
+	vars        int // Including the aliases.
+	definitions bool
+
+	signals []*writerSignal // By handle - 1.
+	time    *uint64
+	// The times of the first and the last value change.
+	first, last *uint64
+
+	// The block being made.
+	blockSize int
+	frame     []byte   // The values at the start of the block.
+	times     []uint64 // The times of the value changes.
+	size      int      // Of the value changes.
+	blocks    int      // The number of blocks written.
+
+	zbuf bytes.Buffer
+	z    *zlib.Writer
+}
+
+type writerSignal struct {
+	kind   vcd.VarKindCode
+	length int // In bits, 0 for strings.
+	real   bool
+	// value is the current value: length characters, or the 8 bytes of a
+	// real.
+	value []byte
+
+	// In the current block.
+	changes []byte
+	index   uint64 // The index in the time table of the last change.
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.WriteSeeker) *Writer {
+	ret := &Writer{
+		ws:        w,
+		w:         bufio.NewWriter(w),
+		timescale: -9,
+		blockSize: BlockSize,
+	}
+	ret.z = zlib.NewWriter(&ret.zbuf)
+	// Written again by Close.
+	ret.w.Write(ret.header())
+	return ret
+}
+
+// Create creates the named FST file, and returns a Writer of it. Close the
+// Writer to close the file.
+func Create(name string) (*Writer, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("fst.Create: %w", err)
+	}
+	ret := NewWriter(f)
+	ret.closer = f
+	return ret, nil
+}
+
+// fail records and returns an error of the method op.
+func (self *Writer) fail(op, format string, args ...any) error {
+	if self.err == nil {
+		self.err = fmt.Errorf("fst.Writer.%v: %v", op, fmt.Sprintf(format, args...))
+	}
+	return self.err
+}
+
+// write writes a block of the given type, unless a previous write failed.
+func (self *Writer) write(kind byte, body []byte) error {
+	if self.err != nil {
+		return self.err
+	}
+	self.w.WriteByte(kind)
+	self.w.Write(binary.BigEndian.AppendUint64(nil, uint64(len(body)+8)))
+	if _, err := self.w.Write(body); err != nil {
+		self.err = fmt.Errorf("fst.Writer: %w", err)
+	}
+	return self.err
+}
+
+// Date sets the date of the file.
+func (self *Writer) Date(text string) error {
+	self.date = text
+	return self.err
+}
+
+// Version sets the text that tells what wrote the file.
+func (self *Writer) Version(text string) error {
+	self.version = text
+	return self.err
+}
+
+// Timescale sets the timescale, such as `1 ns`. The number is 1, 10 or 100.
+// Without a call, the timescale is 1 ns.
+func (self *Writer) Timescale(number int64, unit string) error {
+	exps := map[string]int8{"s": 0, "ms": -3, "us": -6, "ns": -9, "ps": -12, "fs": -15}
+	exp, ok := exps[unit]
+	if !ok {
+		return self.fail("Timescale", "unknown unit: %q", unit)
+	}
+	switch number {
+	case 1:
+	case 10:
+		exp++
+	case 100:
+		exp += 2
+	default:
+		return self.fail("Timescale", "not 1, 10 or 100: %v", number)
+	}
+	self.timescale = exp
+	return self.err
+}
+
+// DeclareScope opens a scope. Close it with Upscope.
+func (self *Writer) DeclareScope(kind vcd.ScopeKindCode, name string) error {
+	if self.definitions {
+		return self.fail("DeclareScope", "scope after the definitions: %v", name)
+	}
+	t := -1
+	for i, k := range scopeKinds {
+		if k == kind {
+			t = i
+		}
+	}
+	if t < 0 {
+		return self.fail("DeclareScope", "unknown scope kind: %v", int(kind))
+	}
+	if name == "" {
+		return self.fail("DeclareScope", "empty scope name")
+	}
+	self.depth++
+	self.scopes++
+	self.hier.WriteByte(tagScope)
+	self.hier.WriteByte(byte(t))
+	self.hier.WriteString(name + "\x00\x00")
+	return self.err
+}
+
+// Upscope closes the innermost scope.
+func (self *Writer) Upscope() error {
+	if self.depth == 0 {
+		return self.fail("Upscope", "no open scope")
+	}
+	self.depth--
+	self.hier.WriteByte(tagUpscope)
+	return self.err
+}
+
+// DeclareVar declares a variable in the current scope, and returns the id
+// code assigned to it. The name may have indices, such as `data[7:0]`.
+func (self *Writer) DeclareVar(kind vcd.VarKindCode, size int, name string) (string, error) {
+	t, err := self.checkVar("DeclareVar", kind, size, name)
+	if err != nil {
+		return "", err
+	}
+	s := &writerSignal{kind: kind, length: size}
+	switch kind.Encoding() {
+	case vcd.EncodingReal:
+		s.real = true
+		// Not set yet.
+		s.value = binary.LittleEndian.AppendUint64(nil, math.Float64bits(math.NaN()))
+	case vcd.EncodingString:
+		s.length = 0
+	default:
+		s.value = bytes.Repeat([]byte{'x'}, size)
+	}
+	self.signals = append(self.signals, s)
+	self.variable(t, size, name, 0)
+	return strconv.Itoa(len(self.signals)), self.err
+}
+
+// DeclareAlias declares a variable in the current scope with the id code of
+// a variable that was declared before, so that both have the same values.
+func (self *Writer) DeclareAlias(kind vcd.VarKindCode, size int, name, code string) error {
+	t, err := self.checkVar("DeclareAlias", kind, size, name)
+	if err != nil {
+		return err
+	}
+	h, ok := self.handle(code)
+	if !ok {
+		return self.fail("DeclareAlias", "unknown id code: %q", code)
+	}
+	self.variable(t, size, name, h)
+	return self.err
+}
+
+// checkVar checks a variable declaration, and returns the FST type of the
+// variable.
+func (self *Writer) checkVar(op string, kind vcd.VarKindCode, size int, name string) (byte, error) {
+	if self.definitions {
+		return 0, self.fail(op, "variable after the definitions: %v", name)
+	}
+	t, ok := varType(kind)
+	if !ok {
+		return 0, self.fail(op, "unknown variable kind: %v", int(kind))
+	}
+	if size < 1 {
+		return 0, self.fail(op, "bad size: %v: %v", name, size)
+	}
+	if name == "" {
+		return 0, self.fail(op, "empty variable name")
+	}
+	return t, self.err
+}
+
+// varType returns the FST type of variables of the kind.
+func varType(kind vcd.VarKindCode) (byte, bool) {
+	if kind == vcd.VarKindPort {
+		return typePort, true
+	}
+	for i, k := range varKinds {
+		if k == kind {
+			return byte(i), true
+		}
+	}
+	return 0, false
+}
+
+// variable adds a variable to the hierarchy. alias is the handle of the
+// signal of the variable, or 0 for a new signal.
+func (self *Writer) variable(t byte, size int, name string, alias int) {
+	self.vars++
+	self.hier.WriteByte(t)
+	self.hier.WriteByte(0) // The direction, which VCD does not have.
+	self.hier.WriteString(name + "\x00")
+	self.hier.Write(binary.AppendUvarint(nil, uint64(size)))
+	self.hier.Write(binary.AppendUvarint(nil, uint64(alias)))
+}
+
+// handle returns the handle of the signal with the id code.
+func (self *Writer) handle(code string) (int, bool) {
+	h, err := strconv.Atoi(code)
+	if err != nil || h < 1 || h > len(self.signals) {
+		return 0, false
+	}
+	return h, true
+}
+
+// Attr adds an attribute, which annotates the scope or variable declared
+// next. The name may be empty. See vcd.AttrT.
+func (self *Writer) Attr(kind vcd.AttrKindCode, subtype int, name string, arg int64) error {
+	if self.definitions {
+		return self.fail("Attr", "attribute after the definitions: %v", name)
+	}
+	if kind < 0 || kind >= vcd.AttrKindUnknown {
+		return self.fail("Attr", "unknown attribute kind: %v", int(kind))
+	}
+	if subtype < 0 || subtype > 0xff {
+		return self.fail("Attr", "bad subtype: %v", subtype)
+	}
+	self.hier.WriteByte(tagAttrbegin)
+	self.hier.WriteByte(byte(kind))
+	self.hier.WriteByte(byte(subtype))
+	self.hier.WriteString(name + "\x00")
+	self.hier.Write(binary.AppendUvarint(nil, uint64(arg)))
+	return self.err
+}
+
+// Attrend ends the attribute that Attr began.
+func (self *Writer) Attrend() error {
+	if self.definitions {
+		return self.fail("Attrend", "attribute after the definitions")
+	}
+	self.hier.WriteByte(tagAttrend)
+	return self.err
+}
+
+// EndDefinitions ends the declarations. Any open scopes are closed first.
+func (self *Writer) EndDefinitions() error {
+	if self.definitions {
+		return self.fail("EndDefinitions", "called twice")
+	}
+	for self.depth > 0 {
+		self.Upscope()
+	}
+	self.definitions = true
+	return self.err
+}
+
+// Time sets the simulation time of the changes that follow. The time may
+// not go backwards.
+func (self *Writer) Time(t uint64) error {
+	if !self.definitions {
+		return self.fail("Time", "time before the end of the definitions")
+	}
+	if self.time != nil {
+		if t < *self.time {
+			return self.fail("Time", "time goes backwards: %v < %v", t, *self.time)
+		}
+		if t == *self.time {
+			return self.err
+		}
+	}
+	self.time = &t
+	if self.size >= self.blockSize {
+		return self.flush()
+	}
+	return self.err
+}
+
+// Change sets a new value of the variable with the given code. The value is
+// given as to vcd.Writer: bits such as `10xz` for most kinds, a number for
+// real variables, and any text for strings. Bits are extended or cut to the
+// size of the variable, as for VCD files.
+func (self *Writer) Change(code, value string) error {
+	if self.err != nil {
+		return self.err
+	}
+	if !self.definitions {
+		return self.fail("Change", "value change before the end of the definitions")
+	}
+	h, ok := self.handle(code)
+	if !ok {
+		return self.fail("Change", "unknown id code: %q", code)
+	}
+	s := self.signals[h-1]
+	var t uint64
+	if self.time != nil {
+		t = *self.time
+	}
+	if len(self.times) == 0 {
+		self.startBlock(t)
+	}
+	self.last = &t
+	if self.times[len(self.times)-1] != t {
+		self.times = append(self.times, t)
+	}
+	i := uint64(len(self.times) - 1)
+	delta := i - s.index
+	s.index = i
+	n := len(s.changes)
+	switch {
+	case s.real:
+		d, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return self.fail("Change", "not a real value: %v: %q", code, value)
+		}
+		s.value = binary.LittleEndian.AppendUint64(s.value[:0], math.Float64bits(d))
+		s.changes = binary.AppendUvarint(s.changes, delta<<1)
+		s.changes = append(s.changes, s.value...)
+	case s.length == 0:
+		s.changes = binary.AppendUvarint(s.changes, delta<<1)
+		s.changes = binary.AppendUvarint(s.changes, uint64(len(value)))
+		s.changes = append(s.changes, value...)
+	case s.kind == vcd.VarKindPort:
+		return self.fail("Change", "port values are not supported: %v", code)
+	default:
+		v, err := vcd.ParseValue(value)
+		if err != nil {
+			return self.fail("Change", "not a vector value: %v: %q", code, value)
+		}
+		s.value = append(s.value[:0], v.Extend(s.length).String()...)
+		s.changes = appendBits(s.changes, delta, s.value)
+	}
+	self.size += len(s.changes) - n
+	return self.err
+}
+
+// appendBits appends the change of a signal to the bits v. A single bit is
+// in the number that has the time delta; more bits follow it, packed if
+// they are all 0 or 1.
+func appendBits(b []byte, delta uint64, v []byte) []byte {
+	if len(v) == 1 {
+		if v[0] == '0' || v[0] == '1' {
+			return binary.AppendUvarint(b, delta<<2|uint64(v[0]-'0')<<1)
+		}
+		i := strings.IndexByte("xzhuwl-?", v[0])
+		if i < 0 {
+			i = 0
+		}
+		return binary.AppendUvarint(b, delta<<4|uint64(i)<<1|1)
+	}
+	if strings.Trim(string(v), "01") != "" {
+		b = binary.AppendUvarint(b, delta<<1|1)
+		return append(b, v...)
+	}
+	b = binary.AppendUvarint(b, delta<<1)
+	packed := make([]byte, (len(v)+7)/8)
+	for i, c := range v {
+		packed[i/8] |= (c - '0') << (7 - i%8)
+	}
+	return append(b, packed...)
+}
+
+// startBlock starts a block at time t, with the current values.
+func (self *Writer) startBlock(t uint64) {
+	if self.first == nil {
+		self.first = &t
+	}
+	self.times = append(self.times, t)
+	self.frame = self.frame[:0]
+	for _, s := range self.signals {
+		self.frame = append(self.frame, s.value...)
+	}
+}
+
+// compress returns data compressed with zlib, or nil if that does not make
+// it shorter.
+func (self *Writer) compress(data []byte) []byte {
+	self.zbuf.Reset()
+	self.z.Reset(&self.zbuf)
+	self.z.Write(data)
+	self.z.Close()
+	if self.zbuf.Len() >= len(data) {
+		return nil
+	}
+	return self.zbuf.Bytes()
+}
+
+// flush writes out the value changes of the current block, if there are
+// any.
+//
+// A block has the values of all signals at its start, the value changes of
+// each signal, an index of where those of each signal are, and a table of
+// the times of the changes. See source.values for the reverse.
+func (self *Writer) flush() error {
+	if len(self.times) == 0 {
+		return self.err
+	}
+	var b bytes.Buffer
+	put := func(v uint64) {
+		b.Write(binary.BigEndian.AppendUint64(nil, v))
+	}
+	varint := func(b *bytes.Buffer, v uint64) {
+		b.Write(binary.AppendUvarint(nil, v))
+	}
+	put(self.times[0])
+	put(self.times[len(self.times)-1])
+	// The memory needed to read the block.
+	var mem uint64
+	for _, s := range self.signals {
+		mem += uint64(len(s.changes))
+	}
+	put(mem)
+
+	varint(&b, uint64(len(self.frame)))
+	frame := self.compress(self.frame)
+	if frame == nil {
+		frame = self.frame
+	}
+	varint(&b, uint64(len(frame)))
+	varint(&b, uint64(len(self.signals)))
+	b.Write(frame)
+	varint(&b, uint64(len(self.signals)))
+
+	// The offsets in the index are relative to the packing type.
+	start := b.Len()
+	b.WriteByte('Z')
+	var index bytes.Buffer
+	prev, zeros := 0, uint64(0)
+	for _, s := range self.signals {
+		if len(s.changes) == 0 {
+			zeros++
+			continue
+		}
+		if zeros > 0 {
+			varint(&index, zeros<<1)
+			zeros = 0
+		}
+		off := b.Len() - start
+		if z := self.compress(s.changes); z != nil {
+			varint(&b, uint64(len(s.changes)))
+			b.Write(z)
+		} else {
+			varint(&b, 0)
+			b.Write(s.changes)
+		}
+		index.Write(appendSvarint(nil, int64(off-prev)<<1|1))
+		prev = off
+		s.changes, s.index = s.changes[:0], 0
+	}
+	if zeros > 0 {
+		varint(&index, zeros<<1)
+	}
+	b.Write(index.Bytes())
+	put(uint64(index.Len()))
+
+	var times bytes.Buffer
+	last := uint64(0)
+	for _, t := range self.times {
+		varint(&times, t-last)
+		last = t
+	}
+	zt := self.compress(times.Bytes())
+	if zt == nil {
+		zt = times.Bytes()
+	}
+	b.Write(zt)
+	put(uint64(times.Len()))
+	put(uint64(len(zt)))
+	put(uint64(len(self.times)))
+
+	self.times, self.size = self.times[:0], 0
+	self.blocks++
+	return self.write(blockValuesAlias2, b.Bytes())
+}
+
+// appendSvarint appends v as a signed LEB128 number.
+func appendSvarint(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// header returns the header block.
+func (self *Writer) header() []byte {
+	var b bytes.Buffer
+	put := func(v uint64) {
+		b.Write(binary.BigEndian.AppendUint64(nil, v))
+	}
+	b.WriteByte(blockHeader)
+	put(headerLength)
+	var start, end uint64
+	if self.first != nil {
+		start, end = *self.first, *self.last
+	}
+	put(start)
+	put(end)
+	// Tells the byte order of the doubles.
+	b.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(math.E)))
+	put(0) // The memory that the writer used.
+	put(uint64(self.scopes))
+	put(uint64(self.vars))
+	put(uint64(len(self.signals)))
+	put(uint64(self.blocks))
+	b.WriteByte(byte(self.timescale))
+	b.Write(field(self.version, 128))
+	b.Write(field(self.date, 119))
+	b.WriteByte(0) // A Verilog file.
+	put(0)         // The time zero.
+	return b.Bytes()
+}
+
+// field returns s as a fixed-size field of n bytes, ending with a zero byte.
+func field(s string, n int) []byte {
+	ret := make([]byte, n)
+	copy(ret[:n-1], s)
+	return ret
+}
+
+// Close writes out the rest of the file, and closes the file if the Writer
+// made it.
+func (self *Writer) Close() error {
+	if self.closer != nil {
+		defer self.closer.Close()
+		self.closer = nil
+	}
+	if !self.definitions {
+		self.EndDefinitions()
+	}
+	self.flush()
+
+	// The lengths of the signals.
+	var geom, b bytes.Buffer
+	for _, s := range self.signals {
+		l := uint64(s.length)
+		switch {
+		case s.real:
+			l = 0
+		case s.length == 0:
+			l = 0xffffffff
+		}
+		geom.Write(binary.AppendUvarint(nil, l))
+	}
+	b.Write(binary.BigEndian.AppendUint64(nil, uint64(geom.Len())))
+	b.Write(binary.BigEndian.AppendUint64(nil, uint64(len(self.signals))))
+	if z := self.compress(geom.Bytes()); z != nil {
+		b.Write(z)
+	} else {
+		b.Write(geom.Bytes())
+	}
+	self.write(blockGeometry, b.Bytes())
+
+	b.Reset()
+	b.Write(binary.BigEndian.AppendUint64(nil, uint64(self.hier.Len())))
+	z := gzip.NewWriter(&b)
+	z.Write(self.hier.Bytes())
+	z.Close()
+	self.write(blockHierarchy, b.Bytes())
+
+	if self.err != nil {
+		return self.err
+	}
+	if err := self.w.Flush(); err != nil {
+		self.err = fmt.Errorf("fst.Writer.Close: %w", err)
+		return self.err
+	}
+	if _, err := self.ws.Seek(0, io.SeekStart); err != nil {
+		self.err = fmt.Errorf("fst.Writer.Close: %w", err)
+		return self.err
+	}
+	if _, err := self.ws.Write(self.header()); err != nil {
+		self.err = fmt.Errorf("fst.Writer.Close: %w", err)
+		return self.err
+	}
+	// Nothing more to write.
+	self.err = fmt.Errorf("fst.Writer: closed")
+	return nil
+}
+
+// WriteReader writes the declarations and the value changes that r hands
+// out, up to the end. Variables with the same id code become aliases.
+// Value changes of undeclared variables are dropped, and port values are
+// not supported. Call Close afterwards.
+func (self *Writer) WriteReader(r *vcd.Reader) error {
+	h, err := r.Header()
+	if err != nil {
+		return fmt.Errorf("fst.Writer.WriteReader: %w", err)
+	}
+	if h.Date != "" {
+		self.Date(h.Date)
+	}
+	if h.Version != "" {
+		self.Version(h.Version)
+	}
+	if t := h.Timescale; t != nil && t.Unit != nil {
+		self.Timescale(t.Number, t.Unit.String())
+	}
+	codes := map[string]string{}
+	for _, d := range h.Declarations {
+		switch {
+		case d.Scope != nil:
+			self.DeclareScope(d.Scope.ScopeKind.Kind(), d.Scope.Id)
+		case d.Upscope != nil:
+			// Like vcd.Hierarchy, ignore extra ones.
+			if self.depth > 0 {
+				self.Upscope()
+			}
+		case d.Var != nil:
+			v := d.Var
+			if code, ok := codes[v.Code]; ok {
+				self.DeclareAlias(v.GetVarKind(), v.Size, v.Id.RawString(), code)
+				break
+			}
+			code, _ := self.DeclareVar(v.GetVarKind(), v.Size, v.Id.RawString())
+			codes[v.Code] = code
+		case d.Attrbegin != nil:
+			a := d.Attrbegin
+			self.Attr(a.GetKind(), a.Subtype, a.Name, a.Arg)
+		case d.Attrend != nil:
+			self.Attrend()
+		}
+	}
+	self.EndDefinitions()
+	for self.err == nil {
+		c, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("fst.Writer.WriteReader: %w", err)
+		}
+		if c.SimulationTime != nil {
+			t, err := c.SimulationTime.Value()
+			if err != nil {
+				return fmt.Errorf("fst.Writer.WriteReader: %w", err)
+			}
+			self.Time(t)
+			continue
+		}
+		for _, vc := range c.ValueChanges() {
+			code, ok := codes[vc.GetIdCode()]
+			if !ok {
+				continue
+			}
+			value := vc.GetValue()
+			if vc.Encoding() == vcd.EncodingString {
+				if value, err = vc.VectorValueChange.VectorValueChange2.Text(); err != nil {
+					return fmt.Errorf("fst.Writer.WriteReader: %w", err)
+				}
+			}
+			self.Change(code, value)
+		}
+	}
+	return self.err
+}
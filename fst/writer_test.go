@@ -0,0 +1,309 @@
+package fst
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// seekBuffer is an io.WriteSeeker in memory.
+type seekBuffer struct {
+	b   []byte
+	pos int
+}
+
+func (self *seekBuffer) Write(p []byte) (int, error) {
+	if n := self.pos + len(p); n > len(self.b) {
+		self.b = append(self.b, make([]byte, n-len(self.b))...)
+	}
+	copy(self.b[self.pos:], p)
+	self.pos += len(p)
+	return len(p), nil
+}
+
+func (self *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		self.pos = int(offset)
+	case io.SeekCurrent:
+		self.pos += int(offset)
+	case io.SeekEnd:
+		self.pos = len(self.b) + int(offset)
+	}
+	return int64(self.pos), nil
+}
+
+// The id codes are those that the writers assign, and the changes at a time
+// are in the order of declaration, so that the file reads back the same.
+const writerTestVCD = `$date today $end
+$version Test 1.0 $end
+$timescale 10 ns $end
+$attrbegin misc 07 state_t 2 IDLE RUN 0 1 1 $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 8 " data[7:0] $end
+$attrbegin misc 07 1 $end
+$var logic 1 % state $end
+$scope vhdl_process p $end
+$var wire 1 ! clk $end
+$upscope $end
+$var real 64 & r $end
+$var string 1 ' s $end
+$var wire 1 ( late $end
+$upscope $end
+$enddefinitions $end
+#0
+0 !
+b00001111 "
+0 %
+r-2.25e-10 &
+#10
+1 !
+b1010xz10 "
+shello\x20world '
+#20
+0 !
+b11111111 "
+b00000000 "
+1 %
+r1.5 &
+#30
+1 !
+sbye '
+z (
+#40
+x !
+u (
+#50
+0 !
+b10101010 "
+`
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	expected := dump(t, vcd.NewReader(strings.NewReader(writerTestVCD)))
+	for _, size := range []int{1, 16, BlockSize} {
+		var b seekBuffer
+		w := NewWriter(&b)
+		w.blockSize = size
+		if err := w.WriteReader(vcd.NewReader(strings.NewReader(writerTestVCD))); err != nil {
+			t.Fatalf("block size %v: could not write: %v", size, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("block size %v: could not close: %v", size, err)
+		}
+		r := bytes.NewReader(b.b)
+		if !Is(r) {
+			t.Errorf("block size %v: not taken for an FST file", size)
+		}
+		if actual := dump(t, NewReader(r, r.Size())); actual != expected {
+			t.Errorf("block size %v:\nwant:\n%v\ngot:\n%v", size, expected, actual)
+		}
+		src := &source{r: r, size: r.Size()}
+		if _, err := src.scan(); err != nil {
+			t.Fatalf("block size %v: could not scan: %v", size, err)
+		}
+		if size == 1 && len(src.blocks) != 6 || size == BlockSize && len(src.blocks) != 1 {
+			t.Errorf("block size %v: %v blocks", size, len(src.blocks))
+		}
+	}
+}
+
+func TestWriterCreate(t *testing.T) {
+	t.Parallel()
+	name := filepath.Join(t.TempDir(), "test.fst")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("could not create: %v", err)
+	}
+	w.Timescale(1, "ps")
+	w.DeclareScope(vcd.ScopeKindModule, "top")
+	clk, _ := w.DeclareVar(vcd.VarKindWire, 1, "clk")
+	data, _ := w.DeclareVar(vcd.VarKindReg, 4, "data")
+	w.EndDefinitions()
+	w.Time(0)
+	w.Change(clk, "1")
+	// Extended as in VCD files.
+	w.Change(data, "z1")
+	w.Time(5)
+	w.Change(data, "1")
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	if !IsFile(name) {
+		t.Errorf("not taken for an FST file")
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer r.Close()
+	const expected = `$timescale 1 ps $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 4 " data $end
+$upscope $end
+$enddefinitions $end
+#0
+1 !
+bzzz1 "
+#5
+b0001 "
+`
+	if actual := dump(t, r); actual != expected {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", expected, actual)
+	}
+}
+
+// TestWriterLayout checks the header, geometry and hierarchy blocks byte by
+// byte, at the offsets and with the encodings that fstapi, GTKWave's FST
+// library, uses.
+func TestWriterLayout(t *testing.T) {
+	t.Parallel()
+	var b seekBuffer
+	w := NewWriter(&b)
+	w.Version("v1")
+	w.Date("d1")
+	w.Timescale(1, "ps")
+	w.DeclareScope(vcd.ScopeKindModule, "top")
+	clk, _ := w.DeclareVar(vcd.VarKindWire, 1, "clk")
+	w.DeclareVar(vcd.VarKindReg, 4, "data")
+	w.DeclareAlias(vcd.VarKindWire, 1, "clk2", clk)
+	w.Upscope()
+	w.EndDefinitions()
+	w.Time(3)
+	w.Change(clk, "1")
+	w.Time(7)
+	w.Change(clk, "0")
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+
+	// The offsets are fstapi's FST_HDR_OFFS_*.
+	u64 := func(off int) uint64 { return binary.BigEndian.Uint64(b.b[off:]) }
+	headerTests := []struct {
+		name     string
+		actual   any
+		expected any
+	}{
+		{"tag", b.b[0], byte(blockHeader)},
+		{"section length", u64(1), uint64(329)},
+		{"start time", u64(9), uint64(3)},
+		{"end time", u64(17), uint64(7)},
+		{"endian test", binary.LittleEndian.Uint64(b.b[25:]), math.Float64bits(math.E)},
+		{"scopes", u64(41), uint64(1)},
+		{"vars", u64(49), uint64(3)},
+		{"handles", u64(57), uint64(2)},
+		{"value blocks", u64(65), uint64(1)},
+		{"timescale", int8(b.b[73]), int8(-12)},
+		{"version", string(b.b[74:77]), "v1\x00"},
+		{"date", string(b.b[202:205]), "d1\x00"},
+		{"file type", b.b[321], byte(0)},
+		{"time zero", u64(322), uint64(0)},
+	}
+	for _, test := range headerTests {
+		if test.actual != test.expected {
+			t.Errorf("header %v: want: %v, got: %v", test.name, test.expected, test.actual)
+		}
+	}
+
+	// The blocks after the header, by type.
+	blocks := map[byte][]byte{}
+	for pos := 330; pos+9 <= len(b.b); {
+		n := int(u64(pos + 1))
+		blocks[b.b[pos]] = b.b[pos+9 : pos+1+n]
+		pos += 1 + n
+	}
+	// The uncompressed length, the number of handles, and the lengths.
+	geometry := []byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 2, 1, 4}
+	if actual := blocks[blockGeometry]; !bytes.Equal(actual, geometry) {
+		t.Errorf("geometry:\nwant: % x\ngot:  % x", geometry, actual)
+	}
+	hier := blocks[blockHierarchy]
+	if len(hier) < 8 {
+		t.Fatalf("no hierarchy block")
+	}
+	records, err := gunzip(hier[8:], binary.BigEndian.Uint64(hier))
+	if err != nil {
+		t.Fatalf("could not uncompress the hierarchy: %v", err)
+	}
+	// FST_ST_VCD_SCOPE, FST_ST_VCD_MODULE, the name and the component;
+	// the variables with their type, direction, name, length and alias;
+	// FST_ST_VCD_UPSCOPE.
+	expected := []byte("\xfe\x00top\x00\x00" +
+		"\x10\x00clk\x00\x01\x00" +
+		"\x05\x00data\x00\x04\x00" +
+		"\x10\x00clk2\x00\x01\x01" +
+		"\xff")
+	if !bytes.Equal(records, expected) {
+		t.Errorf("hierarchy:\nwant: % x\ngot:  % x", expected, records)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		write    func(w *Writer) error
+		expected string
+	}{
+		{"upscope", func(w *Writer) error { return w.Upscope() }, "no open scope"},
+		{"time in definitions", func(w *Writer) error { return w.Time(0) }, "time before the end"},
+		{"unknown code", func(w *Writer) error {
+			w.EndDefinitions()
+			return w.Change("1", "1")
+		}, "unknown id code"},
+		{"time goes backwards", func(w *Writer) error {
+			w.EndDefinitions()
+			w.Time(10)
+			return w.Time(5)
+		}, "time goes backwards"},
+		{"var after definitions", func(w *Writer) error {
+			w.EndDefinitions()
+			_, err := w.DeclareVar(vcd.VarKindWire, 1, "a")
+			return err
+		}, "variable after the definitions"},
+		{"alias of unknown code", func(w *Writer) error {
+			return w.DeclareAlias(vcd.VarKindWire, 1, "a", "1")
+		}, "unknown id code"},
+		{"bad vector", func(w *Writer) error {
+			c, _ := w.DeclareVar(vcd.VarKindWire, 2, "a")
+			w.EndDefinitions()
+			return w.Change(c, "12")
+		}, "not a vector value"},
+		{"bad real", func(w *Writer) error {
+			c, _ := w.DeclareVar(vcd.VarKindReal, 1, "a")
+			w.EndDefinitions()
+			return w.Change(c, "x")
+		}, "not a real value"},
+		{"port", func(w *Writer) error {
+			c, _ := w.DeclareVar(vcd.VarKindPort, 1, "a")
+			w.EndDefinitions()
+			return w.Change(c, "D")
+		}, "port values are not supported"},
+		{"bad timescale", func(w *Writer) error { return w.Timescale(2, "ns") }, "not 1, 10 or 100"},
+		{"sticky", func(w *Writer) error {
+			w.Upscope()
+			return w.Close()
+		}, "no open scope"},
+		{"closed", func(w *Writer) error {
+			w.Close()
+			return w.Time(0)
+		}, "closed"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			err := test.write(NewWriter(&seekBuffer{}))
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("want: %q, got: %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package ghw reads GHDL's GHW waveform files, which GHDL writes when run
+// with `--wave=file.ghw`. Unlike VCD files, GHW files keep the VHDL types of
+// the signals: enums, records, arrays and the nine values of std_logic.
+//
+// The contents of a GHW file come out as a vcd.Reader, so everything that
+// reads VCD files, such as cvt, reads GHW files as well. The types map onto
+// the declarations of VCD files as follows:
+//
+//   - Instances, blocks, generate statements, packages and processes are
+//     scopes of the vhdl_ kinds. The scope of an iteration of a for-generate
+//     is named after its index, as in `gen_3`.
+//   - Records are vhdl_record scopes, with a variable or scope per field.
+//   - One-dimensional arrays of bit and std_ulogic are vectors, such as
+//     `data[7:0]`. Other arrays have a variable per element, such as
+//     `mem[3]`, or a scope per element if the elements are records.
+//   - std_ulogic is a logic variable, and bit a bit variable.
+//   - Other enums, boolean among them, are logic variables whose values are
+//     the positions of the literals in binary, with an enum table that
+//     names them. See vcd.AttrT.
+//   - Integers and physical types are integer variables of 32 or 64 bits.
+//   - Floating point types are real variables.
+//
+// Signals that are connected through ports share their values, and come out
+// as variables with the same id code. The times are in fs.
+package ghw
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// magic starts every GHW file.
+const magic = "GHDLwave\n"
+
+// The kinds of the types, as GHDL numbers them in its run-time information.
+const (
+	kindB2            = 22
+	kindE8            = 23
+	kindI32           = 25
+	kindI64           = 26
+	kindF64           = 27
+	kindP32           = 28
+	kindP64           = 29
+	kindArray         = 31
+	kindRecord        = 32
+	kindSubtypeScalar = 34
+	kindSubtypeArray  = 35
+	kindSubtypeRecord = 38
+)
+
+// The kinds of the entries of the hierarchy.
+const (
+	hieEnd         = 0 // Of the hierarchy.
+	hieBlock       = 3
+	hieIfGenerate  = 4
+	hieForGenerate = 5
+	hieInstance    = 6
+	hiePackage     = 7
+	hieProcess     = 13
+	hieGeneric     = 14
+	hieEndScope    = 15
+	hieSignal      = 16
+	hiePortIn      = 17
+	hiePortOut     = 18
+	hiePortInout   = 19
+	hiePortBuffer  = 20
+	hiePortLinkage = 21
+)
+
+// scopeKinds are the VCD kinds of the scopes in the hierarchy.
+var scopeKinds = map[byte]vcd.ScopeKindCode{
+	hieBlock:       vcd.ScopeKindVHDLBlock,
+	hieIfGenerate:  vcd.ScopeKindVHDLIfGenerate,
+	hieForGenerate: vcd.ScopeKindVHDLForGenerate,
+	hieInstance:    vcd.ScopeKindVHDLArchitecture,
+	hiePackage:     vcd.ScopeKindVHDLPackage,
+	hieGeneric:     vcd.ScopeKindVHDLBlock,
+}
+
+// The well-known types, which GHDL marks as such.
+const (
+	wktBoolean   = 1
+	wktBit       = 2
+	wktStdUlogic = 3
+)
+
+// stdUlogic are the values of std_ulogic, "UX01ZWLH-", as VCD has them.
+const stdUlogic = "ux01zwlh-"
+
+// NewReader returns a Reader of the GHW file r. The file is read from start
+// to end, so r may be a pipe. Errors in the file come out of the Reader,
+// starting with Declarations.
+func NewReader(r io.Reader, opts ...vcd.ReaderOption) *vcd.Reader {
+	return vcd.NewSourceReader(newSource(r, nil), opts...)
+}
+
+// Open opens the named GHW file, which may be compressed as vcd.Open allows.
+// The name vcd.Stdin opens the standard input. Close the Reader when done
+// with it.
+func Open(name string, opts ...vcd.ReaderOption) (*vcd.Reader, error) {
+	f, err := vcd.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("ghw.Open: %w", err)
+	}
+	opts = append([]vcd.ReaderOption{vcd.WithFilename(name)}, opts...)
+	return vcd.NewSourceReader(newSource(f, f), opts...), nil
+}
+
+// Is reports whether r starts like a GHW file. It only peeks at r, so r can
+// be read from the start afterwards.
+func Is(r *bufio.Reader) bool {
+	b, err := r.Peek(len(magic))
+	return err == nil && bytes.Equal(b, []byte(magic))
+}
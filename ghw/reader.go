@@ -0,0 +1,624 @@
+package ghw
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// The ways in which the values of the signals of a variable make up its
+// value.
+const (
+	formatLogic  = iota // A std_ulogic character per signal.
+	formatBinary        // The value of each signal in binary.
+	formatReal          // The value of the only signal, a real number.
+)
+
+// source is the vcd.Source of a GHW file.
+type source struct {
+	s       stream
+	closer  io.Closer // Closed with the Reader, may be nil.
+	version byte
+
+	strs []string
+	typs []*typ
+	// By index, from the hierarchy. Index 0 is not a signal.
+	signals []signal
+
+	w      *vcd.Writer // Of the declarations.
+	vars   []*variable
+	alias  map[string]*variable // By the key of the signals of a variable.
+	tables map[*typ]int64       // The handles of the enum tables.
+
+	time  int64
+	cycle bool   // Within the cycles of a CYC section.
+	dirty []int  // The variables with signals that changed.
+	last  *int64 // The last timestamp handed out.
+	queue []*vcd.SimulationCommandT
+}
+
+// signal is a scalar signal, that variables refer to by its index.
+type signal struct {
+	typ   *typ   // Nil if the signal has no variable.
+	value uint64 // The bits of an int64 or a float64.
+	vars  []int  // The variables that have the signal.
+}
+
+// variable is a declared variable, with the signals that make up its value.
+type variable struct {
+	code    string
+	format  int
+	width   int // In formatBinary, of each signal.
+	signals []int
+	dirty   bool
+	last    *string // The last value handed out.
+}
+
+func newSource(r io.Reader, closer io.Closer) *source {
+	b, ok := r.(*bufio.Reader)
+	if !ok {
+		b = bufio.NewReaderSize(r, 1<<20)
+	}
+	return &source{s: stream{r: b}, closer: closer}
+}
+
+func (self *source) Close() error {
+	if self.closer == nil {
+		return nil
+	}
+	return self.closer.Close()
+}
+
+// Header reads the sections up to the end of the hierarchy, and returns the
+// declarations of the file as VCD text.
+func (self *source) Header() ([]byte, error) {
+	ret, err := self.header()
+	if err != nil {
+		return nil, fmt.Errorf("ghw: %w", err)
+	}
+	return ret, nil
+}
+
+func (self *source) header() ([]byte, error) {
+	s := &self.s
+	b := s.bytes(16)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if !bytes.HasPrefix(b, []byte(magic)) {
+		return nil, fmt.Errorf("not a GHW file")
+	}
+	if b[9] != 16 || b[10] != 0 || b[15] != 0 {
+		return nil, fmt.Errorf("bad header: % x", b)
+	}
+	if self.version = b[11]; self.version > 1 {
+		return nil, fmt.Errorf("unknown version: %v", self.version)
+	}
+	switch b[12] {
+	case 1:
+		s.order = binary.LittleEndian
+	case 2:
+		s.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unknown byte order: %v", b[12])
+	}
+
+	var ret bytes.Buffer
+	self.w = vcd.NewWriter(&ret)
+	self.w.Timescale(1, "fs")
+	self.alias = map[string]*variable{}
+	self.tables = map[*typ]int64{}
+	for {
+		tag := s.tag()
+		if s.err != nil {
+			return nil, s.err
+		}
+		var err error
+		switch tag {
+		case "STR":
+			err = self.strings()
+		case "TYP":
+			err = self.types()
+		case "WKT":
+			err = self.wellKnownTypes()
+		case "HIE":
+			err = self.hierarchy()
+		case "DIR", "TAI":
+			err = self.skip(tag)
+		case "EOH":
+			self.w.EndDefinitions()
+			if err := self.w.Flush(); err != nil {
+				return nil, err
+			}
+			self.w = nil
+			return ret.Bytes(), nil
+		default:
+			return nil, fmt.Errorf("unknown section: %q", tag)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v section: %w", tag, err)
+		}
+	}
+}
+
+// strings reads the STR section. Each string is written as the length of
+// the start that it shares with the string before it, and the rest.
+func (self *source) strings() error {
+	s := &self.s
+	s.bytes(4)
+	n := s.int32()
+	s.int32() // The total length.
+	self.strs = []string{"<anon>"}
+	shared := 0
+	for i := int32(0); i < n && s.err == nil; i++ {
+		prev := self.strs[len(self.strs)-1]
+		if i == 0 {
+			prev = ""
+		}
+		if shared > len(prev) {
+			return fmt.Errorf("string %v: shares %v bytes of %q", i+1, shared, prev)
+		}
+		b := []byte(prev[:shared])
+		c := s.byte()
+		// The end of the string tells the length of the start of the
+		// next one, in 5 bits per byte.
+		for ; s.err == nil && c > 31 && (c < 128 || c > 159); c = s.byte() {
+			b = append(b, c)
+		}
+		self.strs = append(self.strs, string(b))
+		shared = int(c & 0x1f)
+		for shift := 5; c >= 128 && s.err == nil; shift += 5 {
+			c = s.byte()
+			shared |= int(c&0x1f) << shift
+		}
+	}
+	s.expect("EOS")
+	return s.err
+}
+
+// strid reads a reference to a string.
+func (self *source) strid() string {
+	s := &self.s
+	id := s.uvarint()
+	if s.err != nil {
+		return ""
+	}
+	if id >= uint64(len(self.strs)) {
+		s.fail(fmt.Errorf("unknown string: %v", id))
+		return ""
+	}
+	return self.strs[id]
+}
+
+// skip skips the directory and the tailer, which tell where the sections
+// are in the file.
+func (self *source) skip(tag string) error {
+	s := &self.s
+	b := s.bytes(8)
+	if tag == "DIR" && s.err == nil {
+		n := int64(int32(s.order.Uint32(b[4:])))
+		if _, err := io.CopyN(io.Discard, s.r, 8*n); err != nil {
+			return err
+		}
+		s.expect("EOD")
+	}
+	return s.err
+}
+
+// hierarchy reads the HIE section, and declares the scopes and variables.
+func (self *source) hierarchy() error {
+	s := &self.s
+	s.bytes(4)
+	s.int32() // The numbers of scopes and of signals in them.
+	s.int32()
+	n := s.int32()
+	if s.err != nil {
+		return s.err
+	}
+	if n < 0 {
+		return fmt.Errorf("bad number of signals: %v", n)
+	}
+	self.signals = make([]signal, int(n)+1)
+	depth := 0
+	for {
+		kind := s.byte()
+		if s.err != nil {
+			return s.err
+		}
+		switch kind {
+		case hieEnd:
+			return nil
+		case hieEndScope:
+			if depth == 0 {
+				return fmt.Errorf("end of a scope outside of scopes")
+			}
+			depth--
+			self.w.Upscope()
+			continue
+		}
+		name := ident(self.strid())
+		switch kind {
+		case hieBlock, hieIfGenerate, hieForGenerate, hieInstance, hiePackage, hieGeneric:
+			if kind == hieForGenerate {
+				t := self.typeid()
+				if s.err != nil {
+					return s.err
+				}
+				v := int64(self.value(t.scalar()))
+				name = ident(name + "_" + strconv.FormatInt(v, 10))
+			}
+			self.w.DeclareScope(scopeKinds[kind], name)
+			depth++
+		case hieProcess:
+			self.w.DeclareScope(vcd.ScopeKindVHDLProcess, name)
+			self.w.Upscope()
+		case hieSignal, hiePortIn, hiePortOut, hiePortInout, hiePortBuffer, hiePortLinkage:
+			t := self.typeid()
+			if s.err != nil {
+				return s.err
+			}
+			if t.count < 0 {
+				return fmt.Errorf("signal of a type without bounds: %v", name)
+			}
+			sigs := make([]int, t.count)
+			for i := range sigs {
+				idx := s.uvarint()
+				if s.err == nil && (idx == 0 || idx >= uint64(len(self.signals))) {
+					return fmt.Errorf("signal %v: unknown index: %v", name, idx)
+				}
+				sigs[i] = int(idx)
+			}
+			if s.err != nil {
+				return s.err
+			}
+			if err := self.declare(name, t, sigs); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown kind of hierarchy entry: %v: %q", kind, name)
+		}
+		if s.err != nil {
+			return s.err
+		}
+	}
+}
+
+// ident returns name as an identifier of a VCD file, with the characters
+// that identifiers can not have replaced by `_`.
+func ident(name string) string {
+	ret := []byte(name)
+	for i, c := range ret {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			ret[i] = '_'
+		}
+	}
+	if len(ret) == 0 {
+		return "_"
+	}
+	return string(ret)
+}
+
+// declare declares the variables of the signal name of type t, whose
+// scalars are the signals sigs.
+func (self *source) declare(name string, t *typ, sigs []int) error {
+	switch t.kind {
+	case kindSubtypeArray:
+		if len(sigs) == 0 {
+			return nil
+		}
+		el := t.el.scalar()
+		if len(t.ranges) == 1 && (el.wkt == wktBit || el.wkt == wktStdUlogic) {
+			r := t.ranges[0]
+			return self.variable(fmt.Sprintf("%v[%v:%v]", name, r.left, r.right), el, sigs)
+		}
+		n := t.el.count
+		for i := 0; i*n < len(sigs); i++ {
+			if err := self.declare(name+indices(t.ranges, i), t.el, sigs[i*n:(i+1)*n]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case kindRecord, kindSubtypeRecord:
+		// The elements of arrays of records have their indices in the
+		// name of the scope, as in `regs_3`.
+		scope := ident(strings.ReplaceAll(name, "]", ""))
+		self.w.DeclareScope(vcd.ScopeKindVHDLRecord, scope)
+		i := 0
+		for _, f := range t.fields {
+			if err := self.declare(ident(f.name), f.typ, sigs[i:i+f.typ.count]); err != nil {
+				return err
+			}
+			i += f.typ.count
+		}
+		return self.w.Upscope()
+	}
+	return self.variable(name, t.scalar(), sigs)
+}
+
+// indices returns the indices of the i-th element of an array with the
+// given ranges, as in `[1][3]`. The last index changes the fastest.
+func indices(ranges []rng, i int) string {
+	ret := make([]string, len(ranges))
+	for d := len(ranges) - 1; d >= 0; d-- {
+		n := int(ranges[d].length())
+		ret[d] = fmt.Sprintf("[%v]", ranges[d].index(int64(i%n)))
+		i /= n
+	}
+	return strings.Join(ret, "")
+}
+
+// variable declares the variable name, whose value is made up of those of
+// sigs, which are of the scalar type t.
+func (self *source) variable(name string, t *typ, sigs []int) error {
+	v := &variable{format: formatBinary, width: 1, signals: sigs}
+	var kind vcd.VarKindCode
+	enum := false
+	switch t.kind {
+	case kindB2, kindE8:
+		switch t.wkt {
+		case wktStdUlogic:
+			kind, v.format = vcd.VarKindLogic, formatLogic
+		case wktBit:
+			kind = vcd.VarKindBit
+		default:
+			kind, v.width, enum = vcd.VarKindLogic, t.width(), true
+		}
+	case kindI32, kindP32:
+		kind, v.width = vcd.VarKindInteger, 32
+	case kindI64, kindP64:
+		kind, v.width = vcd.VarKindInteger, 64
+	case kindF64:
+		kind, v.format, v.width = vcd.VarKindReal, formatReal, 64
+	default:
+		return fmt.Errorf("variable of a %v: %v", t.kind, name)
+	}
+	for _, i := range sigs {
+		self.signals[i].typ = t
+	}
+	if enum {
+		h := self.enumTable(t)
+		self.w.Attr(vcd.AttrKindMisc, vcd.AttrMiscEnumTable, "", h)
+	}
+	size := v.width * len(sigs)
+	if v.format == formatReal {
+		size = v.width
+	}
+	key := fmt.Sprint(v.format, v.width, sigs)
+	if a, ok := self.alias[key]; ok {
+		return self.w.DeclareAlias(kind, size, name, a.code)
+	}
+	code, err := self.w.DeclareVar(kind, size, name)
+	if err != nil {
+		return err
+	}
+	v.code = code
+	self.alias[key] = v
+	for _, i := range sigs {
+		self.signals[i].vars = append(self.signals[i].vars, len(self.vars))
+	}
+	self.vars = append(self.vars, v)
+	return nil
+}
+
+// enumTable declares the enum table of the enum t, unless it was declared
+// already, and returns its handle.
+func (self *source) enumTable(t *typ) int64 {
+	if h, ok := self.tables[t]; ok {
+		return h
+	}
+	h := int64(len(self.tables) + 1)
+	self.tables[t] = h
+	words := []string{word(t.name), strconv.Itoa(len(t.lits))}
+	for _, l := range t.lits {
+		words = append(words, word(l))
+	}
+	for i := range t.lits {
+		words = append(words, binary64(uint64(i), t.width()))
+	}
+	self.w.Attr(vcd.AttrKindMisc, vcd.AttrMiscEnumTable, strings.Join(words, " "), h)
+	return h
+}
+
+// word returns s as a word of an attribute, with its whitespace replaced by
+// `_`, so that the character literal ' ' becomes '_'.
+func word(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// binary64 returns the low width bits of v in binary.
+func binary64(v uint64, width int) string {
+	b := strconv.FormatUint(v, 2)
+	if len(b) >= width {
+		return b[len(b)-width:]
+	}
+	return strings.Repeat("0", width-len(b)) + b
+}
+
+// value reads a value of the scalar type t.
+func (self *source) value(t *typ) uint64 {
+	s := &self.s
+	switch t.kind {
+	case kindB2, kindE8:
+		return uint64(s.byte())
+	case kindI32, kindP32, kindI64, kindP64:
+		return uint64(s.svarint())
+	case kindF64:
+		return math.Float64bits(s.float64())
+	}
+	s.fail(fmt.Errorf("value of a %v", t.kind))
+	return 0
+}
+
+// set reads the value of the signal with index i.
+func (self *source) set(i int) {
+	sig := &self.signals[i]
+	sig.value = self.value(sig.typ)
+	for _, v := range sig.vars {
+		if !self.vars[v].dirty {
+			self.vars[v].dirty = true
+			self.dirty = append(self.dirty, v)
+		}
+	}
+}
+
+// format returns the value of the variable v.
+func (self *source) format(v *variable) string {
+	if v.format == formatReal {
+		return strconv.FormatFloat(math.Float64frombits(self.signals[v.signals[0]].value), 'g', -1, 64)
+	}
+	var b strings.Builder
+	for _, i := range v.signals {
+		value := self.signals[i].value
+		switch {
+		case v.format == formatBinary:
+			b.WriteString(binary64(value, v.width))
+		case value < uint64(len(stdUlogic)):
+			b.WriteByte(stdUlogic[value])
+		default:
+			b.WriteByte('x')
+		}
+	}
+	return b.String()
+}
+
+// Next returns the next simulation command. The values are read one
+// snapshot or one cycle at a time.
+func (self *source) Next() (*vcd.SimulationCommandT, error) {
+	for len(self.queue) == 0 {
+		if err := self.step(); err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("ghw: %w", err)
+		}
+	}
+	ret := self.queue[0]
+	self.queue[0] = nil
+	self.queue = self.queue[1:]
+	return ret, nil
+}
+
+// step reads a snapshot of all values, or the values that changed in a
+// cycle, and queues the value changes.
+func (self *source) step() error {
+	s := &self.s
+	if self.cycle {
+		return self.nextCycle()
+	}
+	if _, err := s.r.Peek(1); err == io.EOF {
+		return io.EOF
+	}
+	switch tag := s.tag(); tag {
+	case "SNP":
+		s.bytes(4)
+		self.time = s.int64()
+		for i := range self.signals {
+			if self.signals[i].typ != nil && s.err == nil {
+				self.set(i)
+			}
+		}
+		s.expect("ESN")
+		if s.err != nil {
+			return fmt.Errorf("snapshot: %w", s.err)
+		}
+		self.emit()
+	case "CYC":
+		self.time = s.int64()
+		self.cycle = true
+		return self.nextCycle()
+	case "DIR", "TAI":
+		return self.skip(tag)
+	case "":
+		return s.err
+	default:
+		return fmt.Errorf("unknown section: %q", tag)
+	}
+	return nil
+}
+
+// nextCycle reads the values that changed in a cycle, and the time of the
+// next cycle. Each change is preceded by the number of signals up to the
+// signal that changed, not counting those without variables.
+func (self *source) nextCycle() error {
+	s := &self.s
+	i := 0
+	for {
+		d := s.uvarint()
+		if d == 0 || s.err != nil {
+			break
+		}
+		for ; d > 0; d-- {
+			for i++; i < len(self.signals) && self.signals[i].typ == nil; i++ {
+			}
+		}
+		if i >= len(self.signals) {
+			return fmt.Errorf("cycle at %v: signal out of range", self.time)
+		}
+		self.set(i)
+	}
+	if s.err != nil {
+		return fmt.Errorf("cycle at %v: %w", self.time, s.err)
+	}
+	self.emit()
+	switch d := s.svarint(); {
+	case s.err != nil:
+	case d == -1:
+		self.cycle = false
+		s.expect("ECY")
+	case d < 0:
+		return fmt.Errorf("cycle at %v: time goes backwards by %v", self.time, -d)
+	default:
+		self.time += d
+	}
+	if s.err != nil {
+		return fmt.Errorf("cycle at %v: %w", self.time, s.err)
+	}
+	return nil
+}
+
+// emit queues the changes of the variables whose signals changed, in the
+// order of the declarations, after the current time.
+func (self *source) emit() {
+	sort.Ints(self.dirty)
+	for _, i := range self.dirty {
+		v := self.vars[i]
+		v.dirty = false
+		value := self.format(v)
+		if v.last != nil && *v.last == value {
+			continue
+		}
+		v.last = &value
+		if self.last == nil || *self.last != self.time {
+			t := self.time
+			self.last = &t
+			self.queue = append(self.queue, &vcd.SimulationCommandT{
+				SimulationTime: &vcd.SimulationTimeT{DecimalNumber: "#" + strconv.FormatInt(t, 10)},
+			})
+		}
+		e := vcd.EncodingVector
+		if v.format == formatReal {
+			e = vcd.EncodingReal
+		}
+		self.queue = append(self.queue, &vcd.SimulationCommandT{ValueChange: vcd.NewValueChange(v.code, value, e)})
+	}
+	self.dirty = self.dirty[:0]
+}
@@ -0,0 +1,459 @@
+package ghw
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// encoder writes GHW files, as far as the tests need them. Strings are
+// referred to by their text.
+type encoder struct {
+	bytes.Buffer
+	strs []string
+}
+
+func (self *encoder) i32(v int32) {
+	binary.Write(self, binary.LittleEndian, v)
+}
+
+func (self *encoder) i64(v int64) {
+	binary.Write(self, binary.LittleEndian, v)
+}
+
+func (self *encoder) f64(v float64) {
+	binary.Write(self, binary.LittleEndian, math.Float64bits(v))
+}
+
+func (self *encoder) uvarint(v uint64) {
+	self.Write(binary.AppendUvarint(nil, v))
+}
+
+func (self *encoder) svarint(v int64) {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			self.WriteByte(c)
+			return
+		}
+		self.WriteByte(c | 0x80)
+	}
+}
+
+func (self *encoder) tag(t string) {
+	self.WriteString(t)
+	self.WriteByte(0)
+}
+
+// str writes a reference to the string s.
+func (self *encoder) str(s string) {
+	for i, e := range self.strs {
+		if e == s {
+			self.uvarint(uint64(i + 1))
+			return
+		}
+	}
+	panic("unknown string: " + s)
+}
+
+// strings writes the STR section. Each string shares what it can of the
+// string before it.
+func (self *encoder) strings(strs ...string) {
+	self.strs = strs
+	self.tag("STR")
+	self.i32(0)
+	self.i32(int32(len(strs)))
+	self.i32(0)
+	for i, s := range strs {
+		shared := 0
+		if i > 0 {
+			for shared < len(s) && shared < len(strs[i-1]) && s[shared] == strs[i-1][shared] {
+				shared++
+			}
+		}
+		self.WriteString(s[min(shared, len(s)):])
+		next := 0
+		if i+1 < len(strs) {
+			for n := strs[i+1]; next < len(n) && next < len(s) && n[next] == s[next]; next++ {
+			}
+		}
+		// The end of a string is the shared length of the next one.
+		for c := next; ; c >>= 5 {
+			if c < 32 {
+				self.WriteByte(byte(c))
+				break
+			}
+			self.WriteByte(byte(c&0x1f) | 0x80)
+		}
+	}
+	self.tag("EOS")
+}
+
+func (self *encoder) header(version byte) {
+	self.WriteString(magic)
+	self.Write([]byte{16, 0, version, 1, 4, 8, 0})
+}
+
+// Types, by their ids.
+const (
+	tStdUlogic = iota + 1
+	tBit
+	tBoolean
+	tInteger
+	tReal
+	tState
+	tNatural
+	tVector
+	tVector4
+	tRec
+	tMem
+	tMem2
+	tRegs
+	tRegs2
+	tTime
+)
+
+// testFile returns a GHW file with most kinds of types and hierarchy. Its
+// contents are testVCD.
+func testFile() []byte {
+	var e encoder
+	e.header(1)
+	e.strings("std_ulogic", "'U'", "'X'", "'0'", "'1'", "'Z'", "'W'", "'L'", "'H'", "'-'",
+		"bit", "boolean", "false", "true", "integer", "real", "state_t", "idle", "run", "wait",
+		"natural", "std_ulogic_vector", "rec_t", "a", "b", "mem_t", "regs_t", "time", "fs",
+		"top", "clk", "data", "state", "r", "x", "mem", "regs", "flag", "t", "p", "gen", "clk2",
+		"my signal")
+
+	e.tag("TYP")
+	e.i32(0)
+	e.i32(tTime)
+	e.WriteByte(kindE8)
+	e.str("std_ulogic")
+	e.uvarint(9)
+	for _, l := range []string{"'U'", "'X'", "'0'", "'1'", "'Z'", "'W'", "'L'", "'H'", "'-'"} {
+		e.str(l)
+	}
+	e.WriteByte(kindB2)
+	e.str("bit")
+	e.uvarint(2)
+	e.str("'0'")
+	e.str("'1'")
+	e.WriteByte(kindB2)
+	e.str("boolean")
+	e.uvarint(2)
+	e.str("false")
+	e.str("true")
+	e.WriteByte(kindI32)
+	e.str("integer")
+	e.WriteByte(kindF64)
+	e.str("real")
+	e.WriteByte(kindE8)
+	e.str("state_t")
+	e.uvarint(3)
+	e.str("idle")
+	e.str("run")
+	e.str("wait")
+	e.WriteByte(kindSubtypeScalar)
+	e.str("natural")
+	e.uvarint(tInteger)
+	e.WriteByte(kindI32)
+	e.svarint(0)
+	e.svarint(math.MaxInt32)
+	e.WriteByte(kindArray)
+	e.str("std_ulogic_vector")
+	e.uvarint(tStdUlogic)
+	e.uvarint(1)
+	e.uvarint(tNatural)
+	e.WriteByte(kindSubtypeArray)
+	e.uvarint(0) // Anonymous.
+	e.uvarint(tVector)
+	e.WriteByte(kindI32 | 0x80)
+	e.svarint(3)
+	e.svarint(0)
+	e.WriteByte(kindRecord)
+	e.str("rec_t")
+	e.uvarint(2)
+	e.str("a")
+	e.uvarint(tStdUlogic)
+	e.str("b")
+	e.uvarint(tState)
+	e.WriteByte(kindArray)
+	e.str("mem_t")
+	e.uvarint(tInteger)
+	e.uvarint(1)
+	e.uvarint(tNatural)
+	e.WriteByte(kindSubtypeArray)
+	e.uvarint(0)
+	e.uvarint(tMem)
+	e.WriteByte(kindI32)
+	e.svarint(0)
+	e.svarint(1)
+	e.WriteByte(kindArray)
+	e.str("regs_t")
+	e.uvarint(tRec)
+	e.uvarint(1)
+	e.uvarint(tNatural)
+	e.WriteByte(kindSubtypeArray)
+	e.uvarint(0)
+	e.uvarint(tRegs)
+	e.WriteByte(kindI32)
+	e.svarint(0)
+	e.svarint(1)
+	e.WriteByte(kindP64)
+	e.str("time")
+	e.uvarint(1)
+	e.str("fs")
+	e.svarint(1)
+	e.WriteByte(0)
+
+	e.tag("WKT")
+	e.i32(0)
+	e.Write([]byte{wktStdUlogic, tStdUlogic, wktBit, tBit, wktBoolean, tBoolean, 0})
+
+	e.tag("HIE")
+	e.i32(0)
+	e.i32(3)
+	e.i32(11)
+	e.i32(19)
+	signal := func(kind byte, name string, t int, sigs ...int) {
+		e.WriteByte(kind)
+		e.str(name)
+		e.uvarint(uint64(t))
+		for _, s := range sigs {
+			e.uvarint(uint64(s))
+		}
+	}
+	e.WriteByte(hieInstance)
+	e.str("top")
+	signal(hieSignal, "clk", tStdUlogic, 1)
+	signal(hiePortIn, "data", tVector4, 2, 3, 4, 5)
+	signal(hieSignal, "state", tState, 6)
+	signal(hieSignal, "r", tRec, 7, 8)
+	signal(hieSignal, "x", tReal, 9)
+	signal(hieSignal, "mem", tMem2, 10, 11)
+	signal(hieSignal, "regs", tRegs2, 12, 13, 14, 15)
+	signal(hieSignal, "flag", tBoolean, 16)
+	signal(hieSignal, "b", tBit, 17)
+	signal(hieSignal, "t", tTime, 18)
+	signal(hieSignal, "my signal", tBit, 19)
+	e.WriteByte(hieProcess)
+	e.str("p")
+	e.WriteByte(hieForGenerate)
+	e.str("gen")
+	e.uvarint(tInteger)
+	e.svarint(2)
+	signal(hieSignal, "clk2", tStdUlogic, 1)
+	e.WriteByte(hieEndScope)
+	e.WriteByte(hieEndScope)
+	e.WriteByte(hieEnd)
+	e.tag("EOH")
+
+	e.tag("SNP")
+	e.i32(0)
+	e.i64(0)
+	e.Write([]byte{0, 6, 7, 2, 8, 1, 3, 2})
+	e.f64(1.5)
+	e.svarint(5)
+	e.svarint(-1)
+	e.Write([]byte{2, 0, 3, 1, 1, 0})
+	e.svarint(1000000)
+	e.WriteByte(1)
+	e.tag("ESN")
+
+	e.tag("CYC")
+	e.i64(10)
+	e.uvarint(1) // clk
+	e.WriteByte(3)
+	e.uvarint(5) // state
+	e.WriteByte(2)
+	e.uvarint(0)
+	e.svarint(5)
+	e.uvarint(9) // x
+	e.f64(2.5)
+	e.uvarint(1) // mem[0], to the same value.
+	e.svarint(5)
+	e.uvarint(0)
+	e.svarint(10)
+	e.uvarint(10) // mem[0]
+	e.svarint(6)
+	e.uvarint(0)
+	e.svarint(-1)
+	e.tag("ECY")
+
+	e.tag("DIR")
+	e.i32(0)
+	e.i32(1)
+	e.Write(make([]byte, 8))
+	e.tag("EOD")
+	e.tag("TAI")
+	e.Write(make([]byte, 8))
+	return e.Bytes()
+}
+
+const testVCD = `$timescale 1 fs $end
+$scope vhdl_architecture top $end
+$var logic 1 ! clk $end
+$var logic 4 " data[3:0] $end
+$attrbegin misc 07 state_t 3 idle run wait 00 01 10 1 $end
+$attrbegin misc 07 1 $end
+$var logic 2 % state $end
+$scope vhdl_record r $end
+$var logic 1 & a $end
+$attrbegin misc 07 1 $end
+$var logic 2 ' b $end
+$upscope $end
+$var real 64 ( x $end
+$var integer 32 ) mem[0] $end
+$var integer 32 * mem[1] $end
+$scope vhdl_record regs_0 $end
+$var logic 1 + a $end
+$attrbegin misc 07 1 $end
+$var logic 2 , b $end
+$upscope $end
+$scope vhdl_record regs_1 $end
+$var logic 1 - a $end
+$attrbegin misc 07 1 $end
+$var logic 2 . b $end
+$upscope $end
+$attrbegin misc 07 boolean 2 false true 0 1 2 $end
+$attrbegin misc 07 2 $end
+$var logic 1 / flag $end
+$var bit 1 0 b $end
+$var integer 64 1 t $end
+$var bit 1 2 my_signal $end
+$scope vhdl_process p $end
+$upscope $end
+$scope vhdl_for_generate gen_2 $end
+$var logic 1 ! clk2 $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+u !
+blh0- "
+b01 %
+1 &
+b10 '
+r1.5 (
+b00000000000000000000000000000101 )
+b11111111111111111111111111111111 *
+0 +
+b00 ,
+1 -
+b01 .
+1 /
+0 0
+b0000000000000000000000000000000000000000000011110100001001000000 1
+1 2
+#10
+1 !
+b10 %
+#15
+r2.5 (
+#25
+b00000000000000000000000000000110 )
+`
+
+func dump(t *testing.T, r *vcd.Reader) string {
+	t.Helper()
+	f, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	var b bytes.Buffer
+	w := vcd.NewWriter(&b)
+	w.WriteFile(f)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	return b.String()
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+	data := testFile()
+	if !Is(bufio.NewReader(bytes.NewReader(data))) {
+		t.Errorf("not taken for a GHW file")
+	}
+	if Is(bufio.NewReader(strings.NewReader(testVCD))) {
+		t.Errorf("VCD text taken for a GHW file")
+	}
+	if actual := dump(t, NewReader(bytes.NewReader(data))); actual != testVCD {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", testVCD, actual)
+	}
+}
+
+func TestReaderHeader(t *testing.T) {
+	t.Parallel()
+	h, err := NewReader(bytes.NewReader(testFile())).Header()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	state := h.Hierarchy.Var("/top/r/b")
+	if state == nil || state.EnumTable == nil {
+		t.Fatalf("no enum table of /top/r/b: %+v", state)
+	}
+	if name, ok := state.EnumTable.Lookup(vcd.MustParseValue("10")); !ok || name != "wait" {
+		t.Errorf("want: wait, got: %q", name)
+	}
+	if v := h.Hierarchy.Var("/top/gen_2/clk2"); v == nil || v.Code != h.Hierarchy.Var("/top/clk").Code {
+		t.Errorf("want an alias of /top/clk, got: %+v", v)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	z := gzip.NewWriter(&b)
+	z.Write(testFile())
+	z.Close()
+	name := filepath.Join(t.TempDir(), "test.ghw.gz")
+	if err := os.WriteFile(name, b.Bytes(), 0o644); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer r.Close()
+	if actual := dump(t, r); actual != testVCD {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", testVCD, actual)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	t.Parallel()
+	data := testFile()
+	hie := bytes.Index(data, []byte("HIE\x00"))
+	snp := bytes.Index(data, []byte("SNP\x00"))
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"not ghw", []byte("$date today $end\n$enddefinitions $end\n"), "not a GHW file"},
+		{"version", append(append([]byte(magic), 16, 0, 2), data[12:]...), "unknown version"},
+		{"byte order", append(append([]byte(magic), 16, 0, 1, 3), data[13:]...), "unknown byte order"},
+		{"truncated header", data[:hie+20], "unexpected EOF"},
+		{"unknown section", append(append([]byte{}, data[:hie]...), "FOO\x00"...), "unknown section"},
+		{"truncated values", data[:snp+20], "snapshot"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(test.data)).ReadAll()
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("want: %q, got: %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package ghw
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+	"github.com/filmil/go-vcd-parser/wave"
+)
+
+// samples returns the names of the GHW files in testdata that have a VCD
+// file next to them, from the same run of GHDL. See testdata/README.md for
+// how to make them.
+func samples(t *testing.T) []string {
+	t.Helper()
+	names, err := filepath.Glob("testdata/*.ghw")
+	if err != nil {
+		t.Fatalf("could not list the samples: %v", err)
+	}
+	var ret []string
+	for _, name := range names {
+		if _, err := os.Stat(vcdName(name)); err == nil {
+			ret = append(ret, name)
+		}
+	}
+	if len(ret) == 0 {
+		t.Skip("no GHW files with VCD files in testdata, see testdata/README.md")
+	}
+	return ret
+}
+
+func vcdName(name string) string {
+	return strings.TrimSuffix(name, ".ghw") + ".vcd"
+}
+
+// changes returns the value changes of the signal, one per line. Bits are
+// in lower case, and vectors are extended to their full width, as VCD
+// writers leave out leading zeros.
+func changes(s *wave.Signal) []string {
+	var ret []string
+	for i := range s.Len() {
+		v := s.Value(i)
+		if b, err := vcd.ParseValue(v); err == nil {
+			if s.Size > 1 {
+				b = b.Extend(s.Size)
+			}
+			v = b.String()
+		}
+		ret = append(ret, fmt.Sprintf("#%v %v", s.Time(i), v))
+	}
+	return ret
+}
+
+// compareGHDL checks that the GHW file ghwName has the value changes of the
+// VCD file vcdName, and returns it. GHDL leaves the signals of types that VCD
+// cannot show out of its VCD files, so only the signals in those are
+// compared.
+func compareGHDL(t *testing.T, ghwName, vcdName string) *wave.Store {
+	t.Helper()
+	f, err := vcd.Open(vcdName)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer f.Close()
+	expected, err := wave.Load(vcd.NewReader(f))
+	if err != nil {
+		t.Fatalf("could not read the VCD file: %v", err)
+	}
+	r, err := Open(ghwName)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	defer r.Close()
+	actual, err := wave.Load(r)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if e, a := expected.Timescale(), actual.Timescale(); !reflect.DeepEqual(e, a) {
+		t.Errorf("timescale: want: %v, got: %v", e, a)
+	}
+	for _, v := range expected.Hierarchy().Vars() {
+		e, a := expected.Lookup(v.Path), actual.Lookup(v.Path)
+		if a == nil {
+			t.Errorf("missing variable: %v", v.Path)
+			continue
+		}
+		if ec, ac := changes(e), changes(a); !reflect.DeepEqual(ec, ac) {
+			t.Errorf("changes of %v:\nwant:\n%v\ngot:\n%v",
+				v.Path, strings.Join(ec, "\n"), strings.Join(ac, "\n"))
+		}
+	}
+	return actual
+}
+
+// TestReaderSamples checks that the GHW files that GHDL wrote have the
+// value changes of the VCD files that it wrote in the same runs.
+func TestReaderSamples(t *testing.T) {
+	t.Parallel()
+	for _, name := range samples(t) {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			compareGHDL(t, name, vcdName(name))
+		})
+	}
+}
+
+// TestReaderGHDL runs testdata/tb.vhdl with GHDL, which writes a GHW and a
+// VCD file of it, and checks that they have the same value changes. The
+// enumeration, the record and the array are only in the GHW file, so they
+// are checked against the testbench. Skips if GHDL is not installed.
+func TestReaderGHDL(t *testing.T) {
+	t.Parallel()
+	ghdl, err := exec.LookPath("ghdl")
+	if err != nil {
+		t.Skip("ghdl is not installed, see testdata/README.md")
+	}
+	src, err := os.ReadFile("testdata/tb.vhdl")
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tb.vhdl"), src, 0o644); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	for _, args := range [][]string{
+		{"-a", "tb.vhdl"},
+		{"-e", "tb"},
+		{"-r", "tb", "--wave=tb.ghw", "--vcd=tb.vcd", "--stop-time=50ns"},
+	} {
+		cmd := exec.Command(ghdl, args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("ghdl %v: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	actual := compareGHDL(t, filepath.Join(dir, "tb.ghw"), filepath.Join(dir, "tb.vcd"))
+
+	const ns = 1000000 // In the femtoseconds of GHW files.
+	word := func(v int32) string {
+		return fmt.Sprintf("%032b", uint32(v))
+	}
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"/tb/state", []string{"#0 00", fmt.Sprintf("#%v 01", 10*ns), fmt.Sprintf("#%v 10", 30*ns)}},
+		{"/tb/r/a", []string{"#0 0", fmt.Sprintf("#%v 1", 10*ns)}},
+		{"/tb/r/b[1:0]", []string{"#0 00", fmt.Sprintf("#%v 01", 10*ns), fmt.Sprintf("#%v lh", 20*ns)}},
+		{"/tb/mem[0]", []string{"#0 " + word(0), fmt.Sprintf("#%v %v", 10*ns, word(5))}},
+		{"/tb/mem[1]", []string{"#0 " + word(0), fmt.Sprintf("#%v %v", 10*ns, word(-1)), fmt.Sprintf("#%v %v", 20*ns, word(7))}},
+	}
+	for _, test := range tests {
+		s := actual.Lookup(test.path)
+		if s == nil {
+			t.Errorf("missing variable: %v", test.path)
+			continue
+		}
+		if ac := changes(s); !reflect.DeepEqual(test.expected, ac) {
+			t.Errorf("changes of %v:\nwant:\n%v\ngot:\n%v",
+				test.path, strings.Join(test.expected, "\n"), strings.Join(ac, "\n"))
+		}
+	}
+}
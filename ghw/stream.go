@@ -0,0 +1,138 @@
+package ghw
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// errCorrupt is the error of reads past the end of a section.
+var errCorrupt = errors.New("corrupt file")
+
+// stream reads the fields of a GHW file one by one. The first failure is
+// kept in err, and all reads after it return zero values.
+type stream struct {
+	r     *bufio.Reader
+	order binary.ByteOrder // Of the fixed size fields, from the header.
+	err   error
+}
+
+func (self *stream) fail(err error) {
+	if self.err == nil {
+		self.err = err
+	}
+}
+
+func (self *stream) bytes(n int) []byte {
+	if self.err != nil {
+		return nil
+	}
+	ret := make([]byte, n)
+	if _, err := io.ReadFull(self.r, ret); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		self.fail(err)
+		return nil
+	}
+	return ret
+}
+
+func (self *stream) byte() byte {
+	if self.err != nil {
+		return 0
+	}
+	ret, err := self.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		self.fail(err)
+		return 0
+	}
+	return ret
+}
+
+// tag reads the tag of a section, such as `HIE`.
+func (self *stream) tag() string {
+	b := self.bytes(4)
+	if b == nil {
+		return ""
+	}
+	if b[3] != 0 {
+		self.fail(fmt.Errorf("bad section tag: %q", b))
+		return ""
+	}
+	return string(b[:3])
+}
+
+// expect reads the tag that ends a section.
+func (self *stream) expect(tag string) {
+	if t := self.tag(); self.err == nil && t != tag {
+		self.fail(fmt.Errorf("expected %q, got: %q", tag, t))
+	}
+}
+
+func (self *stream) int32() int32 {
+	if b := self.bytes(4); b != nil {
+		return int32(self.order.Uint32(b))
+	}
+	return 0
+}
+
+func (self *stream) int64() int64 {
+	if b := self.bytes(8); b != nil {
+		return int64(self.order.Uint64(b))
+	}
+	return 0
+}
+
+// float64 reads a double in the byte order of the writer.
+func (self *stream) float64() float64 {
+	if b := self.bytes(8); b != nil {
+		return math.Float64frombits(self.order.Uint64(b))
+	}
+	return 0
+}
+
+// uvarint reads an unsigned LEB128 number.
+func (self *stream) uvarint() uint64 {
+	if self.err != nil {
+		return 0
+	}
+	ret, err := binary.ReadUvarint(self.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		self.fail(err)
+		return 0
+	}
+	return ret
+}
+
+// svarint reads a signed LEB128 number. Unlike binary.Varint, it is not
+// zig-zag encoded.
+func (self *stream) svarint() int64 {
+	var ret int64
+	var shift uint
+	for {
+		b := self.byte()
+		if self.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			ret |= int64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				ret |= -1 << shift
+			}
+			return ret
+		}
+	}
+}
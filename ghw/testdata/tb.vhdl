@@ -0,0 +1,44 @@
+-- The testbench of TestReaderGHDL, which runs it with GHDL. It has signals
+-- of std_logic, std_logic_vector, an enumeration, a record and an array.
+library ieee;
+use ieee.std_logic_1164.all;
+
+entity tb is
+end tb;
+
+architecture sim of tb is
+  type state_t is (idle, run, done);
+  type pair_t is record
+    a : std_logic;
+    b : std_logic_vector(1 downto 0);
+  end record;
+  type mem_t is array (0 to 1) of integer;
+
+  signal clk   : std_logic := '0';
+  signal data  : std_logic_vector(3 downto 0) := "0000";
+  signal state : state_t := idle;
+  signal r     : pair_t := ('0', "00");
+  signal mem   : mem_t := (0, 0);
+  signal count : integer := 0;
+begin
+  clk <= not clk after 5 ns when now < 40 ns;
+
+  stim : process
+  begin
+    wait for 10 ns;
+    data <= "1010";
+    state <= run;
+    r <= ('1', "01");
+    mem <= (5, -1);
+    count <= 1;
+    wait for 10 ns;
+    data <= "XZ-U";
+    r.b <= "LH";
+    mem(1) <= 7;
+    count <= 2;
+    wait for 10 ns;
+    data <= "WHL0";
+    state <= done;
+    wait;
+  end process;
+end sim;
@@ -0,0 +1,275 @@
+package ghw
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// typ is a VHDL type or subtype.
+type typ struct {
+	kind byte
+	name string
+	wkt  byte     // The well-known type that this is, 0 if none.
+	lits []string // Of enums.
+	base *typ     // Of subtypes, the type of which this is a subtype.
+	// Of arrays, the types of the elements and of the indices. Subtypes of
+	// arrays have the type of the elements with bounds.
+	el   *typ
+	dims []*typ
+	// Of subtypes of arrays, the ranges of the indices.
+	ranges []rng
+	fields []field // Of records and their subtypes.
+	// count is the number of scalar signals of a signal of the type, or -1
+	// if the type has no bounds.
+	count int
+}
+
+// rng is the range of a scalar subtype, such as `7 downto 0`.
+type rng struct {
+	left, right int64
+	downto      bool
+}
+
+type field struct {
+	name string
+	typ  *typ
+}
+
+// length returns the number of values in the range.
+func (self rng) length() int64 {
+	switch {
+	case !self.downto && self.right >= self.left:
+		return self.right - self.left + 1
+	case self.downto && self.left >= self.right:
+		return self.left - self.right + 1
+	}
+	return 0
+}
+
+// index returns the i-th value of the range, counting from the left.
+func (self rng) index(i int64) int64 {
+	if self.downto {
+		return self.left - i
+	}
+	return self.left + i
+}
+
+// scalar returns the type of which a scalar subtype is a subtype.
+func (self *typ) scalar() *typ {
+	for self.kind == kindSubtypeScalar {
+		self = self.base
+	}
+	return self
+}
+
+// width returns the number of bits of the binary values of the enum.
+func (self *typ) width() int {
+	return max(1, bits.Len(uint(len(self.lits)-1)))
+}
+
+// types reads the TYP section.
+func (self *source) types() error {
+	s := &self.s
+	s.bytes(4)
+	n := s.int32()
+	for i := int32(0); i < n && s.err == nil; i++ {
+		t, err := self.readType()
+		if err != nil {
+			return fmt.Errorf("type %v: %w", i+1, err)
+		}
+		self.typs = append(self.typs, t)
+	}
+	if b := s.byte(); s.err == nil && b != 0 {
+		return fmt.Errorf("expected the end of the types, got: %v", b)
+	}
+	return s.err
+}
+
+// readType reads the declaration of a type.
+func (self *source) readType() (*typ, error) {
+	s := &self.s
+	ret := &typ{kind: s.byte(), count: 1}
+	ret.name = self.strid()
+	switch ret.kind {
+	case kindB2, kindE8:
+		n := s.uvarint()
+		for i := uint64(0); i < n && s.err == nil; i++ {
+			ret.lits = append(ret.lits, self.strid())
+		}
+		if len(ret.lits) == 0 && s.err == nil {
+			return nil, fmt.Errorf("enum without literals: %v", ret.name)
+		}
+	case kindI32, kindI64, kindF64:
+	case kindP32, kindP64:
+		if self.version >= 1 {
+			n := s.uvarint()
+			for i := uint64(0); i < n && s.err == nil; i++ {
+				self.strid() // The name and the value of a unit.
+				s.svarint()
+			}
+		}
+	case kindSubtypeScalar:
+		if ret.base = self.typeid(); s.err == nil {
+			self.rng()
+		}
+	case kindArray:
+		ret.el = self.typeid()
+		n := s.uvarint()
+		for i := uint64(0); i < n && s.err == nil; i++ {
+			ret.dims = append(ret.dims, self.typeid())
+		}
+		ret.count = -1
+	case kindSubtypeArray:
+		if base := self.typeid(); s.err == nil {
+			return ret, self.arraySubtype(ret, base)
+		}
+	case kindRecord:
+		ret.count = 0
+		n := s.uvarint()
+		for i := uint64(0); i < n && s.err == nil; i++ {
+			f := field{name: self.strid(), typ: self.typeid()}
+			if s.err != nil {
+				break
+			}
+			ret.fields = append(ret.fields, f)
+			if ret.count >= 0 && f.typ.count >= 0 {
+				ret.count += f.typ.count
+			} else {
+				ret.count = -1
+			}
+		}
+	case kindSubtypeRecord:
+		if base := self.typeid(); s.err == nil {
+			return ret, self.recordSubtype(ret, base)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind of type: %v", ret.kind)
+	}
+	return ret, s.err
+}
+
+// arraySubtype reads the bounds of the subtype t of the array type base.
+// The bounds of the elements follow if the type of the elements has none.
+func (self *source) arraySubtype(t, base *typ) error {
+	s := &self.s
+	for base.kind == kindSubtypeArray {
+		base = base.base
+	}
+	if base.kind != kindArray {
+		return fmt.Errorf("array subtype of a %v: %v", base.kind, t.name)
+	}
+	t.kind, t.base, t.el = kindSubtypeArray, base, base.el
+	count := int64(1)
+	for range base.dims {
+		r := self.rng()
+		t.ranges = append(t.ranges, r)
+		count *= r.length()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if t.el.count < 0 {
+		el, err := self.bounds(t.el)
+		if err != nil {
+			return err
+		}
+		t.el = el
+	}
+	if count*int64(t.el.count) > math.MaxInt32 {
+		return fmt.Errorf("array too large: %v", t.name)
+	}
+	t.count = int(count) * t.el.count
+	return nil
+}
+
+// recordSubtype reads the bounds of the subtype t of the record type base.
+// The bounds of the fields that have none follow, if any.
+func (self *source) recordSubtype(t, base *typ) error {
+	if base.kind == kindSubtypeRecord {
+		base = base.base
+	}
+	if base.kind != kindRecord {
+		return fmt.Errorf("record subtype of a %v: %v", base.kind, t.name)
+	}
+	t.kind, t.base = kindSubtypeRecord, base
+	if base.count >= 0 {
+		t.fields, t.count = base.fields, base.count
+		return nil
+	}
+	t.count = 0
+	for _, f := range base.fields {
+		if f.typ.count < 0 {
+			ft, err := self.bounds(f.typ)
+			if err != nil {
+				return err
+			}
+			f.typ = ft
+		}
+		t.fields = append(t.fields, f)
+		t.count += f.typ.count
+	}
+	return nil
+}
+
+// bounds reads the bounds of a subtype of t, which has none.
+func (self *source) bounds(t *typ) (*typ, error) {
+	ret := &typ{name: t.name}
+	switch t.kind {
+	case kindArray, kindSubtypeArray:
+		return ret, self.arraySubtype(ret, t)
+	case kindRecord, kindSubtypeRecord:
+		return ret, self.recordSubtype(ret, t)
+	}
+	return nil, fmt.Errorf("bounds of a %v: %v", t.kind, t.name)
+}
+
+// rng reads a range. The ranges of floating point types are read, but are
+// empty.
+func (self *source) rng() rng {
+	s := &self.s
+	b := s.byte()
+	ret := rng{downto: b&0x80 != 0}
+	switch kind := b & 0x7f; kind {
+	case kindB2, kindE8:
+		ret.left, ret.right = int64(s.byte()), int64(s.byte())
+	case kindI32, kindP32, kindI64, kindP64:
+		ret.left, ret.right = s.svarint(), s.svarint()
+	case kindF64:
+		s.float64()
+		s.float64()
+		return rng{left: 1}
+	default:
+		s.fail(fmt.Errorf("unknown kind of range: %v", kind))
+	}
+	return ret
+}
+
+// wellKnownTypes reads the WKT section.
+func (self *source) wellKnownTypes() error {
+	s := &self.s
+	s.bytes(4)
+	for {
+		wkt := s.byte()
+		if wkt == 0 || s.err != nil {
+			return s.err
+		}
+		if t := self.typeid(); s.err == nil {
+			t.wkt = wkt
+		}
+	}
+}
+
+// typeid reads a reference to a type.
+func (self *source) typeid() *typ {
+	s := &self.s
+	id := s.uvarint()
+	if s.err != nil {
+		return nil
+	}
+	if id == 0 || id > uint64(len(self.typs)) {
+		s.fail(fmt.Errorf("unknown type: %v", id))
+		return nil
+	}
+	return self.typs[id-1]
+}
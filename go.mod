@@ -7,6 +7,8 @@ require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/dsnet/golib/unitconv v1.0.2
 	github.com/golang/glog v1.2.5
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/ulikunitz/xz v0.5.12
 	golang.org/x/text v0.29.0
 )
@@ -0,0 +1,239 @@
+package vcd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AttrKindCode is the kind of an attribute, the first word after
+// `$attrbegin`. The kinds are those of GTKWave's FST format.
+type AttrKindCode int
+
+const (
+	AttrKindMisc AttrKindCode = iota
+	AttrKindArray
+	AttrKindEnum
+	AttrKindPack
+
+	AttrKindUnknown
+)
+
+var stringToAttrKind = map[string]AttrKindCode{
+	"misc":  AttrKindMisc,
+	"array": AttrKindArray,
+	"enum":  AttrKindEnum,
+	"pack":  AttrKindPack,
+	// GTKWave writes pack attributes as `class`.
+	"class": AttrKindPack,
+}
+
+// The subtypes of misc attributes.
+const (
+	AttrMiscComment    = 0
+	AttrMiscEnvVar     = 1
+	AttrMiscSupVar     = 2 // Supplemental VHDL type info, such as `STD_LOGIC`.
+	AttrMiscPathName   = 3
+	AttrMiscSourceStem = 4
+	// AttrMiscSourceInstantiationStem is the source of the instantiation.
+	AttrMiscSourceInstantiationStem = 5
+	AttrMiscValueList               = 6
+	AttrMiscEnumTable               = 7
+	AttrMiscUnknown                 = 8
+)
+
+// AttrT is an attribute, such as `$attrbegin misc 02 STD_LOGIC 1030 $end`.
+// Attributes annotate the scope or the variable declared after them.
+//
+// An enum table is a misc attribute of subtype 07, whose name lists the
+// names of the enum followed by their values:
+//
+//	$attrbegin misc 07 state_t 3 IDLE RUN WAIT 00 01 10 1 $end
+//
+// The argument, 1 here, is the handle by which variables refer to the
+// table, with a misc attribute of subtype 07 without a name:
+//
+//	$attrbegin misc 07 1 $end
+type AttrT struct {
+	words []string
+
+	Kind    string `json:",omitempty"`
+	Subtype int    `json:",omitempty"`
+	// Name is empty for enum table references.
+	Name string `json:",omitempty"`
+	Arg  int64  `json:",omitempty"`
+
+	// EnumTable is set if the attribute defines an enum table.
+	EnumTable *EnumTableT `json:",omitempty"`
+}
+
+// Capture implements custom capturing of tokens into AttrT.
+func (self *AttrT) Capture(tokens []string) error {
+	for _, t := range tokens {
+		t = strings.TrimSpace(t)
+		switch t {
+		case "", "$attrbegin":
+			continue
+		case "$end":
+			return self.capture()
+		}
+		self.words = append(self.words, t)
+	}
+	return nil
+}
+
+// capture fills in the attribute from the accumulated words.
+func (self *AttrT) capture() error {
+	w := self.words
+	self.words = nil
+	if len(w) < 3 {
+		return fmt.Errorf("expected kind, subtype and argument, got: %q", w)
+	}
+	self.Kind = w[0]
+	subtype, err := strconv.Atoi(w[1])
+	if err != nil {
+		return fmt.Errorf("expected subtype, got: %q: %w", w[1], err)
+	}
+	self.Subtype = subtype
+	arg, err := strconv.ParseInt(w[len(w)-1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("expected argument, got: %q: %w", w[len(w)-1], err)
+	}
+	self.Arg = arg
+	name := w[2 : len(w)-1]
+	if len(name) == 1 && name[0] == `""` {
+		// GTKWave writes an empty name like this.
+		name = nil
+	}
+	self.Name = strings.Join(name, " ")
+	if self.GetKind() == AttrKindMisc && self.Subtype == AttrMiscEnumTable && len(name) > 0 {
+		t, err := newEnumTable(name, arg)
+		if err != nil {
+			return err
+		}
+		self.EnumTable = t
+	}
+	return nil
+}
+
+// String returns the keyword of the attribute kind, as in `$attrbegin misc
+// ...`.
+func (self AttrKindCode) String() string {
+	switch self {
+	case AttrKindMisc:
+		return "misc"
+	case AttrKindArray:
+		return "array"
+	case AttrKindEnum:
+		return "enum"
+	case AttrKindPack:
+		return "pack"
+	}
+	return fmt.Sprintf("AttrKindCode(%d)", int(self))
+}
+
+// String returns the attribute as it is between `$attrbegin` and `$end`,
+// such as `misc 02 STD_LOGIC 1030`.
+func (self AttrT) String() string {
+	if self.Name == "" {
+		return fmt.Sprintf("%v %02d %v", self.Kind, self.Subtype, self.Arg)
+	}
+	return fmt.Sprintf("%v %02d %v %v", self.Kind, self.Subtype, self.Name, self.Arg)
+}
+
+// GetKind returns the kind of the attribute.
+func (self AttrT) GetKind() AttrKindCode {
+	if k, ok := stringToAttrKind[self.Kind]; ok {
+		return k
+	}
+	return AttrKindUnknown
+}
+
+// EnumTableRef returns the handle of the enum table that the attribute
+// refers to, if it is an enum table reference.
+func (self AttrT) EnumTableRef() (int64, bool) {
+	if self.GetKind() != AttrKindMisc || self.Subtype != AttrMiscEnumTable || self.Name != "" {
+		return 0, false
+	}
+	return self.Arg, true
+}
+
+// EnumTableT maps the values of an enum to their names.
+type EnumTableT struct {
+	Name   string   `json:",omitempty"`
+	Handle int64    `json:",omitempty"`
+	Names  []string `json:",omitempty"`
+	// Values are the values of the names, in the same order.
+	Values []Value `json:",omitempty"`
+}
+
+// newEnumTable parses an enum table from the words of its name: the name of
+// the enum, the number of entries, the names, and then the values.
+func newEnumTable(words []string, handle int64) (*EnumTableT, error) {
+	if len(words) < 2 {
+		return nil, fmt.Errorf("expected enum name and count, got: %q", words)
+	}
+	n, err := strconv.Atoi(words[1])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("expected enum count, got: %q", words[1])
+	}
+	if len(words) != 2+2*n {
+		return nil, fmt.Errorf("expected %v enum names and values, got: %q", n, words[2:])
+	}
+	ret := &EnumTableT{
+		Name:   words[0],
+		Handle: handle,
+		Names:  words[2 : 2+n],
+	}
+	for _, v := range words[2+n:] {
+		value, err := ParseValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("enum %v: %w", words[0], err)
+		}
+		ret.Values = append(ret.Values, value)
+	}
+	return ret, nil
+}
+
+// Lookup returns the name of value v. Values of different widths are
+// compared after extending them to the same width.
+func (self EnumTableT) Lookup(v Value) (string, bool) {
+	for i, e := range self.Values {
+		w := max(v.Width(), e.Width())
+		if v.Extend(w) == e.Extend(w) {
+			return self.Names[i], true
+		}
+	}
+	return "", false
+}
+
+// LinkAttributes attaches the attributes in decls to the scopes and
+// variables declared after them, and resolves the enum table references of
+// variables. Reader.Declarations does this already; call it for
+// declarations parsed by the parser from NewParser[File]. References to
+// unknown enum tables are left unresolved.
+func LinkAttributes(decls []*DeclarationCommandT) {
+	tables := map[int64]*EnumTableT{}
+	var pending []*AttrT
+	for _, d := range decls {
+		switch {
+		case d.Attrbegin != nil:
+			if t := d.Attrbegin.EnumTable; t != nil {
+				// A table definition annotates nothing.
+				tables[t.Handle] = t
+				continue
+			}
+			pending = append(pending, d.Attrbegin)
+		case d.Scope != nil:
+			d.Scope.Attrs, pending = pending, nil
+		case d.Var != nil:
+			v := d.Var
+			v.Attrs, v.EnumTable, pending = pending, nil, nil
+			for _, a := range v.Attrs {
+				if h, ok := a.EnumTableRef(); ok {
+					v.EnumTable = tables[h]
+				}
+			}
+		}
+	}
+}
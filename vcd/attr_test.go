@@ -0,0 +1,127 @@
+package vcd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAttrParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected AttrT
+		kind     AttrKindCode
+	}{
+		{
+			input:    `$attrbegin misc 02 STD_LOGIC 1030 $end`,
+			expected: AttrT{Kind: "misc", Subtype: AttrMiscSupVar, Name: "STD_LOGIC", Arg: 1030},
+			kind:     AttrKindMisc,
+		},
+		{
+			input:    `$attrbegin misc 07 "" 3 $end`,
+			expected: AttrT{Kind: "misc", Subtype: AttrMiscEnumTable, Arg: 3},
+			kind:     AttrKindMisc,
+		},
+		{
+			input:    `$attrbegin class 00 my_struct 0 $end`,
+			expected: AttrT{Kind: "class", Name: "my_struct"},
+			kind:     AttrKindPack,
+		},
+		{
+			input:    `$attrbegin misc 03 top.dut.u0 0 $end`,
+			expected: AttrT{Kind: "misc", Subtype: AttrMiscPathName, Name: "top.dut.u0"},
+			kind:     AttrKindMisc,
+		},
+		{
+			input:    `$attrbegin bogus 01 x 0 $end`,
+			expected: AttrT{Kind: "bogus", Subtype: 1, Name: "x"},
+			kind:     AttrKindUnknown,
+		},
+	}
+	parser := NewParser[DeclarationCommandT]()
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			d, err := parser.ParseString(test.input, test.input)
+			if err != nil {
+				t.Fatalf("parse error: input:`%+v`: %+v", test.input, err)
+			}
+			if !reflect.DeepEqual(*d.Attrbegin, test.expected) {
+				t.Errorf("want: %+v, got: %+v", test.expected, *d.Attrbegin)
+			}
+			if k := d.Attrbegin.GetKind(); k != test.kind {
+				t.Errorf("want kind: %v, got: %v", test.kind, k)
+			}
+		})
+	}
+
+	for _, input := range []string{
+		`$attrbegin misc $end`,
+		`$attrbegin misc xx name 0 $end`,
+		`$attrbegin misc 02 name arg $end`,
+		`$attrbegin misc 07 e 2 A B 0 1 $end`,
+		`$attrbegin misc 07 e 1 A q 1 $end`,
+	} {
+		if _, err := parser.ParseString(input, input); err == nil {
+			t.Errorf("want error for: %v", input)
+		}
+	}
+}
+
+func TestLinkAttributes(t *testing.T) {
+	t.Parallel()
+	const input = `
+$attrbegin misc 07 state_t 3 IDLE RUN WAIT 00 01 10 1 $end
+$attrbegin misc 03 top 0 $end
+$scope module top $end
+$attrbegin misc 07 1 $end
+$var logic 2 ! state $end
+$attrend $end
+$attrbegin misc 02 STD_LOGIC 1030 $end
+$var logic 1 " clk $end
+$var logic 1 # rst $end
+$attrbegin misc 07 9 $end
+$var logic 2 $ other $end
+$upscope $end
+$enddefinitions $end
+`
+	decls, err := NewReader(strings.NewReader(input)).Declarations()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	vars := map[string]*VarT{}
+	var scope *ScopeT
+	for _, d := range decls {
+		switch {
+		case d.Var != nil:
+			vars[d.Var.Id.Name] = d.Var
+		case d.Scope != nil:
+			scope = d.Scope
+		}
+	}
+	if len(scope.Attrs) != 1 || scope.Attrs[0].Subtype != AttrMiscPathName {
+		t.Errorf("scope attributes: %+v", scope.Attrs)
+	}
+	state := vars["state"]
+	if len(state.Attrs) != 1 || state.EnumTable == nil || state.EnumTable.Name != "state_t" {
+		t.Fatalf("state attributes: %+v, enum: %+v", state.Attrs, state.EnumTable)
+	}
+	for value, expected := range map[string]string{"b10": "WAIT", "b1": "RUN", "0": "IDLE"} {
+		if name, ok := state.EnumTable.Lookup(MustParseValue(value)); !ok || name != expected {
+			t.Errorf("Lookup(%v): want: %v, got: %v, %v", value, expected, name, ok)
+		}
+	}
+	if name, ok := state.EnumTable.Lookup(MustParseValue("b11")); ok {
+		t.Errorf("Lookup(b11): want nothing, got: %v", name)
+	}
+	if clk := vars["clk"]; len(clk.Attrs) != 1 || clk.Attrs[0].Name != "STD_LOGIC" || clk.EnumTable != nil {
+		t.Errorf("clk attributes: %+v", clk.Attrs)
+	}
+	if rst := vars["rst"]; len(rst.Attrs) != 0 {
+		t.Errorf("rst attributes: %+v", rst.Attrs)
+	}
+	if other := vars["other"]; len(other.Attrs) != 1 || other.EnumTable != nil {
+		t.Errorf("an unknown enum table should stay unresolved: %+v", other)
+	}
+}
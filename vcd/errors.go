@@ -0,0 +1,138 @@
+package vcd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	participle "github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// maxSnippetLen is the longest source snippet that a ParseError keeps.
+const maxSnippetLen = 120
+
+// ParseError is a syntax error in a VCD file. Use errors.As to get it from
+// the errors returned by Reader.
+type ParseError struct {
+	Filename string
+	Line     int // 1-based.
+	Column   int // 1-based, in runes.
+	Offset   int // Byte offset from the start of the input.
+
+	// Token is the offending token. It is empty at the end of input.
+	Token string
+	// Snippet is the source line that contains the error. Overly long lines
+	// are shortened around the error, and "..." marks where.
+	Snippet string
+	// Msg describes the error.
+	Msg string
+
+	caret int // Index of the first rune of Token in Snippet, in runes.
+}
+
+// newParseError creates a ParseError at pos. line is the text of the source
+// line that contains pos, and at is the byte index of pos in line.
+func newParseError(pos lexer.Position, msg string, line []byte, at int) *ParseError {
+	at = max(0, min(at, len(line)))
+	token := line[at:]
+	if i := bytes.IndexFunc(token, func(r rune) bool { return r < 256 && isSpace(byte(r)) }); i >= 0 {
+		token = token[:i]
+	}
+	line = bytes.TrimRight(line, "\r")
+	from, to := 0, len(line)
+	if len(line) > maxSnippetLen {
+		from = max(0, at-maxSnippetLen/2)
+		to = min(len(line), from+maxSnippetLen)
+		from = max(0, to-maxSnippetLen)
+		// Do not cut runes in half.
+		for from > 0 && !utf8.RuneStart(line[from]) {
+			from--
+		}
+		for to < len(line) && !utf8.RuneStart(line[to]) {
+			to++
+		}
+	}
+	var snippet strings.Builder
+	if from > 0 {
+		snippet.WriteString("...")
+	}
+	caret := utf8.RuneCountInString(snippet.String()) + utf8.RuneCount(line[from:min(at, to)])
+	snippet.Write(line[from:to])
+	if to < len(line) {
+		snippet.WriteString("...")
+	}
+	return &ParseError{
+		Filename: pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Offset:   pos.Offset,
+		Token:    string(token),
+		Snippet:  snippet.String(),
+		Msg:      msg,
+		caret:    caret,
+	}
+}
+
+// newParseErrorIn converts err into a ParseError, taking the snippet from
+// source, which must start at the beginning of the input. Errors that do not
+// come from the parser are returned unchanged.
+func newParseErrorIn(err error, source []byte) error {
+	var (
+		ret  *ParseError
+		perr participle.Error
+	)
+	if errors.As(err, &ret) || !errors.As(err, &perr) {
+		return err
+	}
+	pos := perr.Position()
+	off := max(0, min(pos.Offset, len(source)))
+	start := bytes.LastIndexByte(source[:off], '\n') + 1
+	end := bytes.IndexByte(source[off:], '\n')
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += off
+	}
+	ret = newParseError(pos, perr.Message(), source[start:end], off-start)
+	var uerr *participle.UnexpectedTokenError
+	if errors.As(err, &uerr) && !uerr.Unexpected.EOF() {
+		ret.Token = uerr.Unexpected.Value
+	}
+	return ret
+}
+
+// Position returns the position of the error.
+func (self *ParseError) Position() lexer.Position {
+	return lexer.Position{
+		Filename: self.Filename,
+		Offset:   self.Offset,
+		Line:     self.Line,
+		Column:   self.Column,
+	}
+}
+
+// Message returns the error message without the position.
+func (self *ParseError) Message() string {
+	return self.Msg
+}
+
+func (self *ParseError) Error() string {
+	return fmt.Sprintf("%v: %v", self.Position(), self.Msg)
+}
+
+// Detail returns the error followed by the source snippet, with a caret
+// pointing at the offending token.
+//
+//	dump.vcd:5:11: unexpected keyword: "$dumpon", expected: $end
+//	  $dumpvars 1! $dumpon $end
+//	               ^
+func (self *ParseError) Detail() string {
+	if self.Snippet == "" {
+		return self.Error()
+	}
+	return fmt.Sprintf("%v\n  %v\n  %v^", self.Error(), self.Snippet,
+		strings.Repeat(" ", self.caret))
+}
@@ -0,0 +1,93 @@
+package vcd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, input string
+		expected    ParseError
+		detail      string
+	}{
+		{
+			name:  "simulation",
+			input: "$enddefinitions $end\n#0\n$dumpvars 1! $dumpon $end\n",
+			expected: ParseError{
+				Filename: "bad.vcd", Line: 3, Column: 14, Offset: 37,
+				Token:   "$dumpon",
+				Snippet: "$dumpvars 1! $dumpon $end",
+				Msg:     `unexpected keyword: "$dumpon", expected: $end`,
+			},
+			detail: `bad.vcd:3:14: unexpected keyword: "$dumpon", expected: $end
+  $dumpvars 1! $dumpon $end
+               ^`,
+		},
+		{
+			name:  "end of input",
+			input: "$enddefinitions $end\n#0 b10",
+			expected: ParseError{
+				Filename: "bad.vcd", Line: 2, Column: 7, Offset: 27,
+				Snippet: "#0 b10",
+				Msg:     "unexpected end of input, expected: id code",
+			},
+			detail: `bad.vcd:2:7: unexpected end of input, expected: id code
+  #0 b10
+        ^`,
+		},
+		{
+			name:  "declarations",
+			input: "$timescale 1 ns $end\n$var wire x ! clk $end\n$enddefinitions $end\n",
+			expected: ParseError{
+				Filename: "bad.vcd", Line: 2, Column: 11, Offset: 31,
+				Token:   "x",
+				Snippet: "$var wire x ! clk $end",
+				Msg:     "failed to capture: expected length, got: expected integer",
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(test.input), WithFilename("bad.vcd")).ReadAll()
+			var actual *ParseError
+			if !errors.As(err, &actual) {
+				t.Fatalf("want a *ParseError, got: %#v", err)
+			}
+			e := test.expected
+			e.caret = actual.caret
+			if *actual != e {
+				t.Errorf("\nwant: %+v\ngot:  %+v", e, *actual)
+			}
+			if test.detail != "" && actual.Detail() != test.detail {
+				t.Errorf("\nwant:\n%v\ngot:\n%v", test.detail, actual.Detail())
+			}
+		})
+	}
+}
+
+func TestParseErrorLongLine(t *testing.T) {
+	t.Parallel()
+	input := "$enddefinitions $end\n" + strings.Repeat("1! ", 1000) + "$bogus" +
+		strings.Repeat(" 0!", 1000)
+	_, err := NewReader(strings.NewReader(input)).ReadAll()
+	var actual *ParseError
+	if !errors.As(err, &actual) {
+		t.Fatalf("want a *ParseError, got: %#v", err)
+	}
+	if actual.Token != "$bogus" || actual.Column != 3001 {
+		t.Errorf("unexpected error: %+v", *actual)
+	}
+	s := actual.Snippet
+	if !strings.HasPrefix(s, "...") || !strings.HasSuffix(s, "...") ||
+		len(s) > maxSnippetLen+6 {
+		t.Errorf("snippet not shortened: %q", s)
+	}
+	lines := strings.Split(actual.Detail(), "\n")
+	if got := lines[1][len(lines[2])-1:]; !strings.HasPrefix(got, "$bogus") {
+		t.Errorf("caret does not point at the token:\n%v", actual.Detail())
+	}
+}
@@ -2,14 +2,38 @@ package files
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"os"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/davecgh/go-spew/spew"
 	"github.com/filmil/go-vcd-parser/vcd"
 )
 
+// isSample reports whether entry is a sample file, possibly compressed.
+func isSample(entry os.DirEntry) bool {
+	name := entry.Name()
+	for _, ext := range []string{".gz", ".bz2", ".zst", ".xz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return strings.HasSuffix(name, ".vcd") && !entry.IsDir()
+}
+
+// readSample returns the decompressed contents of the named sample file.
+func readSample(name string) ([]byte, error) {
+	f, err := vcd.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
 // This test runs in the directory //vcd.  See BUILD.bazel file for details.
 func TestVCDFiles(t *testing.T) {
 	t.Parallel()
@@ -21,13 +45,14 @@ func TestVCDFiles(t *testing.T) {
 		entry := entry
 		t.Run(entry.Name(), func(t *testing.T) {
 			name := path.Join("samples", entry.Name())
-			if name == "." || name == ".." || !strings.HasSuffix(name, ".vcd") || entry.IsDir() {
+			if !isSample(entry) {
 				return
 			}
-			f, err := os.Open(name)
+			f, err := vcd.Open(name)
 			if err != nil {
-				t.Errorf("could not open file: %v: %v", name, err)
+				t.Fatalf("could not open file: %v: %v", name, err)
 			}
+			defer f.Close()
 			parser := vcd.NewParser[vcd.File]()
 
 			r := bufio.NewReader(f)
@@ -38,3 +63,181 @@ func TestVCDFiles(t *testing.T) {
 		})
 	}
 }
+
+// TestReaderVCDFiles checks that the streaming reader produces the same
+// result as the parser on the sample files.
+func TestReaderVCDFiles(t *testing.T) {
+	t.Parallel()
+	entries, err := os.ReadDir("samples")
+	if err != nil {
+		t.Fatalf("could not read dir: %v", err)
+	}
+	for _, entry := range entries {
+		entry := entry
+		t.Run(entry.Name(), func(t *testing.T) {
+			name := path.Join("samples", entry.Name())
+			if !isSample(entry) {
+				return
+			}
+			b, err := readSample(name)
+			if err != nil {
+				t.Fatalf("could not read file: %v: %v", name, err)
+			}
+			expected, err := vcd.NewParser[vcd.File]().ParseBytes(name, b)
+			if err != nil {
+				t.Fatalf("parse error: `%v`: %+v", name, err)
+			}
+			r := vcd.NewReader(bytes.NewReader(b), vcd.WithFilename(name))
+			actual, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("read error: `%v`: %+v", name, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("mismatch: `%v`:\nwant: %v\ngot:  %v",
+					name, spew.Sdump(expected), spew.Sdump(actual))
+			}
+			r = vcd.NewReader(bytes.NewReader(b), vcd.WithFilename(name), vcd.WithWorkers(4))
+			actual, err = r.ReadAll()
+			if err != nil {
+				t.Fatalf("parallel read error: `%v`: %+v", name, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("parallel mismatch: `%v`:\nwant: %v\ngot:  %v",
+					name, spew.Sdump(expected), spew.Sdump(actual))
+			}
+		})
+	}
+}
+
+// TestWriterRoundTrip checks that the sample files read back the same after
+// writing them out.
+func TestWriterRoundTrip(t *testing.T) {
+	t.Parallel()
+	entries, err := os.ReadDir("samples")
+	if err != nil {
+		t.Fatalf("could not read dir: %v", err)
+	}
+	for _, entry := range entries {
+		entry := entry
+		t.Run(entry.Name(), func(t *testing.T) {
+			name := path.Join("samples", entry.Name())
+			if !isSample(entry) {
+				return
+			}
+			parser := vcd.NewParser[vcd.File]()
+			b, err := readSample(name)
+			if err != nil {
+				t.Fatalf("could not read file: %v: %v", name, err)
+			}
+			expected, err := parser.ParseBytes(name, b)
+			if err != nil {
+				t.Fatalf("parse error: `%v`: %+v", name, err)
+			}
+			var out bytes.Buffer
+			w := vcd.NewWriter(&out)
+			if err := w.WriteFile(expected); err != nil {
+				t.Fatalf("write error: `%v`: %v", name, err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("write error: `%v`: %v", name, err)
+			}
+			actual, err := parser.ParseBytes(name, out.Bytes())
+			if err != nil {
+				t.Fatalf("parse error in the output: `%v`: %+v\n%v", name, err, out.String())
+			}
+			clearPositions(expected)
+			clearPositions(actual)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("mismatch: `%v`:\nwant: %v\ngot:  %v",
+					name, spew.Sdump(expected), spew.Sdump(actual))
+			}
+		})
+	}
+}
+
+// clearPositions clears the source positions of the scalar value changes,
+// which are not the same in a written file.
+func clearPositions(f *vcd.File) {
+	zero := func(vcs ...*vcd.ValueChangeT) {
+		for _, vc := range vcs {
+			if s := vc.ScalarValueChange; s != nil {
+				s.Pos = lexer.Position{}
+			}
+		}
+	}
+	for _, c := range f.SimulationCommand {
+		switch {
+		case c.ValueChange != nil:
+			zero(c.ValueChange)
+		case c.Dumpall != nil:
+			zero(c.Dumpall.ValueChange...)
+		case c.Dumpoff != nil:
+			zero(c.Dumpoff.ValueChange...)
+		case c.Dumpon != nil:
+			zero(c.Dumpon.ValueChange...)
+		case c.Dumpvars != nil:
+			zero(c.Dumpvars.ValueChange...)
+		}
+	}
+}
+
+// benchmarkInput returns the sample file with its simulation section
+// repeated so that the input is at least size bytes, large enough to measure
+// throughput.
+func benchmarkInput(b *testing.B, size int) []byte {
+	b.Helper()
+	const name = "samples/18.2.4_02.vcd"
+	content, err := os.ReadFile(name)
+	if err != nil {
+		b.Fatalf("could not read file: %v: %v", name, err)
+	}
+	const end = "$enddefinitions $end"
+	i := bytes.Index(content, []byte(end))
+	if i < 0 {
+		b.Fatalf("no definitions in: %v", name)
+	}
+	i += len(end)
+	var ret bytes.Buffer
+	ret.Write(content[:i])
+	for ret.Len() < size {
+		ret.Write(content[i:])
+	}
+	return ret.Bytes()
+}
+
+func BenchmarkParser(b *testing.B) {
+	input := benchmarkInput(b, 1<<20)
+	parser := vcd.NewParser[vcd.File]()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parser.ParseBytes("bench", input); err != nil {
+			b.Fatalf("parse error: %v", err)
+		}
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	input := benchmarkInput(b, 1<<20)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := vcd.NewReader(bytes.NewReader(input), vcd.WithFilename("bench"))
+		if _, err := r.ReadAll(); err != nil {
+			b.Fatalf("read error: %v", err)
+		}
+	}
+}
+
+func BenchmarkParallelReader(b *testing.B) {
+	// Enough for a chunk per worker.
+	input := benchmarkInput(b, 16*vcd.ParallelChunkSize)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := vcd.NewReader(bytes.NewReader(input), vcd.WithFilename("bench"), vcd.WithWorkers(0))
+		if _, err := r.ReadAll(); err != nil {
+			b.Fatalf("read error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package vcd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter selects signals and a time window from a VCD file. See WithFilter.
+//
+// A signal is selected if any of its paths matches one of Globs or Regexps,
+// or is in one of the Scopes, including their subscopes. If there are none of
+// these, all signals are selected. The paths are those of Hierarchy.
+type Filter struct {
+	Globs   []string
+	Regexps []*regexp.Regexp
+	Scopes  []string
+
+	// Window is the time window to keep. If nil, all of the time is kept.
+	Window *Window
+}
+
+// Window is a time window. Both ends are included, and From must not be
+// after To.
+type Window struct {
+	From, To uint64
+}
+
+// WithFilter makes the Reader keep only what f selects. The declarations
+// keep only the selected variables, and the simulation commands only the
+// value changes of the selected variables.
+//
+// With a time window, the commands before and after the window are dropped,
+// and reading stops at the first timestamp after it. At the start of the
+// window, the Reader adds a timestamp, and a value change for each selected
+// variable that changed before the window, to its last value. This way the
+// values at the start of the window are right.
+func WithFilter(f *Filter) ReaderOption {
+	return func(r *Reader) {
+		r.filter = f
+	}
+}
+
+func (self *Filter) hasSignals() bool {
+	return len(self.Globs)+len(self.Regexps)+len(self.Scopes) > 0
+}
+
+// selects reports whether the filter selects the variable with path p.
+func (self *Filter) selects(p string) bool {
+	if !self.hasSignals() {
+		return true
+	}
+	for _, s := range self.Scopes {
+		if s == "/" || p == s || strings.HasPrefix(p, s+"/") {
+			return true
+		}
+	}
+	for _, re := range self.Regexps {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	for _, g := range self.Globs {
+		// The patterns are checked in Apply.
+		if ok, _ := path.Match(g, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply filters a VCD file. It takes the declarations, and a function next
+// that returns the simulation commands one by one, and io.EOF after the
+// last. It returns the selected declarations, and a function that returns
+// the selected simulation commands in the same way. See WithFilter for what
+// is selected. Links the attributes of decls, see LinkAttributes.
+func (self *Filter) Apply(decls []*DeclarationCommandT, next func() (*SimulationCommandT, error)) (
+	[]*DeclarationCommandT, func() (*SimulationCommandT, error), error) {
+	for _, g := range self.Globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, nil, fmt.Errorf("vcd.Filter.Apply: %q: %w", g, err)
+		}
+	}
+	if w := self.Window; w != nil && w.From > w.To {
+		return nil, nil, fmt.Errorf("vcd.Filter.Apply: window from %v to %v ends before it starts", w.From, w.To)
+	}
+	LinkAttributes(decls)
+	vars := map[*VarT]bool{}
+	ret := &filterReader{f: self, next: next, last: map[string]*ValueChangeT{}}
+	if self.hasSignals() {
+		ret.codes = map[string]bool{}
+	}
+	seen := map[string]bool{}
+	for _, v := range NewHierarchy(decls).Vars() {
+		if !self.selects(v.Path) {
+			continue
+		}
+		vars[v.VarT] = true
+		if ret.codes != nil {
+			ret.codes[v.Code] = true
+		}
+		if !seen[v.Code] {
+			seen[v.Code] = true
+			ret.order = append(ret.order, v.Code)
+		}
+	}
+	// The attributes of the dropped variables go too, or they would end up
+	// on the next variable.
+	dropped := map[*AttrT]bool{}
+	for _, d := range decls {
+		if d.Var != nil && !vars[d.Var] {
+			for _, a := range d.Var.Attrs {
+				dropped[a] = true
+			}
+		}
+	}
+	var selected []*DeclarationCommandT
+	for _, d := range decls {
+		switch {
+		case d.Var != nil && !vars[d.Var]:
+		case d.Attrbegin != nil && dropped[d.Attrbegin]:
+		default:
+			selected = append(selected, d)
+		}
+	}
+	ret.inWindow = self.Window == nil || self.Window.From == 0
+	return selected, ret.command, nil
+}
+
+// filterReader hands out the simulation commands that a Filter selects.
+type filterReader struct {
+	f    *Filter
+	next func() (*SimulationCommandT, error)
+
+	codes map[string]bool // The selected id codes; nil for all.
+	order []string        // The selected id codes, in order of declaration.
+
+	inWindow bool
+	done     bool
+
+	// The last value changes before the window, by id code.
+	last map[string]*ValueChangeT
+
+	queue   []*SimulationCommandT // To hand out before reading more.
+	held    *SimulationCommandT   // Read, but not handled yet.
+	heldErr error                 // Comes after queue.
+}
+
+func (self *filterReader) read() (*SimulationCommandT, error) {
+	if c := self.held; c != nil {
+		self.held = nil
+		return c, nil
+	}
+	if err := self.heldErr; err != nil {
+		return nil, err
+	}
+	return self.next()
+}
+
+// command returns the next selected command.
+func (self *filterReader) command() (*SimulationCommandT, error) {
+	for {
+		if len(self.queue) > 0 {
+			ret := self.queue[0]
+			self.queue = self.queue[1:]
+			return ret, nil
+		}
+		if self.done {
+			return nil, io.EOF
+		}
+		c, err := self.read()
+		if err == io.EOF {
+			// The window may start after the end of input.
+			self.done = true
+			self.startWindow(nil, nil)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.SimulationTime != nil && self.f.Window != nil {
+			t, err := c.SimulationTime.Value()
+			if err != nil {
+				return nil, fmt.Errorf("vcd.Filter: %w", err)
+			}
+			w := self.f.Window
+			switch {
+			case t > w.To:
+				self.done = true
+				self.startWindow(nil, nil)
+			case self.inWindow:
+				return c, nil
+			case t > w.From:
+				self.startWindow(nil, nil)
+				self.queue = append(self.queue, c)
+			default:
+				if t < w.From {
+					continue
+				}
+				// Right at the start of the window. The last values
+				// from before are only needed for what does not
+				// change here.
+				at := self.readTimestep()
+				changed := map[string]bool{}
+				for _, a := range at {
+					for _, vc := range a.ValueChanges() {
+						changed[vc.GetIdCode()] = true
+					}
+				}
+				self.startWindow(c, changed)
+				self.queue = append(self.queue, at...)
+			}
+			continue
+		}
+		if !self.inWindow {
+			for _, vc := range c.ValueChanges() {
+				if self.selected(vc) {
+					self.last[vc.GetIdCode()] = vc
+				}
+			}
+			continue
+		}
+		if c = self.filter(c); c != nil {
+			return c, nil
+		}
+	}
+}
+
+// readTimestep reads the selected commands up to the next timestamp.
+func (self *filterReader) readTimestep() []*SimulationCommandT {
+	var ret []*SimulationCommandT
+	for {
+		c, err := self.read()
+		if err == io.EOF {
+			self.done = true
+			return ret
+		}
+		if err != nil {
+			self.heldErr = err
+			return ret
+		}
+		if c.SimulationTime != nil {
+			self.held = c
+			return ret
+		}
+		if c = self.filter(c); c != nil {
+			ret = append(ret, c)
+		}
+	}
+}
+
+// startWindow queues the timestamp ts that starts the window, and the last
+// values before it of the selected variables, except for the changed ones.
+// If ts is nil, the timestamp is made up, and only queued if there are any
+// values.
+func (self *filterReader) startWindow(ts *SimulationCommandT, changed map[string]bool) {
+	if self.inWindow {
+		return
+	}
+	self.inWindow = true
+	var vcs []*SimulationCommandT
+	for _, code := range self.order {
+		if vc := self.last[code]; vc != nil && !changed[code] {
+			vcs = append(vcs, &SimulationCommandT{ValueChange: vc})
+		}
+	}
+	self.last = nil
+	if ts == nil {
+		if len(vcs) == 0 {
+			return
+		}
+		ts = &SimulationCommandT{SimulationTime: &SimulationTimeT{
+			DecimalNumber: "#" + strconv.FormatUint(self.f.Window.From, 10),
+		}}
+	}
+	self.queue = append(self.queue, ts)
+	self.queue = append(self.queue, vcs...)
+}
+
+func (self *filterReader) selected(vc *ValueChangeT) bool {
+	return self.codes == nil || self.codes[vc.GetIdCode()]
+}
+
+// filter returns c with only the selected value changes, or nil if c is a
+// value change that is not selected.
+func (self *filterReader) filter(c *SimulationCommandT) *SimulationCommandT {
+	if self.codes == nil {
+		return c
+	}
+	if c.ValueChange != nil {
+		if self.selected(c.ValueChange) {
+			return c
+		}
+		return nil
+	}
+	vcs := c.ValueChanges()
+	var kept []*ValueChangeT
+	for _, vc := range vcs {
+		if self.selected(vc) {
+			kept = append(kept, vc)
+		}
+	}
+	if len(kept) == len(vcs) {
+		return c
+	}
+	return c.withValueChanges(kept)
+}
@@ -0,0 +1,176 @@
+package vcd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const filterTestInput = `
+$scope module top $end
+$var wire 1 ! clk $end
+$var wire 4 " data $end
+$scope module cpu $end
+$var wire 1 # rst $end
+$var wire 1 ! clk $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars 0! b0000 " 1# $end
+#5
+1!
+#10
+0!
+b0001 "
+0#
+#20
+1!
+#30
+0!
+b0010 "
+`
+
+// summary returns the commands as a short string, such as `#0 !=1`.
+func summary(cmds []*SimulationCommandT) string {
+	var ret []string
+	for _, c := range cmds {
+		switch {
+		case c.SimulationTime != nil:
+			ret = append(ret, c.SimulationTime.DecimalNumber)
+		case c.ValueChange != nil:
+			ret = append(ret, c.ValueChange.GetIdCode()+"="+c.ValueChange.GetValue())
+		default:
+			var vcs []string
+			for _, vc := range c.ValueChanges() {
+				vcs = append(vcs, vc.GetIdCode()+"="+vc.GetValue())
+			}
+			ret = append(ret, "["+strings.Join(vcs, " ")+"]")
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		filter   Filter
+		vars     string
+		expected string
+	}{
+		{
+			name:     "all",
+			vars:     "/top/clk /top/data /top/cpu/rst /top/cpu/clk",
+			expected: `#0 [!=0 "=0000 #=1] #5 !=1 #10 !=0 "=0001 #=0 #20 !=1 #30 !=0 "=0010`,
+		},
+		{
+			name:     "glob",
+			filter:   Filter{Globs: []string{"/top/cpu/*"}},
+			vars:     "/top/cpu/rst /top/cpu/clk",
+			expected: `#0 [!=0 #=1] #5 !=1 #10 !=0 #=0 #20 !=1 #30 !=0`,
+		},
+		{
+			name:     "window",
+			filter:   Filter{Window: &Window{From: 15, To: 25}},
+			vars:     "/top/clk /top/data /top/cpu/rst /top/cpu/clk",
+			expected: `#15 !=0 "=0001 #=0 #20 !=1`,
+		},
+		{
+			name:     "window at a timestamp",
+			filter:   Filter{Scopes: []string{"/top/cpu"}, Window: &Window{From: 10, To: 10}},
+			vars:     "/top/cpu/rst /top/cpu/clk",
+			expected: `#10 !=0 #=0`,
+		},
+		{
+			name:     "regexp",
+			filter:   Filter{Regexps: []*regexp.Regexp{regexp.MustCompile(`data$`)}, Window: &Window{From: 10, To: 20}},
+			vars:     "/top/data",
+			expected: `#10 "=0001 #20`,
+		},
+		{
+			name:     "after the end",
+			filter:   Filter{Window: &Window{From: 100, To: 200}},
+			vars:     "/top/clk /top/data /top/cpu/rst /top/cpu/clk",
+			expected: `#100 !=0 "=0010 #=0`,
+		},
+		{
+			name:   "nothing",
+			filter: Filter{Globs: []string{"/none"}},
+			// The timestamps are left.
+			expected: `#0 [] #5 #10 #20 #30`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		for _, workers := range []int{1, 2} {
+			t.Run(fmt.Sprintf("%v/%v", test.name, workers), func(t *testing.T) {
+				r := NewReader(strings.NewReader(filterTestInput), WithFilter(&test.filter), WithWorkers(workers))
+				h, err := r.Header()
+				if err != nil {
+					t.Fatalf("could not read: %v", err)
+				}
+				var vars []string
+				for _, v := range h.Hierarchy.Vars() {
+					vars = append(vars, v.Path)
+				}
+				if actual := strings.Join(vars, " "); actual != test.vars {
+					t.Errorf("vars: want: %v, got: %v", test.vars, actual)
+				}
+				f, err := r.ReadAll()
+				if err != nil {
+					t.Fatalf("could not read: %v", err)
+				}
+				if actual := summary(f.SimulationCommand); actual != test.expected {
+					t.Errorf("\nwant: %v\ngot:  %v", test.expected, actual)
+				}
+				if _, err := r.Next(); err != io.EOF {
+					t.Errorf("want io.EOF, got: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestFilterBadGlob(t *testing.T) {
+	t.Parallel()
+	r := NewReader(strings.NewReader(filterTestInput), WithFilter(&Filter{Globs: []string{"["}}))
+	if _, err := r.Declarations(); err == nil {
+		t.Errorf("want error for a bad glob")
+	}
+}
+
+func TestFilterBadWindow(t *testing.T) {
+	t.Parallel()
+	r := NewReader(strings.NewReader(filterTestInput), WithFilter(&Filter{Window: &Window{From: 20, To: 10}}))
+	if _, err := r.Declarations(); err == nil {
+		t.Errorf("want error for a window that ends before it starts")
+	}
+}
+
+func TestFilterAttributes(t *testing.T) {
+	t.Parallel()
+	const input = `
+$attrbegin misc 07 state_t 2 IDLE RUN 0 1 1 $end
+$scope module top $end
+$attrbegin misc 07 1 $end
+$var logic 1 ! state $end
+$var logic 1 " clk $end
+$upscope $end
+$enddefinitions $end
+`
+	r := NewReader(strings.NewReader(input), WithFilter(&Filter{Globs: []string{"/top/clk"}}))
+	decls, err := r.Declarations()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	// Linking again must not move the attribute of state to clk.
+	LinkAttributes(decls)
+	for _, d := range decls {
+		if d.Var != nil && (d.Var.Id.Name != "clk" || len(d.Var.Attrs) != 0) {
+			t.Errorf("unexpected variable: %+v", d.Var)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package vcd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Header is a summary of the declarations of a VCD file.
+type Header struct {
+	// The texts of `$date`, `$version` and `$comment`, with the words
+	// separated by single spaces. Only the comments among the declarations
+	// are included.
+	Date     string
+	Version  string
+	Comments []string
+
+	// Timescale is nil if the file does not declare one.
+	Timescale *TimescaleT
+
+	Declarations []*DeclarationCommandT
+	Hierarchy    *Hierarchy
+}
+
+// ParseHeader reads the declarations of a VCD file from r, up to and
+// including `$enddefinitions`. It does not read the simulation section, so it
+// takes the same time for a file of any length.
+func ParseHeader(r io.Reader, opts ...ReaderOption) (*Header, error) {
+	return NewReader(r, opts...).Header()
+}
+
+// Header returns the summary of the declarations, reading them if that was
+// not done yet.
+func (self *Reader) Header() (*Header, error) {
+	decls, err := self.Declarations()
+	if err != nil {
+		return nil, err
+	}
+	ret := &Header{
+		Declarations: decls,
+		Hierarchy:    NewHierarchy(decls),
+	}
+	for _, d := range decls {
+		if d.Timescale != nil && ret.Timescale == nil {
+			ret.Timescale = d.Timescale
+		}
+	}
+	ret.texts(self.headerText)
+	return ret, nil
+}
+
+// texts sets the texts of the header from the source text of the
+// declarations. The parsed declarations do not have the whitespace between
+// the words any more.
+func (self *Header) texts(text []byte) {
+	s := newScanner(bytes.NewReader(text), "")
+	for s.next() == nil {
+		switch w := string(s.word); w {
+		case "$date", "$version", "$comment":
+			words, err := s.words()
+			if err != nil {
+				return
+			}
+			t := strings.Join(words, " ")
+			switch w {
+			case "$date":
+				self.Date = t
+			case "$version":
+				self.Version = t
+			default:
+				self.Comments = append(self.Comments, t)
+			}
+		case "$enddefinitions":
+			return
+		default:
+			if w[0] == '$' && w != "$end" {
+				if err := s.skipToEnd(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
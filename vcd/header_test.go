@@ -0,0 +1,55 @@
+package vcd
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingReader fails all reads.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read past the header")
+}
+
+func TestParseHeader(t *testing.T) {
+	t.Parallel()
+	const input = `$date
+	Mon Jan  1 10:00:00 2024
+$end
+$version  sim 1.0 $end
+$comment first $end
+$timescale 10 ps $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var wire 1 ! clk2 $end
+$upscope $end
+$enddefinitions $end
+$comment after $end
+#0
+`
+	// The simulation section is never read.
+	h, err := ParseHeader(io.MultiReader(strings.NewReader(input), failingReader{}))
+	if err != nil {
+		t.Fatalf("could not parse: %v", err)
+	}
+	if h.Date != "Mon Jan 1 10:00:00 2024" || h.Version != "sim 1.0" {
+		t.Errorf("date: %q, version: %q", h.Date, h.Version)
+	}
+	if !reflect.DeepEqual(h.Comments, []string{"first"}) {
+		t.Errorf("comments: %q", h.Comments)
+	}
+	if h.Timescale == nil || h.Timescale.String() != "10 ps" {
+		t.Errorf("timescale: %v", h.Timescale)
+	}
+	if len(h.Hierarchy.Aliases("!")) != 2 || len(h.Declarations) != 10 {
+		t.Errorf("declarations: %v, hierarchy: %+v", len(h.Declarations), h.Hierarchy.Vars())
+	}
+
+	if _, err := ParseHeader(strings.NewReader("$scope module $end")); err == nil {
+		t.Errorf("want error for a malformed header")
+	}
+}
@@ -0,0 +1,196 @@
+package vcd
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Hierarchy is the tree of scopes and variables that the declarations of a
+// VCD file describe.
+//
+// Paths of scopes and variables are made of the names from the root down,
+// each preceded by a `/`: `/top/cpu/clk`. The root scope itself has the path
+// `/`. Variables declared outside of any scope belong to the root scope.
+//
+// The names in paths are without the escapes of escaped identifiers, and
+// have their `/` and `%` escaped as `%2F` and `%25`, so that `/` only ever
+// separates the names. See PathName.
+type Hierarchy struct {
+	Root *Scope
+
+	vars   []*Var
+	scopes map[string]*Scope
+	byPath map[string]*Var
+	byCode map[string][]*Var
+}
+
+// Scope is a scope in a Hierarchy.
+type Scope struct {
+	Name string // Without escapes, as IdT.Name.
+	Raw  string // The name as it was written, if it was escaped.
+	Kind ScopeKindCode
+	Path string
+
+	Parent   *Scope   // nil for the root scope.
+	Children []*Scope // In the order of declaration.
+	Vars     []*Var   // In the order of declaration.
+
+	// Attrs are the attributes of all declarations of the scope.
+	Attrs []*AttrT
+
+	children map[string]*Scope
+}
+
+// Var is a variable in a Hierarchy.
+type Var struct {
+	*VarT
+	Path  string
+	Scope *Scope
+}
+
+// NewHierarchy builds the Hierarchy from the declarations of a VCD file.
+//
+// A `$scope` with the same name as a scope that was declared earlier in the
+// same parent reopens that scope, as files from GHDL and nvc do: the
+// variables and scopes in it are added to the earlier ones. A variable that
+// is declared again with the same path and id code is only kept once.
+// Extra `$upscope`s are ignored.
+func NewHierarchy(decls []*DeclarationCommandT) *Hierarchy {
+	root := &Scope{Path: "/", children: map[string]*Scope{}}
+	ret := &Hierarchy{
+		Root:   root,
+		scopes: map[string]*Scope{"/": root},
+		byPath: map[string]*Var{},
+		byCode: map[string][]*Var{},
+	}
+	cur := root
+	for _, d := range decls {
+		switch {
+		case d.Scope != nil:
+			name := unescape(d.Scope.Id)
+			s := cur.children[name]
+			if s == nil {
+				s = &Scope{
+					Name:     name,
+					Kind:     d.Scope.ScopeKind.Kind(),
+					Path:     childPath(cur, name),
+					Parent:   cur,
+					children: map[string]*Scope{},
+				}
+				if name != d.Scope.Id {
+					s.Raw = d.Scope.Id
+				}
+				cur.children[s.Name] = s
+				cur.Children = append(cur.Children, s)
+				ret.scopes[s.Path] = s
+			}
+			s.Attrs = append(s.Attrs, d.Scope.Attrs...)
+			cur = s
+		case d.Upscope != nil:
+			if cur.Parent != nil {
+				cur = cur.Parent
+			}
+		case d.Var != nil:
+			p := childPath(cur, d.Var.Id.String())
+			if v := ret.byPath[p]; v != nil && v.Code == d.Var.Code {
+				continue
+			}
+			v := &Var{VarT: d.Var, Path: p, Scope: cur}
+			cur.Vars = append(cur.Vars, v)
+			ret.vars = append(ret.vars, v)
+			if ret.byPath[p] == nil {
+				ret.byPath[p] = v
+			}
+			ret.byCode[v.Code] = append(ret.byCode[v.Code], v)
+		}
+	}
+	return ret
+}
+
+// childPath returns the path of the scope or variable named name in s.
+func childPath(s *Scope, name string) string {
+	if s.Parent == nil {
+		return "/" + PathName(name)
+	}
+	return s.Path + "/" + PathName(name)
+}
+
+// pathEscaper escapes the names in paths.
+var pathEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// PathName returns name as it is in paths: with `%` and `/` escaped as `%25`
+// and `%2F`. For example, the variable `\a/b ` in the scope `top` has the
+// path `/top/a%2Fb`.
+func PathName(name string) string {
+	return pathEscaper.Replace(name)
+}
+
+// Scope returns the scope with the given path, or nil if there is none.
+func (self *Hierarchy) Scope(path string) *Scope {
+	return self.scopes[path]
+}
+
+// Var returns the variable with the given path, or nil if there is none. If
+// several variables have the path, returns the first one declared.
+func (self *Hierarchy) Var(path string) *Var {
+	return self.byPath[path]
+}
+
+// Vars returns all variables in the order of declaration.
+func (self *Hierarchy) Vars() []*Var {
+	return self.vars
+}
+
+// Aliases returns the variables with the given id code, in the order of
+// declaration. All of them have the same values.
+func (self *Hierarchy) Aliases(code string) []*Var {
+	return self.byCode[code]
+}
+
+// Glob returns the variables with paths that match pattern, in the order of
+// declaration. The syntax of pattern is that of path.Match, so `*` does not
+// match `/`, and the `[` of an index needs escaping: `/top/*/data\[0]`.
+func (self *Hierarchy) Glob(pattern string) ([]*Var, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("vcd.Hierarchy.Glob: %q: %w", pattern, err)
+	}
+	var ret []*Var
+	for _, v := range self.vars {
+		if ok, _ := path.Match(pattern, v.Path); ok {
+			ret = append(ret, v)
+		}
+	}
+	return ret, nil
+}
+
+// Regexp returns the variables with paths that re matches, in the order of
+// declaration. re is not anchored unless it says so.
+func (self *Hierarchy) Regexp(re *regexp.Regexp) []*Var {
+	var ret []*Var
+	for _, v := range self.vars {
+		if re.MatchString(v.Path) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// Walk calls fn for each scope, starting with the root scope, parents before
+// their children. Stops at the first error from fn and returns it.
+func (self *Hierarchy) Walk(fn func(s *Scope) error) error {
+	return self.Root.walk(fn)
+}
+
+func (self *Scope) walk(fn func(s *Scope) error) error {
+	if err := fn(self); err != nil {
+		return err
+	}
+	for _, c := range self.Children {
+		if err := c.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
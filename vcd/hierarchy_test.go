@@ -0,0 +1,148 @@
+package vcd
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const hierarchyTestInput = `
+$var wire 1 # glitch $end
+$scope module top $end
+$var wire 1 ! clk $end
+$scope module cpu $end
+$var wire 1 ! clk $end
+$var reg 8 " data[7:0] $end
+$upscope $end
+$upscope $end
+$attrbegin misc 03 top 0 $end
+$scope module top $end
+$var wire 1 ! clk $end
+$scope module cpu $end
+$var wire 1 $ rst $end
+$upscope $end
+$scope task t $end
+$upscope $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+`
+
+func paths(vars []*Var) string {
+	var ret []string
+	for _, v := range vars {
+		ret = append(ret, v.Path)
+	}
+	return strings.Join(ret, " ")
+}
+
+func TestHierarchy(t *testing.T) {
+	t.Parallel()
+	decls, err := NewReader(strings.NewReader(hierarchyTestInput)).Declarations()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	h := NewHierarchy(decls)
+
+	const all = "/glitch /top/clk /top/cpu/clk /top/cpu/data[7:0] /top/cpu/rst"
+	if actual := paths(h.Vars()); actual != all {
+		t.Errorf("Vars: want: %v, got: %v", all, actual)
+	}
+	top := h.Scope("/top")
+	if top == nil || top.Kind != ScopeKindModule || top.Parent != h.Root {
+		t.Fatalf("Scope(/top): %+v", top)
+	}
+	if len(h.Root.Children) != 1 || len(top.Children) != 2 || len(top.Vars) != 1 {
+		t.Errorf("the reopened scope is not merged: %+v", top)
+	}
+	if len(top.Attrs) != 1 || top.Attrs[0].Name != "top" {
+		t.Errorf("attributes of the reopened scope: %+v", top.Attrs)
+	}
+	if s := h.Scope("/top/t"); s == nil || s.Kind != ScopeKindTask || s.Path != "/top/t" {
+		t.Errorf("Scope(/top/t): %+v", s)
+	}
+	if s := h.Scope("/cpu"); s != nil {
+		t.Errorf("Scope(/cpu): want nil, got: %+v", s)
+	}
+	if v := h.Var("/top/cpu/data[7:0]"); v == nil || v.Size != 8 || v.Scope != h.Scope("/top/cpu") {
+		t.Errorf("Var(/top/cpu/data[7:0]): %+v", v)
+	}
+	if v := h.Var("/glitch"); v == nil || v.Scope != h.Root {
+		t.Errorf("Var(/glitch): %+v", v)
+	}
+	if actual := paths(h.Aliases("!")); actual != "/top/clk /top/cpu/clk" {
+		t.Errorf("Aliases(!): %v", actual)
+	}
+	if actual := h.Aliases("?"); actual != nil {
+		t.Errorf("Aliases(?): want nil, got: %v", paths(actual))
+	}
+
+	for pattern, expected := range map[string]string{
+		"/top/*":               "/top/clk",
+		"/top/*/clk":           "/top/cpu/clk",
+		"/*/cpu/data\\[7:0\\]": "/top/cpu/data[7:0]",
+		"/nothing":             "",
+	} {
+		vars, err := h.Glob(pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", pattern, err)
+		}
+		if actual := paths(vars); actual != expected {
+			t.Errorf("Glob(%q): want: %v, got: %v", pattern, expected, actual)
+		}
+	}
+	if _, err := h.Glob("/top/["); err == nil {
+		t.Errorf("Glob: want error for a bad pattern")
+	}
+	if actual := paths(h.Regexp(regexp.MustCompile(`clk$|^/glitch`))); actual != "/glitch /top/clk /top/cpu/clk" {
+		t.Errorf("Regexp: %v", actual)
+	}
+
+	var walked []string
+	h.Walk(func(s *Scope) error {
+		walked = append(walked, s.Path)
+		return nil
+	})
+	if actual := strings.Join(walked, " "); actual != "/ /top /top/cpu /top/t" {
+		t.Errorf("Walk: %v", actual)
+	}
+}
+
+func TestHierarchyEscapedNames(t *testing.T) {
+	t.Parallel()
+	const input = `
+$scope module \top/a $end
+$var wire 1 ! \x/y $end
+$var wire 1 " \50% $end
+$var wire 1 # \my signal\ $end
+$upscope $end
+$scope module top $end
+$scope module a $end
+$var wire 1 $ x $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+`
+	decls, err := NewReader(strings.NewReader(input)).Declarations()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	h := NewHierarchy(decls)
+	const all = "/top%2Fa/x%2Fy /top%2Fa/50%25 /top%2Fa/my signal /top/a/x"
+	if actual := paths(h.Vars()); actual != all {
+		t.Errorf("Vars: want: %v, got: %v", all, actual)
+	}
+	s := h.Scope("/top%2Fa")
+	if s == nil || s.Name != "top/a" || s.Raw != `\top/a` || len(s.Vars) != 3 {
+		t.Fatalf("Scope(/top%%2Fa): %+v", s)
+	}
+	if v := h.Var("/top%2Fa/x%2Fy"); v == nil || v.Id.Name != "x/y" || v.Id.RawString() != `\x/y` {
+		t.Errorf("Var(/top%%2Fa/x%%2Fy): %+v", v)
+	}
+	if s := h.Scope("/top"); s == nil || s.Raw != "" || len(s.Children) != 1 {
+		t.Errorf("Scope(/top): %+v", s)
+	}
+	if actual := PathName("a/b%"); actual != "a%2Fb%25" {
+		t.Errorf("PathName: %v", actual)
+	}
+}
@@ -10,7 +10,7 @@ import (
 
 // See: https://github.com/google/re2/wiki/Syntax
 const (
-	BinstringPattern  = `[bB]([10xXzZuU])+`
+	BinstringPattern  = `[bB]([10xXzZuUwWlLhH-])+`
 	FloatPattern      = `[+-]?([0-9]*\.?[0-9]+|[0-9]+\.?[0-9]*)([eE][+-]?[0-9]+)?` // Generated by Gemini.
 	RealStringPattern = `[r|R]` + FloatPattern
 	IntPattern        = `[+-]?[0-9]+`
@@ -18,7 +18,11 @@ const (
 	TimestampPattern  = `#\d+`
 	WhitespacePattern = `\s+`
 	IdentifierPattern = `[a-zA-Z_][a-zA-Z0-9_]*`
-	StatePattern      = `s` + IdentifierPattern
+	// StatePattern matches string values. They may contain anything but
+	// whitespace, which writers escape.
+	StatePattern = `s[^\r\n\t\f\v ]+`
+	// PortPattern matches extended VCD port values. See IEEE 1364-2005, 18.4.3.
+	PortPattern = `p[01?ABCDFHLNTUXZabcdfhlnuxz]+`
 )
 
 // IntoRule converts a SimpleRule into a (complex) Rule.
@@ -44,13 +48,19 @@ func GenKeywordTokens() []lexer.SimpleRule {
 		//"var",
 		//"version",
 		//"enddefinitions",
-		"scope",
+		//"scope",
 		"timescale",
 		"upscope",
 		"dumpall",
 		"dumpon",
 		"dumpoff",
 		"dumpvars",
+		// Extended VCD. Longer keywords must be before shorter ones.
+		"dumpportsall",
+		"dumpportsoff",
+		"dumpportson",
+		"dumpports",
+		"vcdclose",
 		//"end",
 	}
 
@@ -82,6 +92,10 @@ var stringlessRules = []lexer.SimpleRule{
 		Name:    "StateString",
 		Pattern: StatePattern,
 	},
+	{
+		Name:    "PortString",
+		Pattern: PortPattern,
+	},
 	{
 		Name:    "IdCode",
 		Pattern: AnyWordPattern,
@@ -180,7 +194,22 @@ var anyWordsEndingWithKwEndWithWs = []lexer.Rule{
 //
 // The lexer is lightly stateful to allow date and comment keywords and such.
 func NewLexer() *lexer.StatefulDefinition {
-	rules := lexer.Rules{
+	return lexer.MustStateful(lexerRules())
+}
+
+// NewSimulationLexer returns a lexer that starts out in the state that the
+// lexer from NewLexer enters after `$enddefinitions`. It is used to parse
+// the simulation section of a VCD file on its own.
+func NewSimulationLexer() *lexer.StatefulDefinition {
+	rules := lexerRules()
+	// The declaration rules are kept in an unreachable state, so that the
+	// token types are the same as in NewLexer.
+	rules["Declarations"], rules["Root"] = rules["Root"], rules["AfterEnddefinitions"]
+	return lexer.MustStateful(rules)
+}
+
+func lexerRules() lexer.Rules {
+	return lexer.Rules{
 		"Root": SimpleRules([]lexer.Rule{
 			{Name: "KwDate", Pattern: `\$date`, Action: lexer.Push("DateTokens")},
 			{Name: "KwComment", Pattern: `\$comment`, Action: lexer.Push("CommentTokens")},
@@ -188,6 +217,7 @@ func NewLexer() *lexer.StatefulDefinition {
 			{Name: "KwVar", Pattern: `\$var`, Action: lexer.Push("VarTokens")},
 			{Name: "KwAttrbegin", Pattern: `\$attrbegin`, Action: lexer.Push("AttrBeginTokens")},
 			{Name: "KwAttrend", Pattern: `\$attrend`, Action: lexer.Push("AttrEndTokens")},
+			{Name: "KwScope", Pattern: `\$scope`, Action: lexer.Push("ScopeTokens")},
 			// Longer keywords must be before shorter ones, else mixups will occur.
 			{Name: "KwEnddefinitions", Pattern: `\$enddefinitions`, Action: lexer.Push("AfterEnddefinitions")},
 			{Name: "KwEnd", Pattern: `\$end`, Action: nil},
@@ -199,14 +229,22 @@ func NewLexer() *lexer.StatefulDefinition {
 		"AttrBeginTokens": {lexer.Include("DateTokens")},
 		"AttrEndTokens":   {lexer.Include("DateTokens")},
 		"VarTokens":       anyWordsEndingWithKwEndWithWs,
+		// Scope names must not lex as anything else, as `bus` would lex
+		// as a binstring followed by an identifier. They may be escaped
+		// identifiers, or have dots and such, as generate blocks do.
+		"ScopeTokens": {
+			{Name: "KwEnd", Pattern: `\$end`, Action: lexer.Pop()},
+			{Name: "ScopeName", Pattern: AnyWordPattern, Action: nil},
+			{Name: "ws", Pattern: WhitespacePattern, Action: nil},
+		},
 
 		"AfterEnddefinitions": SimpleStringlessRules([]lexer.Rule{
 			{Name: "KwEnd", Pattern: `\$end`, Action: nil},
 			{Name: "KwComment", Pattern: `\$comment`, Action: lexer.Push("CommentTokens")},
+			{Name: "KwAttrbegin", Pattern: `\$attrbegin`, Action: lexer.Push("AttrBeginTokens")},
+			{Name: "KwAttrend", Pattern: `\$attrend`, Action: lexer.Push("AttrEndTokens")},
 		}),
 	}
-	//fmt.Printf("Rules: %+v", rules["AfterEnddefinitions"])
-	return lexer.MustStateful(rules)
 }
 
 func NewIdLexer() *lexer.StatefulDefinition {
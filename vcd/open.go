@@ -0,0 +1,135 @@
+package vcd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Stdin is the file name that Open takes to mean the standard input.
+const Stdin = "-"
+
+// Compression is the compression format of an input.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionBzip2
+	CompressionZstd
+	CompressionXz
+)
+
+func (self Compression) String() string {
+	switch self {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionXz:
+		return "xz"
+	}
+	return "none"
+}
+
+var magics = []struct {
+	magic       []byte
+	compression Compression
+}{
+	{[]byte{0x1f, 0x8b}, CompressionGzip},
+	{[]byte("BZh"), CompressionBzip2},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, CompressionZstd},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, CompressionXz},
+}
+
+// Open opens the named file for reading, decompressing it on the fly if it
+// is compressed. The name Stdin opens the standard input. The format is
+// found from the contents, not from the file name; see Decompress.
+func Open(name string) (io.ReadCloser, error) {
+	if name == Stdin {
+		r, _, err := Decompress(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("vcd.Open: <stdin>: %w", err)
+		}
+		// The standard input is not ours to close.
+		return r, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("vcd.Open: %w", err)
+	}
+	r, _, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("vcd.Open: %v: %w", name, err)
+	}
+	return &closers{Reader: r, closers: []io.Closer{r, f}}, nil
+}
+
+// Decompress returns a reader of the decompressed contents of r, if r is
+// compressed with gzip, bzip2, zstd or xz. Otherwise the reader returns the
+// contents of r as they are. Closing the returned reader does not close r.
+func Decompress(r io.Reader) (io.ReadCloser, Compression, error) {
+	b := bufio.NewReader(r)
+	// Short inputs are not compressed.
+	head, err := b.Peek(6)
+	if err != nil && err != io.EOF {
+		return nil, CompressionNone, fmt.Errorf("vcd.Decompress: %w", err)
+	}
+	err = nil
+	compression := CompressionNone
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			compression = m.compression
+			break
+		}
+	}
+	var ret io.ReadCloser
+	switch compression {
+	case CompressionNone:
+		ret = io.NopCloser(b)
+	case CompressionGzip:
+		ret, err = gzip.NewReader(b)
+	case CompressionBzip2:
+		ret = io.NopCloser(bzip2.NewReader(b))
+	case CompressionZstd:
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(b); err == nil {
+			ret = d.IOReadCloser()
+		}
+	case CompressionXz:
+		var x *xz.Reader
+		if x, err = xz.NewReader(b); err == nil {
+			ret = io.NopCloser(x)
+		}
+	}
+	if err != nil {
+		return nil, compression, fmt.Errorf("vcd.Decompress: %v: %w", compression, err)
+	}
+	return ret, compression, nil
+}
+
+// closers is a reader that closes several things.
+type closers struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (self *closers) Close() error {
+	var ret error
+	for _, c := range self.closers {
+		if err := c.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
@@ -0,0 +1,114 @@
+package vcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const openTestInput = "$enddefinitions $end\n#0\n1!\n"
+
+func compress(t *testing.T, c Compression, text string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch c {
+	case CompressionNone:
+		return []byte(text)
+	case CompressionGzip:
+		w = gzip.NewWriter(&b)
+	case CompressionZstd:
+		w, err = zstd.NewWriter(&b)
+	case CompressionXz:
+		w, err = xz.NewWriter(&b)
+	default:
+		t.Fatalf("no writer for: %v", c)
+	}
+	if err != nil {
+		t.Fatalf("could not create writer: %v", err)
+	}
+	if _, err := io.WriteString(w, text); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	t.Parallel()
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd, CompressionXz} {
+		c := c
+		t.Run(c.String(), func(t *testing.T) {
+			r, actual, err := Decompress(bytes.NewReader(compress(t, c, openTestInput)))
+			if err != nil {
+				t.Fatalf("could not decompress: %v", err)
+			}
+			defer r.Close()
+			if actual != c {
+				t.Errorf("want: %v, got: %v", c, actual)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("could not read: %v", err)
+			}
+			if string(b) != openTestInput {
+				t.Errorf("want: %q, got: %q", openTestInput, b)
+			}
+		})
+	}
+}
+
+func TestDecompressShortInput(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"", "#", "\x1f"} {
+		r, c, err := Decompress(bytes.NewReader([]byte(input)))
+		if err != nil {
+			t.Fatalf("%q: could not decompress: %v", input, err)
+		}
+		if c != CompressionNone {
+			t.Errorf("%q: want no compression, got: %v", input, c)
+		}
+		if b, _ := io.ReadAll(r); string(b) != input {
+			t.Errorf("want: %q, got: %q", input, b)
+		}
+	}
+	// Looks like gzip, but is not.
+	if _, _, err := Decompress(bytes.NewReader([]byte("\x1f\x8b"))); err == nil {
+		t.Errorf("want error for a truncated gzip header")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	// The name does not matter, only the contents do.
+	name := filepath.Join(t.TempDir(), "dump.vcd")
+	if err := os.WriteFile(name, compress(t, CompressionGzip, openTestInput), 0o644); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatalf("could not open: %v", err)
+	}
+	f, err := NewReader(r, WithFilename(name)).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+	if len(f.SimulationCommand) != 2 {
+		t.Errorf("want 2 simulation commands, got: %v", len(f.SimulationCommand))
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.vcd")); err == nil {
+		t.Errorf("want error for a missing file")
+	}
+}
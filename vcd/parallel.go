@@ -0,0 +1,298 @@
+package vcd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// ParallelChunkSize is the approximate size in bytes of the pieces of the
+// simulation section that a parallel Reader scans at once.
+var ParallelChunkSize = 1 << 20
+
+// WithWorkers makes the Reader scan the simulation section with n goroutines.
+// The input is split into chunks at timestamps, the chunks are scanned in
+// parallel, and the commands are handed out in their original order. The
+// results, errors and diagnostics are the same as those of a sequential
+// Reader. n <= 0 uses one goroutine per CPU, and n == 1 is the same as not
+// giving this option at all.
+//
+// A parallel Reader runs goroutines until the input is read to the end or an
+// error occurs; call Close if you stop reading before that.
+func WithWorkers(n int) ReaderOption {
+	return func(r *Reader) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		r.workers = n
+	}
+}
+
+// chunk is a piece of the simulation section that starts at a command.
+type chunk struct {
+	data []byte
+	pos  lexer.Position // The position of data[0].
+	line []byte         // The part of the line before data, for snippets.
+	out  chan chunkResult
+}
+
+// chunkResult is what scanning a chunk produces.
+type chunkResult struct {
+	cmds  []*SimulationCommandT
+	diags []*ParseError
+	err   error // Comes after cmds; io.EOF only at the end of input.
+}
+
+// parallel is the state of a parallel Reader.
+type parallel struct {
+	results chan chan chunkResult // In input order.
+	done    chan struct{}         // Closed to stop the goroutines.
+	stop    sync.Once
+
+	cmds []*SimulationCommandT // Not yet handed out, from the current chunk.
+	err  error                 // Comes after cmds.
+}
+
+// startParallel starts splitting and scanning the rest of the input, which
+// must follow the declarations.
+func (self *Reader) startParallel() *parallel {
+	ret := &parallel{
+		results: make(chan chan chunkResult, 2*self.workers),
+		done:    make(chan struct{}),
+	}
+	jobs := make(chan *chunk)
+	for i := 0; i < self.workers; i++ {
+		go func() {
+			for c := range jobs {
+				c.out <- c.scan(self.lenient)
+			}
+		}()
+	}
+	sp := &splitter{r: self.s.r, pos: self.s.pos}
+	line := bytes.Clone(self.s.line)
+	go func() {
+		defer close(ret.results)
+		defer close(jobs)
+		for {
+			c := &chunk{pos: sp.pos, line: line, out: make(chan chunkResult, 1)}
+			line = nil
+			var err error
+			c.data, err = sp.next(self.chunkSize)
+			if err != nil {
+				c.data = nil
+				c.out <- chunkResult{err: err}
+			}
+			select {
+			case ret.results <- c.out:
+			case <-ret.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+			if len(c.data) == 0 {
+				c.out <- chunkResult{err: io.EOF}
+				return
+			}
+			select {
+			case jobs <- c:
+			case <-ret.done:
+				return
+			}
+		}
+	}()
+	return ret
+}
+
+// nextParallel is Next for a parallel Reader.
+func (self *Reader) nextParallel() (*SimulationCommandT, error) {
+	if self.par == nil {
+		self.par = self.startParallel()
+	}
+	p := self.par
+	// A chunk may have no commands at all, or only malformed ones.
+	for len(p.cmds) == 0 {
+		if p.err != nil {
+			p.close()
+			return nil, p.err
+		}
+		res := <-<-p.results
+		for _, d := range res.diags {
+			self.addDiagnostic(d)
+		}
+		p.cmds, p.err = res.cmds, res.err
+	}
+	ret := p.cmds[0]
+	p.cmds[0] = nil
+	p.cmds = p.cmds[1:]
+	return ret, nil
+}
+
+// ErrClosed is returned by Next after Close.
+var ErrClosed = errors.New("vcd.Reader: closed")
+
+// Close stops the goroutines of a parallel Reader. It is not needed once
+// Next has returned an error, including io.EOF. It does not close the
+// underlying reader, but it does close a Source that is an io.Closer.
+func (self *Reader) Close() error {
+	if self.err == nil {
+		self.err = ErrClosed
+	}
+	if self.par != nil {
+		self.par.close()
+	}
+	return self.closeSource()
+}
+
+func (self *parallel) close() {
+	self.stop.Do(func() { close(self.done) })
+}
+
+// scan scans all commands of the chunk, the same way the sequential Reader
+// would.
+func (self *chunk) scan(lenient bool) chunkResult {
+	var ret chunkResult
+	s := newScanner(bytes.NewReader(self.data), self.pos.Filename)
+	s.pos, s.line = self.pos, self.line
+	if lenient {
+		s.report = func(err *ParseError) {
+			ret.diags = append(ret.diags, err)
+		}
+	}
+	for {
+		c, err := s.command()
+		if err == io.EOF {
+			// The end of the chunk, not of the input.
+			return ret
+		}
+		if err != nil {
+			ret.err = err
+			return ret
+		}
+		ret.cmds = append(ret.cmds, c)
+	}
+}
+
+// splitter splits the simulation section into chunks. A chunk ends right
+// before a line that starts with a timestamp, but only if everything before
+// that line is complete: it is not in a command that lacks its $end yet,
+// and the last value change is not waiting for its id code. A timestamp
+// there can not mean anything else, so the scanner is in the same state at
+// the start of each chunk as it would be at that point of the whole input.
+type splitter struct {
+	r   *bufio.Reader
+	pos lexer.Position // The position of the start of the next chunk.
+
+	carry []byte // The first line of the next chunk.
+
+	inCommand bool // In a command that lacks its $end yet.
+	operands  int  // The number of words that the last value change lacks.
+}
+
+// next returns the next chunk, which is at least size bytes long unless it
+// is the last one. Returns an empty chunk at the end of input.
+func (self *splitter) next(size int) ([]byte, error) {
+	ret := make([]byte, 0, size+len(self.carry)+scannerBufferSize)
+	ret = append(ret, self.carry...)
+	self.words(self.carry)
+	self.carry = nil
+	for {
+		start := len(ret)
+		var err error
+		for {
+			var b []byte
+			b, err = self.r.ReadSlice('\n')
+			ret = append(ret, b...)
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line := ret[start:]
+		if start >= size && len(line) > 0 && line[0] == '#' && !self.inCommand && self.operands == 0 {
+			self.carry = bytes.Clone(line)
+			ret = ret[:start]
+			break
+		}
+		self.words(line)
+		if err == io.EOF {
+			break
+		}
+	}
+	self.pos.Offset += len(ret)
+	if n := bytes.Count(ret, []byte{'\n'}); n > 0 {
+		self.pos.Line += n
+		self.pos.Column = 1
+	}
+	return ret, nil
+}
+
+// words keeps track of where the commands in b start and end.
+func (self *splitter) words(b []byte) {
+	for i := 0; i < len(b); {
+		for i < len(b) && isSpace(b[i]) {
+			i++
+		}
+		j := i
+		for j < len(b) && !isSpace(b[j]) {
+			j++
+		}
+		if j > i {
+			self.word(b[i:j])
+		}
+		i = j
+	}
+}
+
+func (self *splitter) word(w []byte) {
+	switch {
+	case self.operands > 0:
+		self.operands--
+	case self.inCommand:
+		self.inCommand = string(w) != "$end"
+	case w[0] == '$':
+		self.inCommand = string(w) != "$end"
+	default:
+		self.operands = operandCount(w)
+	}
+}
+
+// operandCount returns the number of words that follow w, as the first word
+// of a value change, in the same value change. See scanner.valueChange.
+func operandCount(w []byte) int {
+	switch c := w[0]; {
+	case c == '#':
+		return 0
+	case c == 'b' || c == 'B':
+		if n := binstringLen(w); n > 1 {
+			return boolToInt(n == len(w))
+		}
+	case c == 'r' || c == 'R':
+		if n := floatLen(w[1:]); n > 0 {
+			return boolToInt(n+1 == len(w))
+		}
+	case c == 'p':
+		if portLen(w) == len(w) {
+			return 3
+		}
+	case c == 's':
+		if len(w) > 1 {
+			return 1
+		}
+	}
+	return boolToInt(len(w) == 1 && isScalarValue(w[0]))
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package vcd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+const parallelTestHeader = `$timescale 1 ns $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var wire 4 " data $end
+$var real 1 # r $end
+$var port 1 % p $end
+$upscope $end
+$enddefinitions $end`
+
+// parallelTestInput returns a simulation section with n timestamps, and the
+// things that a split at a timestamp must not break up.
+func parallelTestInput(n int) string {
+	rnd := rand.New(rand.NewSource(int64(n)))
+	var b strings.Builder
+	b.WriteString(parallelTestHeader)
+	b.WriteString(" #0 $dumpvars 0! b0 \" $end\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "#%d\n", 10*i)
+		switch rnd.Intn(8) {
+		case 0:
+			b.WriteString("$comment\n#1 is not a timestamp here\n$end\n")
+		case 1:
+			// The id code # is on a line of its own.
+			b.WriteString("r1.5\n#\n")
+		case 2:
+			b.WriteString("b1010\n\"\n1\n!\n")
+		case 3:
+			b.WriteString("$dumpall\n1\n#\n$end\n")
+		case 4:
+			b.WriteString("pD\n6\n0\n%\n")
+		case 5:
+			b.WriteString("$vcdclose\n#5 $end\n")
+		default:
+			fmt.Fprintf(&b, "%d!\nb%b \"\n", i%2, i%16)
+		}
+	}
+	return b.String()
+}
+
+// readAll reads everything from a Reader with the given number of workers
+// and chunk size, and returns the commands and the error that ended it.
+func readAll(input string, workers, chunkSize int, opts ...ReaderOption) ([]*SimulationCommandT, *Reader, error) {
+	opts = append(opts, WithFilename("test.vcd"), WithWorkers(workers))
+	r := NewReader(strings.NewReader(input), opts...)
+	r.chunkSize = chunkSize
+	var ret []*SimulationCommandT
+	for {
+		c, err := r.Next()
+		if err != nil {
+			return ret, r, err
+		}
+		ret = append(ret, c)
+	}
+}
+
+func TestParallelReader(t *testing.T) {
+	t.Parallel()
+	inputs := map[string]string{
+		"empty":      parallelTestHeader,
+		"one":        parallelTestHeader + "\n#0\n1!\n",
+		"same line":  parallelTestHeader + " #0 1! #1 0!",
+		"generated":  parallelTestInput(500),
+		"no newline": parallelTestInput(50) + "#1000",
+	}
+	for name, input := range inputs {
+		name, input := name, input
+		t.Run(name, func(t *testing.T) {
+			expected, _, err := readAll(input, 1, 0)
+			if err != io.EOF {
+				t.Fatalf("read error: %v", err)
+			}
+			for _, workers := range []int{2, 4} {
+				for _, size := range []int{1, 100, 1 << 20} {
+					actual, _, err := readAll(input, workers, size)
+					if err != io.EOF {
+						t.Fatalf("workers %v, size %v: read error: %v", workers, size, err)
+					}
+					if !reflect.DeepEqual(expected, actual) {
+						t.Fatalf("workers %v, size %v:\nwant: %v\ngot:  %v",
+							workers, size, spew.Sdump(expected), spew.Sdump(actual))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParallelReaderErrors(t *testing.T) {
+	t.Parallel()
+	// Errors in several chunks; only the first one counts.
+	input := parallelTestInput(100) + "#2000\nq\n#2010\n1!\n#2020\n$bogus $end\n#2030\n1!\n"
+	line := strings.Count(parallelTestInput(100), "\n") + 2
+	expected, _, expectedErr := readAll(input, 1, 0)
+	actual, _, err := readAll(input, 4, 50)
+	if !reflect.DeepEqual(expectedErr, err) {
+		t.Errorf("error:\nwant: %v\ngot:  %v", expectedErr, err)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Position().Line != line {
+		t.Errorf("want a parse error, got: %#v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("commands before the error:\nwant: %v\ngot:  %v", spew.Sdump(expected), spew.Sdump(actual))
+	}
+
+	expected, r, err := readAll(input, 1, 0, WithLenient())
+	if err != io.EOF {
+		t.Fatalf("lenient read error: %v", err)
+	}
+	expectedDiags := r.Diagnostics()
+	actual, r, err = readAll(input, 4, 50, WithLenient())
+	if err != io.EOF {
+		t.Fatalf("lenient read error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("lenient:\nwant: %v\ngot:  %v", spew.Sdump(expected), spew.Sdump(actual))
+	}
+	if len(expectedDiags) != 2 || !reflect.DeepEqual(expectedDiags, r.Diagnostics()) {
+		t.Errorf("diagnostics:\nwant: %v\ngot:  %v", expectedDiags, r.Diagnostics())
+	}
+}
+
+func TestParallelReaderClose(t *testing.T) {
+	t.Parallel()
+	r := NewReader(strings.NewReader(parallelTestInput(1000)), WithWorkers(2))
+	r.chunkSize = 10
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+	if _, err := r.Next(); err != ErrClosed {
+		t.Errorf("want: %v, got: %v", ErrClosed, err)
+	}
+}
@@ -2,6 +2,8 @@ package vcd
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	participle "github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
@@ -21,7 +23,7 @@ type DeclarationCommandT struct {
 	Var         *VarT   `parser:"| @KwVar (@Ws? @AnyNonspace)* @Ws? @KwEndSpecial" json:",omitempty"`
 	Date        *string `parser:"| @KwDate @AnyNonspace* @KwEndSpecial" json:",omitempty"`
 	Version     *string `parser:"| @KwVersion @AnyNonspace* @KwEndSpecial" json:",omitempty"`
-	Attrbegin   *bool   `parser:"| @KwAttrbegin @AnyNonspace* @KwEndSpecial" json:",omitempty"`
+	Attrbegin   *AttrT  `parser:"| @KwAttrbegin @AnyNonspace* @KwEndSpecial" json:",omitempty"`
 	Attrend     *bool   `parser:"| @KwAttrend @AnyNonspace* @KwEndSpecial" json:",omitempty"`
 
 	EndDefinitions *bool `parser:"| @KwEnddefinitions (@KwEnd|@KwEndSpecial)" json:",omitempty"`
@@ -53,6 +55,21 @@ type VarTypeT struct {
 	// Extensions?
 	Logic  bool `parser:"| @\"logic\"" json:",omitempty"`
 	String bool `parser:"| @\"string\"" json:",omitempty"`
+
+	// Extended VCD.
+	Port bool `parser:"| @\"port\"" json:",omitempty"`
+
+	// SystemVerilog, as written by Verilator, Xcelium and GTKWave.
+	Bit           bool `parser:"| @\"bit\"" json:",omitempty"`
+	Byte          bool `parser:"| @\"byte\"" json:",omitempty"`
+	Shortint      bool `parser:"| @\"shortint\"" json:",omitempty"`
+	Int           bool `parser:"| @\"int\"" json:",omitempty"`
+	Longint       bool `parser:"| @\"longint\"" json:",omitempty"`
+	Shortreal     bool `parser:"| @\"shortreal\"" json:",omitempty"`
+	Realtime      bool `parser:"| @\"realtime\"" json:",omitempty"`
+	RealParameter bool `parser:"| @\"real_parameter\"" json:",omitempty"`
+	Enum          bool `parser:"| @\"enum\"" json:",omitempty"`
+	Sparray       bool `parser:"| @\"sparray\"" json:",omitempty"`
 }
 
 // VarKindCode is the type code for a variable.
@@ -80,36 +97,123 @@ const (
 	// Extensions?
 	VarKindLogic
 	VarKindString
+
+	// Extended VCD.
+	VarKindPort
+
+	// SystemVerilog.
+	VarKindBit
+	VarKindByte
+	VarKindShortint
+	VarKindInt
+	VarKindLongint
+	VarKindShortreal
+	VarKindRealtime
+	VarKindRealParameter
+	VarKindEnum
+	VarKindSparray
+
 	VarKindUnknown
 )
 
-var stringToVarKind = map[string]VarKindCode{
-	"event":     VarKindEvent,
-	"integer":   VarKindInteger,
-	"parameter": VarKindParameter,
-	"real":      VarKindReal,
-	"reg":       VarKindReg,
-	"supply0":   VarKindSupply0,
-	"supply1":   VarKindSupply1,
-	"time":      VarKindTime,
-	"tri":       VarKindTri,
-	"triand":    VarKindTriand,
-	"trior":     VarKindTrior,
-	"trireg":    VarKindTrireg,
-	"tri0":      VarKindTri0,
-	"tri1":      VarKindTri1,
-	"wand":      VarKindWand,
-	"wire":      VarKindWire,
-	"wor":       VarKindWor,
+var varKindNames = [...]string{
+	VarKindEvent:     "event",
+	VarKindInteger:   "integer",
+	VarKindParameter: "parameter",
+	VarKindReal:      "real",
+	VarKindReg:       "reg",
+	VarKindSupply0:   "supply0",
+	VarKindSupply1:   "supply1",
+	VarKindTime:      "time",
+	VarKindTri:       "tri",
+	VarKindTriand:    "triand",
+	VarKindTrior:     "trior",
+	VarKindTrireg:    "trireg",
+	VarKindTri0:      "tri0",
+	VarKindTri1:      "tri1",
+	VarKindWand:      "wand",
+	VarKindWire:      "wire",
+	VarKindWor:       "wor",
 	// Extensions?
-	"logic":  VarKindLogic,
-	"string": VarKindString,
-}
+	VarKindLogic:  "logic",
+	VarKindString: "string",
+	// Extended VCD.
+	VarKindPort: "port",
+	// SystemVerilog.
+	VarKindBit:           "bit",
+	VarKindByte:          "byte",
+	VarKindShortint:      "shortint",
+	VarKindInt:           "int",
+	VarKindLongint:       "longint",
+	VarKindShortreal:     "shortreal",
+	VarKindRealtime:      "realtime",
+	VarKindRealParameter: "real_parameter",
+	VarKindEnum:          "enum",
+	VarKindSparray:       "sparray",
+}
+
+// stringToVarKind maps the keywords of the variable kinds to them.
+var stringToVarKind = func() map[string]VarKindCode {
+	ret := make(map[string]VarKindCode, len(varKindNames))
+	for k, name := range varKindNames {
+		ret[name] = VarKindCode(k)
+	}
+	return ret
+}()
 
 func (self VarKindCode) Int() int {
 	return int(self)
 }
 
+// String returns the keyword of the variable kind, as in `$var wire ...`.
+func (self VarKindCode) String() string {
+	if self >= 0 && int(self) < len(varKindNames) {
+		return varKindNames[self]
+	}
+	return fmt.Sprintf("VarKindCode(%d)", int(self))
+}
+
+// ValueEncoding is how the value changes of a variable are written.
+type ValueEncoding int
+
+const (
+	// EncodingVector values are scalars such as `1!`, or binary vectors
+	// such as `b10z1 !`.
+	EncodingVector ValueEncoding = iota
+	// EncodingReal values are real numbers such as `r1.5 !`.
+	EncodingReal
+	// EncodingString values are strings such as `sidle !`.
+	EncodingString
+	// EncodingPort values are extended VCD port values such as
+	// `pD 6 0 <0`.
+	EncodingPort
+)
+
+// Encoding returns the encoding of the value changes of a variable of this
+// kind. The values of enum variables are vectors, whose names come from the
+// enum table in the attributes of the variable.
+func (self VarKindCode) Encoding() ValueEncoding {
+	switch self {
+	case VarKindReal, VarKindRealtime, VarKindShortreal, VarKindRealParameter:
+		return EncodingReal
+	case VarKindString:
+		return EncodingString
+	case VarKindPort:
+		return EncodingPort
+	}
+	return EncodingVector
+}
+
+// TwoState reports whether variables of this kind only take the values 0
+// and 1. Simulators still write their values as vectors.
+func (self VarKindCode) TwoState() bool {
+	switch self {
+	case VarKindBit, VarKindByte, VarKindShortint, VarKindInt, VarKindLongint:
+		return true
+	}
+	return false
+}
+
 func (self VarT) GetVarKind() VarKindCode {
 	v, ok := stringToVarKind[self.VarType]
 	if !ok {
@@ -125,6 +229,11 @@ type TimescaleT struct {
 	Kw2    bool      `parser:"@KwEnd" json:"-"`
 }
 
+// String returns the timescale as written in `$timescale`, such as `10 ps`.
+func (self TimescaleT) String() string {
+	return fmt.Sprintf("%v %v", self.Number, self.Unit)
+}
+
 // AsSeconds returns the number of seconds (possibly fractional, possibly very small)
 func (self TimescaleT) AsSeconds() float64 {
 	return float64(self.Number) * self.Unit.Multiplier()
@@ -144,6 +253,47 @@ type TimeUnit struct {
 	FemtoSecond bool `parser:"|  @\"fs\"" json:",omitempty"`
 }
 
+// String returns the unit as written in `$timescale`, such as `ns`.
+func (self TimeUnit) String() string {
+	switch {
+	case self.Second:
+		return "s"
+	case self.MilliSecond:
+		return "ms"
+	case self.MicroSecond:
+		return "us"
+	case self.NanoSecond:
+		return "ns"
+	case self.PicoSecond:
+		return "ps"
+	case self.FemtoSecond:
+		return "fs"
+	}
+	return ""
+}
+
+// ParseTimeUnit returns the unit written as s in `$timescale`, such as `ns`.
+func ParseTimeUnit(s string) (*TimeUnit, error) {
+	var ret TimeUnit
+	switch s {
+	case "s":
+		ret.Second = true
+	case "ms":
+		ret.MilliSecond = true
+	case "us":
+		ret.MicroSecond = true
+	case "ns":
+		ret.NanoSecond = true
+	case "ps":
+		ret.PicoSecond = true
+	case "fs":
+		ret.FemtoSecond = true
+	default:
+		return nil, fmt.Errorf("vcd.ParseTimeUnit: unknown unit: %q", s)
+	}
+	return &ret, nil
+}
+
 func (self TimeUnit) Multiplier() float64 {
 	switch {
 	case self.Second:
@@ -162,11 +312,17 @@ func (self TimeUnit) Multiplier() float64 {
 	return 0.0
 }
 
+// ScopeT is a `$scope` declaration. Id is the name as it was written, which
+// may be an escaped identifier; see Scope.Name for the name without escapes.
 type ScopeT struct {
 	Scope     bool       `parser:"@KwScope" json:",omitempty"`
 	ScopeKind ScopeKindT `parser:"@@" json:",omitempty"`
-	Id        string     `parser:"@Ident" json:",omitempty"`
+	Id        string     `parser:"@ScopeName" json:",omitempty"`
 	KwEnd     bool       `parser:"@KwEnd" json:"-"`
+
+	// Attrs are the attributes declared right before the scope. See
+	// LinkAttributes.
+	Attrs []*AttrT `parser:"" json:",omitempty"`
 }
 
 type ScopeKindCode int
@@ -179,19 +335,95 @@ const (
 	ScopeKindTask
 	ScopeKindVHDLArchitecture
 	ScopeKindVHDLRecord
+
+	// SystemVerilog.
+	ScopeKindGenerate
+	ScopeKindStruct
+	ScopeKindUnion
+	ScopeKindClass
+	ScopeKindInterface
+	ScopeKindPackage
+	ScopeKindProgram
+
+	// VHDL, as written by GTKWave and nvc.
+	ScopeKindVHDLProcedure
+	ScopeKindVHDLFunction
+	ScopeKindVHDLProcess
+	ScopeKindVHDLBlock
+	ScopeKindVHDLForGenerate
+	ScopeKindVHDLIfGenerate
+	ScopeKindVHDLGenerate
+	ScopeKindVHDLPackage
+
 	ScopeKindUnknown
 )
 
+func (self ScopeKindCode) Int() int {
+	return int(self)
+}
+
+var scopeKindNames = [...]string{
+	ScopeKindBegin:            "begin",
+	ScopeKindFork:             "fork",
+	ScopeKindModule:           "module",
+	ScopeKindFunction:         "function",
+	ScopeKindTask:             "task",
+	ScopeKindVHDLArchitecture: "vhdl_architecture",
+	ScopeKindVHDLRecord:       "vhdl_record",
+	ScopeKindGenerate:         "generate",
+	ScopeKindStruct:           "struct",
+	ScopeKindUnion:            "union",
+	ScopeKindClass:            "class",
+	ScopeKindInterface:        "interface",
+	ScopeKindPackage:          "package",
+	ScopeKindProgram:          "program",
+	ScopeKindVHDLProcedure:    "vhdl_procedure",
+	ScopeKindVHDLFunction:     "vhdl_function",
+	ScopeKindVHDLProcess:      "vhdl_process",
+	ScopeKindVHDLBlock:        "vhdl_block",
+	ScopeKindVHDLForGenerate:  "vhdl_for_generate",
+	ScopeKindVHDLIfGenerate:   "vhdl_if_generate",
+	ScopeKindVHDLGenerate:     "vhdl_generate",
+	ScopeKindVHDLPackage:      "vhdl_package",
+}
+
+// String returns the keyword of the scope kind, as in `$scope module ...`.
+func (self ScopeKindCode) String() string {
+	if self >= 0 && int(self) < len(scopeKindNames) {
+		return scopeKindNames[self]
+	}
+	return fmt.Sprintf("ScopeKindCode(%d)", int(self))
+}
+
 type ScopeKindT struct {
 	Begin    bool `parser:"@\"begin\"" json:",omitempty"`
-	Fork     bool `parser:"| \"fork\"" json:",omitempty"`
-	Function bool `parser:"| \"function\"" json:",omitempty"`
+	Fork     bool `parser:"| @\"fork\"" json:",omitempty"`
+	Function bool `parser:"| @\"function\"" json:",omitempty"`
 	Module   bool `parser:"| @\"module\"" json:",omitempty"`
-	Task     bool `parser:"| \"task\"" json:",omitempty"`
+	Task     bool `parser:"| @\"task\"" json:",omitempty"`
 
 	// Extensions?
-	VHDLArchitecture bool `parser:"| \"vhdl_architecture\"" json:",omitempty"`
-	VHDLRecord       bool `parser:"| \"vhdl_record\"" json:",omitempty"`
+	VHDLArchitecture bool `parser:"| @\"vhdl_architecture\"" json:",omitempty"`
+	VHDLRecord       bool `parser:"| @\"vhdl_record\"" json:",omitempty"`
+
+	// SystemVerilog.
+	Generate  bool `parser:"| @\"generate\"" json:",omitempty"`
+	Struct    bool `parser:"| @\"struct\"" json:",omitempty"`
+	Union     bool `parser:"| @\"union\"" json:",omitempty"`
+	Class     bool `parser:"| @\"class\"" json:",omitempty"`
+	Interface bool `parser:"| @\"interface\"" json:",omitempty"`
+	Package   bool `parser:"| @\"package\"" json:",omitempty"`
+	Program   bool `parser:"| @\"program\"" json:",omitempty"`
+
+	// VHDL, as written by GTKWave and nvc.
+	VHDLProcedure   bool `parser:"| @\"vhdl_procedure\"" json:",omitempty"`
+	VHDLFunction    bool `parser:"| @\"vhdl_function\"" json:",omitempty"`
+	VHDLProcess     bool `parser:"| @\"vhdl_process\"" json:",omitempty"`
+	VHDLBlock       bool `parser:"| @\"vhdl_block\"" json:",omitempty"`
+	VHDLForGenerate bool `parser:"| @\"vhdl_for_generate\"" json:",omitempty"`
+	VHDLIfGenerate  bool `parser:"| @\"vhdl_if_generate\"" json:",omitempty"`
+	VHDLGenerate    bool `parser:"| @\"vhdl_generate\"" json:",omitempty"`
+	VHDLPackage     bool `parser:"| @\"vhdl_package\"" json:",omitempty"`
 }
 
 func (self ScopeKindT) Kind() ScopeKindCode {
@@ -210,6 +442,36 @@ func (self ScopeKindT) Kind() ScopeKindCode {
 		return ScopeKindVHDLArchitecture
 	case self.VHDLRecord:
 		return ScopeKindVHDLRecord
+	case self.Generate:
+		return ScopeKindGenerate
+	case self.Struct:
+		return ScopeKindStruct
+	case self.Union:
+		return ScopeKindUnion
+	case self.Class:
+		return ScopeKindClass
+	case self.Interface:
+		return ScopeKindInterface
+	case self.Package:
+		return ScopeKindPackage
+	case self.Program:
+		return ScopeKindProgram
+	case self.VHDLProcedure:
+		return ScopeKindVHDLProcedure
+	case self.VHDLFunction:
+		return ScopeKindVHDLFunction
+	case self.VHDLProcess:
+		return ScopeKindVHDLProcess
+	case self.VHDLBlock:
+		return ScopeKindVHDLBlock
+	case self.VHDLForGenerate:
+		return ScopeKindVHDLForGenerate
+	case self.VHDLIfGenerate:
+		return ScopeKindVHDLIfGenerate
+	case self.VHDLGenerate:
+		return ScopeKindVHDLGenerate
+	case self.VHDLPackage:
+		return ScopeKindVHDLPackage
 	}
 	return ScopeKindUnknown
 }
@@ -221,8 +483,70 @@ type SimulationCommandT struct {
 	Dumpvars       *DumpvarsT       `parser:"| @@" json:",omitempty"`
 	SimulationTime *SimulationTimeT `parser:"| @@" json:",omitempty"`
 	ValueChange    *ValueChangeT    `parser:"| @@" json:",omitempty"`
-	Attrbegin      *bool            `parser:"| @KwAttrbegin @AnyNonspace* @KwEndSpecial" json:",omitempty"`
+	Attrbegin      *AttrT           `parser:"| @KwAttrbegin @AnyNonspace* @KwEndSpecial" json:",omitempty"`
 	Attrend        *bool            `parser:"| @KwAttrend @AnyNonspace* @KwEndSpecial" json:",omitempty"`
+	CommentText    *string          `parser:"| @KwComment @AnyNonspace* @KwEndSpecial" json:",omitempty"`
+
+	// Extended VCD.
+	Dumpportsall *DumpportsallT `parser:"| @@" json:",omitempty"`
+	Dumpportsoff *DumpportsoffT `parser:"| @@" json:",omitempty"`
+	Dumpportson  *DumpportsonT  `parser:"| @@" json:",omitempty"`
+	Dumpports    *DumpportsT    `parser:"| @@" json:",omitempty"`
+	Vcdclose     *VcdcloseT     `parser:"| @@" json:",omitempty"`
+}
+
+// ValueChanges returns the value changes of the command: the value change
+// itself, or the ones in a block such as $dumpvars. Returns nil for other
+// commands.
+func (self *SimulationCommandT) ValueChanges() []*ValueChangeT {
+	switch {
+	case self.ValueChange != nil:
+		return []*ValueChangeT{self.ValueChange}
+	case self.Dumpall != nil:
+		return self.Dumpall.ValueChange
+	case self.Dumpoff != nil:
+		return self.Dumpoff.ValueChange
+	case self.Dumpon != nil:
+		return self.Dumpon.ValueChange
+	case self.Dumpvars != nil:
+		return self.Dumpvars.ValueChange
+	case self.Dumpportsall != nil:
+		return self.Dumpportsall.ValueChange
+	case self.Dumpportsoff != nil:
+		return self.Dumpportsoff.ValueChange
+	case self.Dumpportson != nil:
+		return self.Dumpportson.ValueChange
+	case self.Dumpports != nil:
+		return self.Dumpports.ValueChange
+	}
+	return nil
+}
+
+// withValueChanges returns a copy of the block command with the value
+// changes vcs in place of its own.
+func (self *SimulationCommandT) withValueChanges(vcs []*ValueChangeT) *SimulationCommandT {
+	ret := &SimulationCommandT{}
+	switch {
+	case self.Dumpall != nil:
+		ret.Dumpall = &DumpallT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpoff != nil:
+		ret.Dumpoff = &DumpoffT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpon != nil:
+		ret.Dumpon = &DumponT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpvars != nil:
+		ret.Dumpvars = &DumpvarsT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpportsall != nil:
+		ret.Dumpportsall = &DumpportsallT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpportsoff != nil:
+		ret.Dumpportsoff = &DumpportsoffT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpportson != nil:
+		ret.Dumpportson = &DumpportsonT{Kw: true, ValueChange: vcs, KwEnd: true}
+	case self.Dumpports != nil:
+		ret.Dumpports = &DumpportsT{Kw: true, ValueChange: vcs, KwEnd: true}
+	default:
+		return self
+	}
+	return ret
 }
 
 type DumpallT struct {
@@ -249,6 +573,38 @@ type DumpvarsT struct {
 	KwEnd       bool            `parser:"@KwEnd" json:",omitempty"`
 }
 
+type DumpportsallT struct {
+	Kw          bool            `parser:"@KwDumpportsall" json:",omitempty"`
+	ValueChange []*ValueChangeT `parser:"@@*" json:",omitempty"`
+	KwEnd       bool            `parser:"@KwEnd" json:",omitempty"`
+}
+
+type DumpportsoffT struct {
+	Kw          bool            `parser:"@KwDumpportsoff" json:",omitempty"`
+	ValueChange []*ValueChangeT `parser:"@@*" json:",omitempty"`
+	KwEnd       bool            `parser:"@KwEnd" json:",omitempty"`
+}
+
+type DumpportsonT struct {
+	Kw          bool            `parser:"@KwDumpportson" json:",omitempty"`
+	ValueChange []*ValueChangeT `parser:"@@*" json:",omitempty"`
+	KwEnd       bool            `parser:"@KwEnd" json:",omitempty"`
+}
+
+type DumpportsT struct {
+	Kw          bool            `parser:"@KwDumpports" json:",omitempty"`
+	ValueChange []*ValueChangeT `parser:"@@*" json:",omitempty"`
+	KwEnd       bool            `parser:"@KwEnd" json:",omitempty"`
+}
+
+// VcdcloseT marks the end of an extended VCD file, at the final simulation
+// time.
+type VcdcloseT struct {
+	Kw             bool             `parser:"@KwVcdclose" json:",omitempty"`
+	SimulationTime *SimulationTimeT `parser:"@@?" json:",omitempty"`
+	KwEnd          bool             `parser:"@KwEnd" json:",omitempty"`
+}
+
 type SimulationKeywordT struct {
 	DumpOff  bool `parser:"@KwDumpoff" json:",omitempty"`
 	DumpOn   bool `parser:"| @KwDumpon" json:",omitempty"`
@@ -259,49 +615,86 @@ type SimulationTimeT struct {
 	DecimalNumber string `parser:"@Timestamp" json:",omitempty"`
 }
 
-func (self SimulationTimeT) Value() uint64 {
-	var ret uint64
-	s := self.DecimalNumber
-	l := len(s)
-	s = s[1:l]
-
-	_, err := fmt.Sscanf(s, "%d", &ret)
+// Value returns the simulation time. Returns an error if the timestamp is
+// not a valid uint64.
+func (self SimulationTimeT) Value() (uint64, error) {
+	s := strings.TrimPrefix(self.DecimalNumber, "#")
+	ret, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		panic(fmt.Sprintf("Value is not parseable as uint64: %q, %+v",
-			s, self.DecimalNumber))
+		return 0, fmt.Errorf("vcd.SimulationTimeT.Value: not a timestamp: %q: %w",
+			self.DecimalNumber, err)
 	}
-	return ret
+	return ret, nil
 }
 
 type ValueChangeT struct {
 	ScalarValueChange *ScalarValueChangeT `parser:"@@" json:",omitempty"`
 	VectorValueChange *VectorValueChangeT `parser:"| @@" json:",omitempty"`
+	PortValueChange   *PortValueChangeT   `parser:"| @@" json:",omitempty"`
 }
 
+// GetIdCode returns the id code of the changed variable, or an empty string
+// if the value change is empty.
 func (self ValueChangeT) GetIdCode() string {
 	switch {
 	case self.ScalarValueChange != nil:
 		return self.ScalarValueChange.GetIdCode()
 	case self.VectorValueChange != nil:
 		return self.VectorValueChange.GetCode()
+	case self.PortValueChange != nil:
+		return self.PortValueChange.IdCode
 	}
-	panic(fmt.Sprintf("unreachable: %+v", self))
+	return ""
 }
 
+// GetValue returns the new value, or an empty string if the value change is
+// empty.
 func (self ValueChangeT) GetValue() string {
 	switch {
 	case self.ScalarValueChange != nil:
 		return self.ScalarValueChange.GetValue()
 	case self.VectorValueChange != nil:
 		return self.VectorValueChange.GetValue()
+	case self.PortValueChange != nil:
+		return self.PortValueChange.GetValue()
+	}
+	return ""
+}
+
+// Encoding returns the encoding of this value change. Empty value changes
+// are vectors.
+func (self ValueChangeT) Encoding() ValueEncoding {
+	switch {
+	case self.PortValueChange != nil:
+		return EncodingPort
+	case self.VectorValueChange == nil:
+		return EncodingVector
+	case self.VectorValueChange.VectorValueChange2 != nil:
+		return EncodingString
+	case self.VectorValueChange.VectorValueChange3 != nil:
+		return EncodingReal
 	}
-	panic(fmt.Sprintf("unreachable: %+v", self))
+	return EncodingVector
+}
+
+// Value returns the value of a scalar or vector value change as a Value.
+// It is not extended to the size of the variable; see Value.Extend.
+// Returns an error for real, string and port value changes.
+func (self ValueChangeT) Value() (Value, error) {
+	if e := self.Encoding(); e != EncodingVector {
+		return Value{}, fmt.Errorf("vcd.ValueChangeT.Value: not a vector value: %q", self.GetValue())
+	}
+	ret, err := ParseValue(self.GetValue())
+	if err != nil {
+		return Value{}, fmt.Errorf("vcd.ValueChangeT.Value: %w", err)
+	}
+	return ret, nil
 }
 
 type ScalarValueChangeT struct {
 	Pos    lexer.Position
 	Value  ValueT `parser:"@@" json:",omitempty"`
-	IdCode string `parser:"@IdCode" json:",omitempty"`
+	IdCode string `parser:"@(IdCode | PortString)" json:",omitempty"`
 	// Garble is used to work around the tokenizer being unable to
 	// make a distinction between [`x*@`] and [`x`, `*@`]. The
 	// correct way to handle this is to write a custom lexer, but
@@ -317,19 +710,19 @@ func (self ScalarValueChangeT) GetIdCode() string {
 	return self.IdCode
 }
 
+// GetValue returns the new value. A Garble of a single character has no
+// id code, so it is taken to be the value.
 func (self ScalarValueChangeT) GetValue() string {
-	g := self.Garble
-	if g != "" {
-		if len(g) < 2 {
-			panic(fmt.Sprintf("garble was weird: %+v", self))
-		}
+	if g := self.Garble; g != "" {
 		return string(g[0])
 	}
 	return self.Value.Value
 }
 
+// ValueT is a scalar value: 0, 1, x or z as in Verilog, or any of the nine
+// values of VHDL's std_logic.
 type ValueT struct {
-	Value string `parser:"@(\"0\" | \"1\" | \"x\" | \"X\"| \"z\" | \"Z\")" json:",omitempty"`
+	Value string `parser:"@(\"0\" | \"1\" | \"x\" | \"X\" | \"z\" | \"Z\" | \"u\" | \"U\" | \"w\" | \"W\" | \"l\" | \"L\" | \"h\" | \"H\" | \"-\")" json:",omitempty"`
 }
 
 type VectorValueChangeT struct {
@@ -366,7 +759,7 @@ func (self VectorValueChangeT) GetValue() string {
 
 type VectorValueChange1T struct {
 	Value  string `parser:"@Binstring" json:",omitempty"`
-	IdCode string `parser:"@IdCode" json:",omitempty"`
+	IdCode string `parser:"@(IdCode | PortString)" json:",omitempty"`
 }
 
 func (self VectorValueChange1T) GetCode() string {
@@ -379,7 +772,7 @@ func (self VectorValueChange1T) GetValue() string {
 
 type VectorValueChange2T struct {
 	Value  string `parser:" @StateString  " json:",omitempty"`
-	IdCode string `parser:" @IdCode  " json:",omitempty"`
+	IdCode string `parser:"@(IdCode | PortString)" json:",omitempty"`
 }
 
 func (self VectorValueChange2T) GetCode() string {
@@ -390,9 +783,51 @@ func (self VectorValueChange2T) GetValue() string {
 	return self.Value[1:]
 }
 
+// Text returns the string value, with escapes such as `\n`, `\\` and `\x20`
+// decoded. Writers use these, since the value may not contain whitespace.
+func (self VectorValueChange2T) Text() (string, error) {
+	v := self.GetValue()
+	if !strings.Contains(v, `\`) {
+		return v, nil
+	}
+	var ret strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			ret.WriteByte(v[i])
+			continue
+		}
+		if i++; i == len(v) {
+			return "", fmt.Errorf("vcd.VectorValueChange2T.Text: trailing backslash: %q", v)
+		}
+		switch c := v[i]; c {
+		case 'n':
+			ret.WriteByte('\n')
+		case 't':
+			ret.WriteByte('\t')
+		case 'r':
+			ret.WriteByte('\r')
+		case '\\':
+			ret.WriteByte('\\')
+		case 'x':
+			if i+2 >= len(v) {
+				return "", fmt.Errorf("vcd.VectorValueChange2T.Text: short escape: %q", v)
+			}
+			b, err := strconv.ParseUint(v[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("vcd.VectorValueChange2T.Text: bad escape: %q: %w", v, err)
+			}
+			ret.WriteByte(byte(b))
+			i += 2
+		default:
+			return "", fmt.Errorf("vcd.VectorValueChange2T.Text: unknown escape: %q in %q", c, v)
+		}
+	}
+	return ret.String(), nil
+}
+
 type VectorValueChange3T struct {
 	Value  string `parser:"@RealString" json:",omitempty"`
-	IdCode string `parser:"@IdCode" json:",omitempty"`
+	IdCode string `parser:"@(IdCode | PortString)" json:",omitempty"`
 }
 
 func (self VectorValueChange3T) GetCode() string {
@@ -403,6 +838,31 @@ func (self VectorValueChange3T) GetValue() string {
 	return self.Value[1:]
 }
 
+// Float64 returns the real value.
+func (self VectorValueChange3T) Float64() (float64, error) {
+	ret, err := strconv.ParseFloat(self.GetValue(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("vcd.VectorValueChange3T.Float64: %w", err)
+	}
+	return ret, nil
+}
+
+// PortValueChangeT is a value change of an extended VCD port, such as
+// `pD 6 0 <0`. See IEEE 1364-2005, 18.4.3.3.
+type PortValueChangeT struct {
+	Value string `parser:"@PortString" json:",omitempty"`
+	// Strength0 and Strength1 are the strengths of the 0 and 1 components
+	// of the value, from 0 (highz) to 7 (supply).
+	Strength0 string `parser:"@(IdCode | Int)" json:",omitempty"`
+	Strength1 string `parser:"@(IdCode | Int)" json:",omitempty"`
+	IdCode    string `parser:"@(IdCode | PortString)" json:",omitempty"`
+}
+
+// GetValue returns the port state characters, without the leading `p`.
+func (self PortValueChangeT) GetValue() string {
+	return self.Value[1:]
+}
+
 // MaxIterations is the max number of items to be captured by the parser.
 // While the default is 1 million, VCD files can be GIGANTIC, so we just
 // let it rip.
@@ -424,3 +884,9 @@ func NewParser[T any]() *participle.Parser[T] {
 func NewIdParser[T any]() *participle.Parser[T] {
 	return commonNewParser[T](NewIdLexer())
 }
+
+// NewSimulationParser returns a parser for the simulation section of a VCD
+// file, that is, for the text that follows `$enddefinitions $end`.
+func NewSimulationParser[T any]() *participle.Parser[T] {
+	return commonNewParser[T](NewSimulationLexer())
+}
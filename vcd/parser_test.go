@@ -116,6 +116,174 @@ func TestVarParse(t *testing.T) {
 	}
 }
 
+func TestVarIds(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input         string
+		name, raw     string
+		str, rawStr   string
+		indices, fail bool
+	}{
+		{input: `$var wire 8 ! data [7:0] $end`, name: "data", str: "data[7:0]", rawStr: "data[7:0]", indices: true},
+		{input: `$var wire 1 ! \bus[3] $end`, name: "bus[3]", raw: `\bus[3]`, str: "bus[3]", rawStr: `\bus[3]`},
+		{input: `$var wire 2 ! \bus[3] [1:0] $end`, name: "bus[3]", raw: `\bus[3]`, str: "bus[3][1:0]", rawStr: `\bus[3] [1:0]`, indices: true},
+		{input: `$var wire 1 ! \a.b $end`, name: "a.b", raw: `\a.b`, str: "a.b", rawStr: `\a.b`},
+		{input: `$var wire 1 ! \a\b $end`, name: `a\b`, raw: `\a\b`, str: `a\b`, rawStr: `\a\b`},
+		{input: `$var logic 1 ! \my  signal\ $end`, name: "my  signal", raw: `\my  signal\`, str: "my  signal", rawStr: `\my  signal\`},
+		{input: `$var logic 1 ! \a\\b\ $end`, name: `a\b`, raw: `\a\\b\`, str: `a\b`, rawStr: `\a\\b\`},
+		{input: `$var wire 1 ! gen_blk[0].u.q $end`, name: "gen_blk[0].u.q", str: "gen_blk[0].u.q", rawStr: "gen_blk[0].u.q"},
+		{input: `$var wire 2 ! gen_blk[0].q[1:0] $end`, name: "gen_blk[0].q", str: "gen_blk[0].q[1:0]", rawStr: "gen_blk[0].q[1:0]", indices: true},
+		{input: `$var wire 1 ! gen.blk.q $end`, name: "gen.blk.q", str: "gen.blk.q", rawStr: "gen.blk.q"},
+		{input: `$var wire 1 ! a$b $end`, name: "a$b", str: "a$b", rawStr: "a$b"},
+		{input: `$var wire 1 ! x[a] $end`, name: "x[a]", str: "x[a]", rawStr: "x[a]"},
+		{input: `$var wire 1 ! my signal $end`, fail: true},
+		{input: `$var wire 1 ! \\ $end`, fail: true},
+	}
+	parser := NewParser[File]()
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			f, err := parser.ParseString("test", test.input)
+			if test.fail {
+				if err == nil {
+					t.Errorf("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			id := f.DeclarationCommand[0].Var.Id
+			if id.Name != test.name || id.Raw != test.raw || id.String() != test.str ||
+				id.RawString() != test.rawStr || (len(id.Indices) > 0) != test.indices {
+				t.Errorf("\nwant: %q %q %q %q\ngot:  %q %q %q %q %+v",
+					test.name, test.raw, test.str, test.rawStr,
+					id.Name, id.Raw, id.String(), id.RawString(), id.Indices)
+			}
+		})
+	}
+}
+
+func TestVarKinds(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		kind     string
+		expected VarKindCode
+		encoding ValueEncoding
+		twoState bool
+	}{
+		{"wire", VarKindWire, EncodingVector, false},
+		{"real", VarKindReal, EncodingReal, false},
+		{"string", VarKindString, EncodingString, false},
+		{"port", VarKindPort, EncodingPort, false},
+		{"bit", VarKindBit, EncodingVector, true},
+		{"byte", VarKindByte, EncodingVector, true},
+		{"shortint", VarKindShortint, EncodingVector, true},
+		{"int", VarKindInt, EncodingVector, true},
+		{"longint", VarKindLongint, EncodingVector, true},
+		{"shortreal", VarKindShortreal, EncodingReal, false},
+		{"realtime", VarKindRealtime, EncodingReal, false},
+		{"real_parameter", VarKindRealParameter, EncodingReal, false},
+		{"enum", VarKindEnum, EncodingVector, false},
+		{"sparray", VarKindSparray, EncodingVector, false},
+	}
+	parser := NewParser[File]()
+	for _, test := range tests {
+		test := test
+		t.Run(test.kind, func(t *testing.T) {
+			input := fmt.Sprintf("$var %v 32 ! x $end", test.kind)
+			f, err := parser.ParseString(test.kind, input)
+			if err != nil {
+				t.Fatalf("parse error: input:`%+v`: %+v", input, err)
+			}
+			k := f.DeclarationCommand[0].Var.GetVarKind()
+			if k != test.expected {
+				t.Errorf("want: %v, got: %v", test.expected, k)
+			}
+			if e := k.Encoding(); e != test.encoding {
+				t.Errorf("want encoding: %v, got: %v", test.encoding, e)
+			}
+			if k.TwoState() != test.twoState {
+				t.Errorf("want two-state: %v", test.twoState)
+			}
+			if s := k.String(); s != test.kind {
+				t.Errorf("want name: %v, got: %v", test.kind, s)
+			}
+		})
+	}
+	for k := VarKindEvent; k < VarKindUnknown; k++ {
+		if v, ok := stringToVarKind[k.String()]; !ok || v != k {
+			t.Errorf("name of %d: %q is the name of %v", int(k), k.String(), v)
+		}
+	}
+	if e, a := fmt.Sprintf("VarKindCode(%d)", int(VarKindUnknown)), VarKindUnknown.String(); e != a {
+		t.Errorf("want: %v, got: %v", e, a)
+	}
+}
+
+func TestValueChangeEncoding(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected ValueEncoding
+	}{
+		{"1!", EncodingVector},
+		{"1 !", EncodingVector},
+		{"b101 !", EncodingVector},
+		{"r1.5 !", EncodingReal},
+		{"sidle !", EncodingString},
+		{"pD 6 0 !", EncodingPort},
+	}
+	parser := NewSimulationParser[ValueChangeT]()
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			vc, err := parser.ParseString(test.input, test.input)
+			if err != nil {
+				t.Fatalf("parse error: input:`%+v`: %+v", test.input, err)
+			}
+			if e := vc.Encoding(); e != test.expected {
+				t.Errorf("want: %v, got: %v", test.expected, e)
+			}
+		})
+	}
+}
+
+func TestPortVarParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		size     int
+		msb, lsb int
+		hasRange bool
+	}{
+		{input: `$var port 1 <0 clk $end`, size: 1},
+		{input: `$var port [7:0] <1 data $end`, size: 8, msb: 7, lsb: 0, hasRange: true},
+		{input: `$var port [0:3] <2 sum $end`, size: 4, msb: 0, lsb: 3, hasRange: true},
+		{input: `$var port [ 3 : 2 ] <3 bus $end`, size: 2, msb: 3, lsb: 2, hasRange: true},
+	}
+	parser := NewParser[File]()
+	for i, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			f, err := parser.ParseString(fmt.Sprintf("(rule %v)", i), test.input)
+			if err != nil {
+				t.Fatalf("parse error: input:`%+v`: %+v", test.input, err)
+			}
+			v := f.DeclarationCommand[0].Var
+			if v.GetVarKind() != VarKindPort || v.Size != test.size {
+				t.Errorf("unexpected var: %+v", v)
+			}
+			if (v.Range != nil) != test.hasRange {
+				t.Fatalf("unexpected range: %+v", v.Range)
+			}
+			if test.hasRange && (*v.Range.MsbIndex != test.msb || *v.Range.LsbIndex != test.lsb) {
+				t.Errorf("want [%v:%v], got: %v", test.msb, test.lsb, v.Range.AsString())
+			}
+		})
+	}
+}
+
 func TestBitParse(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -155,6 +323,19 @@ func TestScope(t *testing.T) {
 			Id:        "top",
 			KwEnd:     true,
 		}},
+		// Names that start like a binstring.
+		{"$scope interface bus_if $end", ScopeT{
+			Scope:     true,
+			ScopeKind: ScopeKindT{Interface: true},
+			Id:        "bus_if",
+			KwEnd:     true,
+		}},
+		{"$scope module \\gen.blk[2] $end", ScopeT{
+			Scope:     true,
+			ScopeKind: ScopeKindT{Module: true},
+			Id:        `\gen.blk[2]`,
+			KwEnd:     true,
+		}},
 	}
 	parser := NewParser[ScopeT]()
 	for i, test := range tests {
@@ -172,6 +353,54 @@ func TestScope(t *testing.T) {
 	}
 }
 
+func TestScopeKind(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		kind     string
+		expected ScopeKindCode
+	}{
+		{"begin", ScopeKindBegin},
+		{"fork", ScopeKindFork},
+		{"function", ScopeKindFunction},
+		{"module", ScopeKindModule},
+		{"task", ScopeKindTask},
+		{"vhdl_architecture", ScopeKindVHDLArchitecture},
+		{"vhdl_record", ScopeKindVHDLRecord},
+		{"generate", ScopeKindGenerate},
+		{"struct", ScopeKindStruct},
+		{"union", ScopeKindUnion},
+		{"class", ScopeKindClass},
+		{"interface", ScopeKindInterface},
+		{"package", ScopeKindPackage},
+		{"program", ScopeKindProgram},
+		{"vhdl_procedure", ScopeKindVHDLProcedure},
+		{"vhdl_function", ScopeKindVHDLFunction},
+		{"vhdl_process", ScopeKindVHDLProcess},
+		{"vhdl_block", ScopeKindVHDLBlock},
+		{"vhdl_for_generate", ScopeKindVHDLForGenerate},
+		{"vhdl_if_generate", ScopeKindVHDLIfGenerate},
+		{"vhdl_generate", ScopeKindVHDLGenerate},
+		{"vhdl_package", ScopeKindVHDLPackage},
+	}
+	parser := NewParser[ScopeT]()
+	for _, test := range tests {
+		test := test
+		t.Run(test.kind, func(t *testing.T) {
+			input := fmt.Sprintf("$scope %v top $end", test.kind)
+			actual, err := parser.ParseString(test.kind, input)
+			if err != nil {
+				t.Fatalf("parse error: %+v: %v", input, err)
+			}
+			if k := actual.ScopeKind.Kind(); k != test.expected {
+				t.Errorf("want: %v, got: %v", test.expected, k)
+			}
+		})
+	}
+	if _, err := parser.ParseString("bogus", "$scope bogus top $end"); err == nil {
+		t.Errorf("want an error for an unknown scope kind")
+	}
+}
+
 func TestTimescale(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -203,6 +432,22 @@ func TestTimescale(t *testing.T) {
 	}
 }
 
+func TestParseTimeUnit(t *testing.T) {
+	t.Parallel()
+	for _, unit := range []string{"s", "ms", "us", "ns", "ps", "fs"} {
+		u, err := ParseTimeUnit(unit)
+		if err != nil {
+			t.Fatalf("%v: %v", unit, err)
+		}
+		if u.String() != unit {
+			t.Errorf("want: %v, got: %v", unit, u)
+		}
+	}
+	if _, err := ParseTimeUnit("min"); err == nil {
+		t.Errorf("want an error for an unknown unit")
+	}
+}
+
 func Ptr[T any](v T) *T {
 	return &v
 }
@@ -310,3 +555,20 @@ func TestResult(t *testing.T) {
 //})
 //}
 //}
+
+func TestSimulationTimeValue(t *testing.T) {
+	t.Parallel()
+	if v, err := (SimulationTimeT{DecimalNumber: "#42"}).Value(); err != nil || v != 42 {
+		t.Errorf("want 42, got: %v, %v", v, err)
+	}
+	for _, ts := range []string{"", "#", "#x1", "#18446744073709551616"} {
+		if _, err := (SimulationTimeT{DecimalNumber: ts}).Value(); err == nil {
+			t.Errorf("want an error for: %q", ts)
+		}
+	}
+	// Must not panic.
+	var vc ValueChangeT
+	if vc.GetIdCode() != "" || vc.GetValue() != "" {
+		t.Errorf("want empty values from: %+v", vc)
+	}
+}
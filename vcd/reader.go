@@ -0,0 +1,295 @@
+package vcd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+var headerParser = sync.OnceValue(NewParser[File])
+
+// ReaderOption configures a Reader.
+type ReaderOption func(*Reader)
+
+// WithFilename sets the file name that is reported in positions and errors.
+func WithFilename(name string) ReaderOption {
+	return func(r *Reader) {
+		r.filename = name
+	}
+}
+
+// WithLenient makes the Reader skip malformed commands instead of failing.
+// Each skipped command is recorded as a diagnostic, see Diagnostics.
+func WithLenient() ReaderOption {
+	return func(r *Reader) {
+		r.lenient = true
+	}
+}
+
+// MaxDiagnostics is the maximum number of diagnostics that a lenient Reader
+// keeps. Any further ones are only counted.
+var MaxDiagnostics = 1000
+
+// Reader reads a VCD file incrementally.
+//
+// The declarations are read and parsed in full first, since they are needed
+// to make sense of the rest of the file. The simulation commands are then
+// scanned one at a time, so that memory use does not depend on the size of
+// the file.
+//
+//	r := vcd.NewReader(f)
+//	decls, err := r.Declarations()
+//	...
+//	for {
+//		cmd, err := r.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+//
+// Syntax errors are reported as *ParseError.
+type Reader struct {
+	s        *scanner
+	src      Source // Instead of VCD text, see NewSourceReader.
+	filename string
+	lenient  bool
+	workers  int
+	filter   *Filter
+
+	chunkSize int       // See ParallelChunkSize.
+	par       *parallel // Set once a parallel Reader starts scanning.
+
+	diags     []*ParseError
+	diagCount int
+
+	headerDone bool
+	headerErr  error
+	decls      []*DeclarationCommandT
+	headerText []byte // The text of the declarations, as it was read.
+
+	// Hands out the selected simulation commands, if there is a filter.
+	filtered func() (*SimulationCommandT, error)
+
+	err       error // Sticky; once set, Next keeps returning it.
+	srcClosed bool
+}
+
+// NewReader creates a new Reader that reads VCD text from r.
+func NewReader(r io.Reader, opts ...ReaderOption) *Reader {
+	ret := &Reader{chunkSize: ParallelChunkSize}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	ret.s = newScanner(r, ret.filename)
+	if ret.lenient {
+		ret.s.report = ret.addDiagnostic
+	}
+	return ret
+}
+
+func (self *Reader) addDiagnostic(err *ParseError) {
+	self.diagCount++
+	if len(self.diags) < MaxDiagnostics {
+		self.diags = append(self.diags, err)
+	}
+}
+
+// Filename returns the file name that was set with WithFilename, or an empty
+// string if none was.
+func (self *Reader) Filename() string {
+	return self.filename
+}
+
+// Diagnostics returns the errors that a lenient Reader skipped so far, in
+// the order in which they were found. At most MaxDiagnostics are kept.
+func (self *Reader) Diagnostics() []*ParseError {
+	return self.diags
+}
+
+// DiagnosticCount returns the number of errors that a lenient Reader
+// skipped so far, including the ones that were not kept.
+func (self *Reader) DiagnosticCount() int {
+	return self.diagCount
+}
+
+// Declarations returns the declaration commands of the file, reading them
+// if that was not done yet.
+func (self *Reader) Declarations() ([]*DeclarationCommandT, error) {
+	if !self.headerDone {
+		self.headerDone = true
+		self.headerErr = self.readHeader()
+		if self.headerErr == nil && self.filter != nil {
+			self.decls, self.filtered, self.headerErr = self.filter.Apply(self.decls, self.next)
+		}
+	}
+	return self.decls, self.headerErr
+}
+
+// Next returns the next simulation command. Returns io.EOF once all
+// commands have been read.
+func (self *Reader) Next() (*SimulationCommandT, error) {
+	if _, err := self.Declarations(); err != nil {
+		return nil, err
+	}
+	if self.err != nil {
+		return nil, self.err
+	}
+	next := self.next
+	if self.filtered != nil {
+		next = self.filtered
+	}
+	ret, err := next()
+	if err != nil {
+		// A filter may stop before the end of input.
+		self.err = err
+		self.Close()
+		return nil, err
+	}
+	return ret, nil
+}
+
+// next returns the next simulation command from the input.
+func (self *Reader) next() (*SimulationCommandT, error) {
+	if self.src != nil {
+		return self.src.Next()
+	}
+	if self.workers > 1 {
+		return self.nextParallel()
+	}
+	return self.s.command()
+}
+
+// ReadAll reads the remainder of the input into a File. The result is the
+// same as what the parser from NewParser[File] would produce for the same
+// input. Use it only when the entire file fits in memory.
+func (self *Reader) ReadAll() (*File, error) {
+	decls, err := self.Declarations()
+	if err != nil {
+		return nil, err
+	}
+	ret := &File{DeclarationCommand: decls}
+	for {
+		c, err := self.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret.SimulationCommand = append(ret.SimulationCommand, c)
+	}
+	return ret, nil
+}
+
+// span is a range of byte offsets.
+type span struct {
+	from, to int
+}
+
+// readHeader reads and parses the declarations. Like the File grammar, it
+// also takes the comments immediately following `$enddefinitions $end`.
+func (self *Reader) readHeader() error {
+	if self.src != nil {
+		if err := self.startSource(); err != nil {
+			return err
+		}
+	}
+	var text bytes.Buffer
+	self.s.text = &text
+	defer func() {
+		self.s.text = nil
+		self.headerText = text.Bytes()
+	}()
+
+	// The declarations, and the stray words between them.
+	var decls []span
+	for done := false; !done; {
+		err := self.s.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		from := self.s.wordPos.Offset
+		w := string(self.s.word)
+		if strings.HasPrefix(w, "$") && w != "$end" {
+			if err := self.s.skipToEnd(); err != nil {
+				return err
+			}
+			done = w == "$enddefinitions"
+		}
+		// Otherwise this is not a declaration, the parser will complain
+		// about it.
+		decls = append(decls, span{from, self.s.pos.Offset})
+	}
+	for {
+		ok, err := self.s.nextWordIs("$comment")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := self.s.next(); err != nil {
+			return err
+		}
+		from := self.s.wordPos.Offset
+		if err := self.s.skipToEnd(); err != nil {
+			return err
+		}
+		decls = append(decls, span{from, self.s.pos.Offset})
+	}
+	// The header starts at the beginning of the input, so the positions
+	// that the parser reports need no adjustment.
+	source, blanked := text.Bytes(), false
+	for {
+		f, err := headerParser().ParseBytes(self.filename, source)
+		if err == nil {
+			self.decls = f.DeclarationCommand
+			LinkAttributes(self.decls)
+			return nil
+		}
+		err = newParseErrorIn(err, text.Bytes())
+		var perr *ParseError
+		if !self.lenient || !errors.As(err, &perr) {
+			return err
+		}
+		// Blank out the offending declaration and try again. Keeping the
+		// line breaks keeps the positions of everything else.
+		i := findSpan(decls, perr.Offset)
+		if i < 0 {
+			return err
+		}
+		self.addDiagnostic(perr)
+		if !blanked {
+			// Keep the original text for the snippets of later errors.
+			source, blanked = bytes.Clone(source), true
+		}
+		for j := decls[i].from; j < decls[i].to; j++ {
+			if source[j] != '\n' {
+				source[j] = ' '
+			}
+		}
+		decls = append(decls[:i], decls[i+1:]...)
+	}
+}
+
+// findSpan returns the index of the span in spans that contains off, or -1 if
+// there is none. An offset right at the end of a span, such as at the end of
+// input, belongs to it.
+func findSpan(spans []span, off int) int {
+	ret := -1
+	for i, s := range spans {
+		if s.from <= off && off < s.to {
+			return i
+		}
+		if off == s.to {
+			ret = i
+		}
+	}
+	return ret
+}
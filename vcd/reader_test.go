@@ -0,0 +1,219 @@
+package vcd
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestReaderMatchesParser(t *testing.T) {
+	t.Parallel()
+	tests := []string{
+		"",
+		`$comment only a comment $end`,
+		`
+        $timescale 1 ns $end
+        $scope module top $end
+        $var wire 1 ! clk $end
+        $var reg 8 " data[7:0] $end
+        $upscope $end
+        $enddefinitions $end
+        `,
+		`
+        $comment this is an illustration of $enddefinitions $end
+        $var wire 1 ! clk $end
+        $enddefinitions $end
+        $comment
+            A comment right after the definitions.
+        $end
+        #0
+        $dumpvars 0! b00000000 " $end
+        #10
+        1!
+        b10101010 "
+        #20
+        $comment a comment between the value changes $end
+        0!
+        r1.5 #
+        sfoo $
+        `,
+		`$enddefinitions $end #0 1! #1 0!`,
+	}
+	parser := NewParser[File]()
+	for i, test := range tests {
+		test := test
+		t.Run(fmt.Sprintf("rule %v", i), func(t *testing.T) {
+			name := fmt.Sprintf("(rule %v)", i)
+			expected, err := parser.ParseString(name, test)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			actual, err := NewReader(strings.NewReader(test), WithFilename(name)).ReadAll()
+			if err != nil {
+				t.Fatalf("read error: %v", err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("\nwant: %v\ngot:  %v", spew.Sdump(expected), spew.Sdump(actual))
+			}
+		})
+	}
+}
+
+func TestReaderStreams(t *testing.T) {
+	t.Parallel()
+	const n = 20000
+	var b strings.Builder
+	b.WriteString("$var wire 1 ! clk $end\n$enddefinitions $end\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "#%d\n%d!\n", i, i%2)
+	}
+	if b.Len() < 2*scannerBufferSize {
+		t.Fatalf("input too short to span buffer refills: %v", b.Len())
+	}
+
+	r := NewReader(strings.NewReader(b.String()), WithFilename("gen"))
+	decls, err := r.Declarations()
+	if err != nil {
+		t.Fatalf("could not read declarations: %v", err)
+	}
+	if len(decls) != 2 {
+		t.Errorf("want 2 declarations, got: %v", spew.Sdump(decls))
+	}
+	for i := 0; i < n; i++ {
+		c, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next(): %v", err)
+		}
+		if c.SimulationTime == nil {
+			t.Fatalf("want timestamp %v, got: %v", i, spew.Sdump(c))
+		}
+		if ts, err := c.SimulationTime.Value(); err != nil || ts != uint64(i) {
+			t.Fatalf("want timestamp %v, got: %v, %v", i, ts, err)
+		}
+		c, err = r.Next()
+		if err != nil {
+			t.Fatalf("Next(): %v", err)
+		}
+		v := c.ValueChange
+		if v == nil || v.GetIdCode() != "!" || v.GetValue() != fmt.Sprint(i%2) {
+			t.Fatalf("unexpected value change: %v", spew.Sdump(c))
+		}
+		// Positions are relative to the start of the input.
+		if p := v.ScalarValueChange.Pos; p.Line != 2*i+4 || p.Column != 1 {
+			t.Fatalf("unexpected position: %v", p)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("want io.EOF, got: %v", err)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	t.Parallel()
+	input := "$enddefinitions $end\n#0\n1!\n#1\n$dumpvars b1 $end\n"
+	_, err := NewReader(strings.NewReader(input), WithFilename("bad.vcd")).ReadAll()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !strings.HasPrefix(err.Error(), "bad.vcd:5:") {
+		t.Errorf("error should point at line 5: %v", err)
+	}
+}
+
+func TestReaderLenient(t *testing.T) {
+	t.Parallel()
+	input := `$timescale 1 ns $end
+$var wire 1 ! clk $end
+$var wire x " bad $end
+$var wire 1 # rst $end
+$enddefinitions $end
+#0
+$dumpvars 0! q 1# $end
+#1x
+1!
+$bogus stuff $end
+#2
+$dumpvars 1! $dumpon 0# $end
+#3
+b101 $end
+0!
+`
+	r := NewReader(strings.NewReader(input), WithFilename("bad.vcd"), WithLenient())
+	f, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	var codes []string
+	for _, d := range f.DeclarationCommand {
+		if d.Var != nil {
+			codes = append(codes, d.Var.Code)
+		}
+	}
+	if !reflect.DeepEqual(codes, []string{"!", "#"}) {
+		t.Errorf("unexpected vars: %v", codes)
+	}
+
+	var cmds []string
+	for _, c := range f.SimulationCommand {
+		switch {
+		case c.SimulationTime != nil:
+			cmds = append(cmds, c.SimulationTime.DecimalNumber)
+		case c.ValueChange != nil:
+			cmds = append(cmds, c.ValueChange.GetValue()+c.ValueChange.GetIdCode())
+		case c.Dumpvars != nil:
+			cmds = append(cmds, fmt.Sprintf("$dumpvars %v", len(c.Dumpvars.ValueChange)))
+		case c.Dumpon != nil:
+			cmds = append(cmds, fmt.Sprintf("$dumpon %v", len(c.Dumpon.ValueChange)))
+		}
+	}
+	expected := []string{
+		"#0", "$dumpvars 2", "1!", "#2", "$dumpvars 1", "$dumpon 1", "#3", "0!",
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, cmds)
+	}
+
+	var diags []string
+	for _, d := range r.Diagnostics() {
+		diags = append(diags, fmt.Sprintf("%v:%v %v", d.Line, d.Column, d.Token))
+	}
+	expected = []string{
+		`3:11 x`, `7:14 q`, `8:1 #1x`, `10:1 $bogus`, `12:14 $dumpon`,
+		`14:6 $end`,
+	}
+	if !reflect.DeepEqual(diags, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, diags)
+	}
+	if r.DiagnosticCount() != len(expected) {
+		t.Errorf("want %v diagnostics, got: %v", len(expected), r.DiagnosticCount())
+	}
+}
+
+func TestReaderLenientBlock(t *testing.T) {
+	t.Parallel()
+	input := "$enddefinitions $end\n#0\n$dumpvars 0! b1 $end\n$end\n1!\n$comment unterminated"
+	r := NewReader(strings.NewReader(input), WithLenient())
+	f, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if n := len(f.SimulationCommand); n != 4 {
+		t.Errorf("want 4 commands, got: %v", spew.Sdump(f.SimulationCommand))
+	}
+	var diags []string
+	for _, d := range r.Diagnostics() {
+		diags = append(diags, d.Error())
+	}
+	expected := []string{
+		"3:17: unexpected keyword: $end, expected: id code",
+		`4:1: unexpected keyword: "$end"`,
+		"6:22: unexpected end of input, expected: $end",
+	}
+	if !reflect.DeepEqual(diags, expected) {
+		t.Errorf("\nwant: %v\ngot:  %v", expected, diags)
+	}
+}
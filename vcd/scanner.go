@@ -0,0 +1,725 @@
+package vcd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// scannerBufferSize is the size of the read buffer of a scanner.
+const scannerBufferSize = 1 << 16
+
+// isSpaceTable has true at the indexes of all whitespace characters.
+var isSpaceTable = [256]bool{' ': true, '\t': true, '\n': true, '\r': true, '\f': true, '\v': true}
+
+func isSpace(c byte) bool {
+	return isSpaceTable[c]
+}
+
+// scanner is a hand-written scanner for the simulation section of a VCD
+// file. It produces the same SimulationCommandT values that the parser from
+// NewSimulationParser does, but without running a regular expression for each
+// token. This makes it more than an order of magnitude faster.
+//
+// It splits the input into whitespace separated words, and is also used to
+// find where the declarations end.
+type scanner struct {
+	r   *bufio.Reader
+	pos lexer.Position // Position of the next byte to read.
+
+	// If not nil, receives a copy of all consumed text.
+	text *bytes.Buffer
+
+	word    []byte         // The last word read.
+	wordPos lexer.Position // The position of word.
+	unread  bool           // If set, next returns word again.
+
+	// The consumed part of the current line, for error snippets. Only the
+	// last maxSnippetLen bytes or more are kept.
+	line []byte
+
+	// If not nil, the scanner is lenient: it reports syntax errors here,
+	// skips the malformed command and carries on.
+	report func(*ParseError)
+}
+
+func newScanner(r io.Reader, filename string) *scanner {
+	return &scanner{
+		r:   bufio.NewReaderSize(r, scannerBufferSize),
+		pos: lexer.Position{Filename: filename, Line: 1, Column: 1},
+	}
+}
+
+// buffered returns the buffered unread input, filling the buffer first if
+// it is empty. Returns an empty slice at the end of input.
+func (self *scanner) buffered() ([]byte, error) {
+	if self.r.Buffered() == 0 {
+		if _, err := self.r.Peek(1); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+	return self.r.Peek(self.r.Buffered())
+}
+
+// consume discards the first n bytes of buffered input b.
+func (self *scanner) consume(b []byte, n int) {
+	if self.text != nil {
+		self.text.Write(b[:n])
+	}
+	l := b[:n]
+	if i := bytes.LastIndexByte(l, '\n'); i >= 0 {
+		self.line, l = self.line[:0], l[i+1:]
+	}
+	if len(self.line)+len(l) > 2*maxSnippetLen {
+		k := max(0, len(self.line)+len(l)-maxSnippetLen)
+		if k >= len(self.line) {
+			self.line, l = self.line[:0], l[k-len(self.line):]
+		} else {
+			self.line = self.line[:copy(self.line, self.line[k:])]
+		}
+	}
+	self.line = append(self.line, l...)
+	self.r.Discard(n)
+}
+
+// skipSpace consumes the whitespace up to the next word or end of input.
+func (self *scanner) skipSpace() error {
+	for {
+		b, err := self.buffered()
+		if err != nil || len(b) == 0 {
+			return err
+		}
+		i := 0
+		for ; i < len(b) && isSpace(b[i]); i++ {
+			if b[i] == '\n' {
+				self.pos.Line++
+				self.pos.Column = 1
+			} else {
+				self.pos.Column++
+			}
+		}
+		self.pos.Offset += i
+		self.consume(b, i)
+		if i < len(b) {
+			return nil
+		}
+	}
+}
+
+// next reads the next word into self.word. Returns io.EOF if there are no
+// more words.
+func (self *scanner) next() error {
+	if self.unread {
+		self.unread = false
+		return nil
+	}
+	if err := self.skipSpace(); err != nil {
+		return err
+	}
+	self.wordPos = self.pos
+	self.word = self.word[:0]
+	for {
+		b, err := self.buffered()
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 {
+			break
+		}
+		i := 0
+		for i < len(b) && !isSpace(b[i]) {
+			i++
+		}
+		self.word = append(self.word, b[:i]...)
+		self.consume(b, i)
+		if i < len(b) {
+			break
+		}
+	}
+	if len(self.word) == 0 {
+		return io.EOF
+	}
+	self.pos.Offset += len(self.word)
+	self.pos.Column += utf8.RuneCount(self.word)
+	return nil
+}
+
+// nextWordIs reports whether the unread input, after any whitespace, starts
+// with the word w. Whitespace is consumed, the word is not.
+func (self *scanner) nextWordIs(w string) (bool, error) {
+	if err := self.skipSpace(); err != nil {
+		return false, err
+	}
+	b, _ := self.r.Peek(len(w) + 1)
+	if !bytes.HasPrefix(b, []byte(w)) {
+		return false, nil
+	}
+	return len(b) == len(w) || isSpace(b[len(w)]), nil
+}
+
+// skipToEnd consumes words up to and including the next `$end`. Stops
+// quietly at the end of input.
+func (self *scanner) skipToEnd() error {
+	for {
+		err := self.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if string(self.word) == "$end" {
+			return nil
+		}
+	}
+}
+
+// errorf returns a ParseError at the position of the last word read.
+func (self *scanner) errorf(format string, args ...any) error {
+	// Add the rest of the line, as far as it is buffered.
+	b, _ := self.r.Peek(min(self.r.Buffered(), maxSnippetLen))
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	line := append(self.line[:len(self.line):len(self.line)], b...)
+	at := len(self.line) - (self.pos.Offset - self.wordPos.Offset)
+	return newParseError(self.wordPos, fmt.Sprintf(format, args...), line, at)
+}
+
+// tolerate reports whether the scanner may carry on after err. If so, err
+// has been reported.
+func (self *scanner) tolerate(err error) bool {
+	var perr *ParseError
+	if self.report == nil || !errors.As(err, &perr) {
+		return false
+	}
+	self.report(perr)
+	return true
+}
+
+// skipCommand skips the remainder of a malformed command that starts with a
+// keyword. It stops after the next $end, or before the next timestamp or
+// simulation keyword, whichever comes first.
+func (self *scanner) skipCommand() error {
+	for {
+		err := self.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch w := string(self.word); {
+		case w == "$end":
+			return nil
+		case w[0] == '#', isSimulationKeyword(w):
+			self.unread = true
+			return nil
+		}
+	}
+}
+
+func isSimulationKeyword(w string) bool {
+	switch w {
+	case "$comment", "$dumpall", "$dumpoff", "$dumpon", "$dumpvars",
+		"$attrbegin", "$attrend", "$dumpportsall", "$dumpportsoff", "$dumpportson", "$dumpports", "$vcdclose":
+		return true
+	}
+	return false
+}
+
+// command scans the next simulation command. Returns io.EOF at the end of
+// input.
+func (self *scanner) command() (*SimulationCommandT, error) {
+	for {
+		if err := self.next(); err != nil {
+			return nil, err
+		}
+		var (
+			ret *SimulationCommandT
+			err error
+		)
+		switch self.word[0] {
+		case '#':
+			var t *SimulationTimeT
+			if t, err = self.timestamp(); err == nil {
+				ret = &SimulationCommandT{SimulationTime: t}
+			}
+		case '$':
+			stray := string(self.word) == "$end"
+			if ret, err = self.keyword(); err != nil && self.tolerate(err) {
+				if stray {
+					continue
+				}
+				if err := self.skipCommand(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		default:
+			var vc *ValueChangeT
+			if vc, err = self.valueChange(); err == nil {
+				ret = &SimulationCommandT{ValueChange: vc}
+			}
+		}
+		if err != nil && self.tolerate(err) {
+			continue
+		}
+		return ret, err
+	}
+}
+
+func (self *scanner) timestamp() (*SimulationTimeT, error) {
+	w := string(self.word)
+	if len(w) < 2 {
+		return nil, self.errorf("expected a timestamp, got: %q", w)
+	}
+	for _, c := range []byte(w[1:]) {
+		if c < '0' || c > '9' {
+			return nil, self.errorf("expected a timestamp, got: %q", w)
+		}
+	}
+	if _, err := strconv.ParseUint(w[1:], 10, 64); err != nil {
+		return nil, self.errorf("timestamp out of range: %q", w)
+	}
+	return &SimulationTimeT{DecimalNumber: w}, nil
+}
+
+func (self *scanner) keyword() (*SimulationCommandT, error) {
+	switch string(self.word) {
+	case "$dumpall":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpall: &DumpallT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$dumpoff":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpoff: &DumpoffT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$dumpon":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpon: &DumponT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$dumpvars":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpvars: &DumpvarsT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$comment":
+		c, err := self.comment()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{CommentText: &c}, nil
+	case "$attrbegin":
+		a, err := self.attr()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Attrbegin: a}, nil
+	case "$attrend":
+		if _, err := self.words(); err != nil {
+			return nil, err
+		}
+		attrend := true
+		return &SimulationCommandT{Attrend: &attrend}, nil
+	case "$dumpportsall":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpportsall: &DumpportsallT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$dumpportsoff":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpportsoff: &DumpportsoffT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$dumpportson":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpportson: &DumpportsonT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$dumpports":
+		vcs, err := self.block()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Dumpports: &DumpportsT{Kw: true, ValueChange: vcs, KwEnd: true}}, nil
+	case "$vcdclose":
+		v, err := self.vcdclose()
+		if err != nil {
+			return nil, err
+		}
+		return &SimulationCommandT{Vcdclose: v}, nil
+	}
+	return nil, self.errorf("unexpected keyword: %q", self.word)
+}
+
+// block scans the value changes of a block such as $dumpvars, up to and
+// including its $end. A lenient scanner ends a block that lacks its $end at
+// the next keyword.
+func (self *scanner) block() ([]*ValueChangeT, error) {
+	var ret []*ValueChangeT
+	for {
+		err := self.next()
+		if err == io.EOF {
+			err = self.errorf("unexpected end of input, expected: $end")
+			if self.tolerate(err) {
+				return ret, nil
+			}
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		if self.word[0] == '$' {
+			if string(self.word) == "$end" {
+				return ret, nil
+			}
+			err := self.errorf("unexpected keyword: %q, expected: $end", self.word)
+			if self.tolerate(err) {
+				self.unread = true
+				return ret, nil
+			}
+			return nil, err
+		}
+		vc, err := self.valueChange()
+		if err != nil {
+			if !self.tolerate(err) {
+				return nil, err
+			}
+			if string(self.word) == "$end" {
+				// The value change lacks an id code, and this is the
+				// $end of the block.
+				return ret, nil
+			}
+			continue
+		}
+		ret = append(ret, vc)
+	}
+}
+
+// words scans the words of a command up to its $end, and returns them
+// without the $end.
+func (self *scanner) words() ([]string, error) {
+	var ret []string
+	for {
+		err := self.next()
+		if err == io.EOF {
+			return nil, self.errorf("unexpected end of input, expected: $end")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if string(self.word) == "$end" {
+			return ret, nil
+		}
+		ret = append(ret, string(self.word))
+	}
+}
+
+// attr scans the remainder of an $attrbegin.
+func (self *scanner) attr() (*AttrT, error) {
+	w, err := self.words()
+	if err != nil {
+		return nil, err
+	}
+	ret := &AttrT{}
+	if err := ret.Capture(append(w, "$end")); err != nil {
+		return nil, self.errorf("bad attribute: %v", err)
+	}
+	return ret, nil
+}
+
+// vcdclose scans the remainder of a $vcdclose: an optional timestamp, and
+// $end.
+func (self *scanner) vcdclose() (*VcdcloseT, error) {
+	ret := &VcdcloseT{Kw: true, KwEnd: true}
+	for {
+		err := self.next()
+		if err == io.EOF {
+			return nil, self.errorf("unexpected end of input, expected: $end")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case string(self.word) == "$end":
+			return ret, nil
+		case self.word[0] == '#' && ret.SimulationTime == nil:
+			t, err := self.timestamp()
+			if err != nil {
+				return nil, err
+			}
+			ret.SimulationTime = t
+		default:
+			return nil, self.errorf("unexpected token: %q, expected: $end", self.word)
+		}
+	}
+}
+
+// comment scans the remainder of a $comment. The text is put together the
+// way the grammar does it: all words without whitespace between them, and
+// the whitespace that follows $end.
+func (self *scanner) comment() (string, error) {
+	var ret bytes.Buffer
+	ret.WriteString("$comment")
+	for {
+		err := self.next()
+		if err == io.EOF {
+			err = self.errorf("unexpected end of input, expected: $end")
+			if self.tolerate(err) {
+				return ret.String(), nil
+			}
+			return "", err
+		}
+		if err != nil {
+			return "", err
+		}
+		ret.Write(self.word)
+		if string(self.word) == "$end" {
+			break
+		}
+	}
+	text := self.text
+	self.text = &ret
+	err := self.skipSpace()
+	self.text = text
+	return ret.String(), err
+}
+
+// valueChange scans a value change that starts with the last word read.
+func (self *scanner) valueChange() (*ValueChangeT, error) {
+	w := self.word
+	switch c := w[0]; {
+	case c == 'b' || c == 'B':
+		if n := binstringLen(w); n > 1 {
+			value, code, err := self.splitIdCode(n)
+			if err != nil {
+				return nil, err
+			}
+			return &ValueChangeT{VectorValueChange: &VectorValueChangeT{
+				VectorValueChange1: &VectorValueChange1T{Value: value, IdCode: code},
+			}}, nil
+		}
+	case c == 'r' || c == 'R':
+		if n := floatLen(w[1:]); n > 0 {
+			value, code, err := self.splitIdCode(n + 1)
+			if err != nil {
+				return nil, err
+			}
+			return &ValueChangeT{VectorValueChange: &VectorValueChangeT{
+				VectorValueChange3: &VectorValueChange3T{Value: value, IdCode: code},
+			}}, nil
+		}
+	case c == 'p':
+		if portLen(w) == len(w) {
+			return self.portValueChange()
+		}
+	case c == 's':
+		if len(w) > 1 {
+			// The value takes the entire word.
+			value, code, err := self.splitIdCode(len(w))
+			if err != nil {
+				return nil, err
+			}
+			return &ValueChangeT{VectorValueChange: &VectorValueChangeT{
+				VectorValueChange2: &VectorValueChange2T{Value: value, IdCode: code},
+			}}, nil
+		}
+	}
+	pos := self.wordPos
+	if len(w) == 1 && !isScalarValue(w[0]) {
+		return nil, self.errorf("unexpected value: %q", w)
+	}
+	if len(w) > 1 {
+		// The value is glued to the id code. See ScalarValueChangeT.Garble.
+		return &ValueChangeT{ScalarValueChange: &ScalarValueChangeT{
+			Pos:    pos,
+			Garble: string(w),
+		}}, nil
+	}
+	value := string(w)
+	code, err := self.idCode()
+	if err != nil {
+		return nil, err
+	}
+	return &ValueChangeT{ScalarValueChange: &ScalarValueChangeT{
+		Pos:    pos,
+		Value:  ValueT{Value: value},
+		IdCode: code,
+	}}, nil
+}
+
+// portValueChange scans an extended VCD port value change that starts with
+// the last word read: the value, the two strengths and the id code.
+func (self *scanner) portValueChange() (*ValueChangeT, error) {
+	ret := &PortValueChangeT{Value: string(self.word)}
+	for _, s := range []*string{&ret.Strength0, &ret.Strength1} {
+		err := self.next()
+		if err == io.EOF {
+			return nil, self.errorf("unexpected end of input, expected: strength")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isStrength(self.word) {
+			return nil, self.errorf("expected a strength, got: %q", self.word)
+		}
+		*s = string(self.word)
+	}
+	code, err := self.idCode()
+	if err != nil {
+		return nil, err
+	}
+	ret.IdCode = code
+	return &ValueChangeT{PortValueChange: ret}, nil
+}
+
+// isStrength reports whether w is a strength component: 0 to 7 for each
+// bit.
+func isStrength(w []byte) bool {
+	for _, c := range w {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return len(w) > 0
+}
+
+// portLen returns the length of the prefix of w that matches PortPattern,
+// or 0 if there is no match.
+func portLen(w []byte) int {
+	i := 1
+	for ; i < len(w) && isPortState(w[i]); i++ {
+	}
+	if i == 1 {
+		return 0
+	}
+	return i
+}
+
+func isPortState(c byte) bool {
+	switch c {
+	case '0', '1', '?',
+		'A', 'B', 'C', 'D', 'F', 'H', 'L', 'N', 'T', 'U', 'X', 'Z',
+		'a', 'b', 'c', 'd', 'f', 'h', 'l', 'n', 'u', 'x', 'z':
+		return true
+	}
+	return false
+}
+
+// isScalarValue reports whether c is one of the nine values of std_logic,
+// which Verilog's 0, 1, x and z are among.
+func isScalarValue(c byte) bool {
+	switch c {
+	case '0', '1', 'x', 'X', 'z', 'Z', 'u', 'U', 'w', 'W', 'l', 'L', 'h', 'H', '-':
+		return true
+	}
+	return false
+}
+
+// splitIdCode returns the value, which is the first n bytes of the last
+// word read, and the id code. Like the lexer, it allows the id code to
+// follow the value without whitespace in between.
+func (self *scanner) splitIdCode(n int) (string, string, error) {
+	value := string(self.word[:n])
+	if n < len(self.word) {
+		return value, string(self.word[n:]), nil
+	}
+	code, err := self.idCode()
+	return value, code, err
+}
+
+// idCode scans an id code that is a word of its own.
+func (self *scanner) idCode() (string, error) {
+	err := self.next()
+	if err == io.EOF {
+		return "", self.errorf("unexpected end of input, expected: id code")
+	}
+	if err != nil {
+		return "", err
+	}
+	// Id codes may start with `$`, but the lexer will not take this one.
+	if string(self.word) == "$end" {
+		return "", self.errorf("unexpected keyword: $end, expected: id code")
+	}
+	return string(self.word), nil
+}
+
+// binstringLen returns the length of the prefix of w that matches
+// BinstringPattern, or 0 if there is no match.
+func binstringLen(w []byte) int {
+	i := 1
+	for ; i < len(w); i++ {
+		if isScalarValue(w[i]) {
+			continue
+		}
+		break
+	}
+	if i == 1 {
+		return 0
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func digitsLen(w []byte) int {
+	i := 0
+	for i < len(w) && isDigit(w[i]) {
+		i++
+	}
+	return i
+}
+
+// floatLen returns the length of the prefix of w that matches FloatPattern,
+// or 0 if there is no match.
+func floatLen(w []byte) int {
+	i := 0
+	if i < len(w) && (w[i] == '+' || w[i] == '-') {
+		i++
+	}
+	mantissa := digitsLen(w[i:])
+	i += mantissa
+	// The lexer's regexp is leftmost-first, so a trailing dot as in "5."
+	// is never part of the number.
+	if i < len(w) && w[i] == '.' {
+		if d := digitsLen(w[i+1:]); d > 0 {
+			i += 1 + d
+			mantissa += d
+		}
+	}
+	if mantissa == 0 {
+		return 0
+	}
+	if i < len(w) && (w[i] == 'e' || w[i] == 'E') {
+		j := i + 1
+		if j < len(w) && (w[j] == '+' || w[j] == '-') {
+			j++
+		}
+		if d := digitsLen(w[j:]); d > 0 {
+			i = j + d
+		}
+	}
+	return i
+}
@@ -0,0 +1,119 @@
+package vcd
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// simulationSectionT is a run of consecutive simulation commands.
+type simulationSectionT struct {
+	SimulationCommand []*SimulationCommandT `parser:"@@*"`
+}
+
+func scanAll(input string) ([]*SimulationCommandT, error) {
+	s := newScanner(strings.NewReader(input), "test")
+	var ret []*SimulationCommandT
+	for {
+		c, err := s.command()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+}
+
+func TestScannerMatchesParser(t *testing.T) {
+	t.Parallel()
+	tests := []string{
+		"",
+		"#0",
+		"#0 #10\n#42",
+		"1! 0\" x# X$ z% Z& u' U(",
+		"1 ! 0 \"",
+		"x*@ x*# 0V#",
+		"b10 ! B1 \" bxXzZuU # b0101$",
+		"bUUUUUUUU F",
+		"w! W\" l# L$ h% H& -' u ( H )",
+		"bUX01ZWLH- ! bwlh-0 \"",
+		"r1.5 ! R-2 \" r1e10 # r.5 $ r+1.5E-3 & r1.5! r-.5e+2 (",
+		"sfoo ! s_bar1 \" srx_get_start_bit ^",
+		`sHello,\x20world! ! s1.5 "`,
+		"$dumpvars x*# z*$ b0 (k $end",
+		"$dumpall 1*@ x*# 0*$ bx (k $end",
+		"$dumpoff $end $dumpon 1! $end",
+		"$comment some comment $end",
+		"$comment some\n  comment $end\n\n  #10",
+		"#1\n\t1!\r\n#2  0!",
+		"héllo #1 1ö",
+		"$dumpports pD 6 0 <0 pUUDD 0 6 <1 $end",
+		"$dumpportsall pX 6 6 <0 $end $dumpportsoff $end $dumpportson pd 5 0 <0 $end",
+		"$vcdclose #100 $end $vcdclose $end",
+		"$attrbegin misc 02 STD_LOGIC 1030 $end 1! $attrend $end",
+		"$attrbegin misc 07 state_t 2 IDLE RUN 0 1 1 $end\n#1",
+		// Id codes that look like port values.
+		"1 p0 b10 pX r1.5 pZ pD 6 0 p1",
+	}
+	parser := NewSimulationParser[simulationSectionT]()
+	for i, test := range tests {
+		test := test
+		t.Run(fmt.Sprintf("rule %v", i), func(t *testing.T) {
+			expected, err := parser.ParseString("test", test)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			actual, err := scanAll(test)
+			if err != nil {
+				t.Fatalf("scan error: %v", err)
+			}
+			if !reflect.DeepEqual(expected.SimulationCommand, actual) {
+				t.Errorf("\nwant: %v\ngot:  %v", spew.Sdump(expected.SimulationCommand), spew.Sdump(actual))
+			}
+		})
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input, expected string
+	}{
+		{"#", "test:1:1: expected a timestamp"},
+		{"#1 #12a", "test:1:4: expected a timestamp"},
+		{"$bogus", "test:1:1: unexpected keyword"},
+		{"\n$dumpvars 1!", "test:2:13: unexpected end of input, expected: $end"},
+		{"$dumpvars 1! $dumpon $end", "test:1:14: unexpected keyword"},
+		{"b101", "test:1:5: unexpected end of input, expected: id code"},
+		{"b101 $end", "test:1:6: unexpected keyword: $end"},
+		{"1", "test:1:2: unexpected end of input, expected: id code"},
+		{"q", "test:1:1: unexpected value"},
+		// The lexer does not take the dot, so it becomes the id code.
+		{"r5. %", "test:1:5: unexpected value"},
+		{"#18446744073709551616", "test:1:1: timestamp out of range"},
+		{"pD 6 <0", "test:1:6: expected a strength"},
+		{"pD 6 0", "test:1:7: unexpected end of input, expected: id code"},
+		{"$vcdclose #1 #2 $end", "test:1:14: unexpected token"},
+		{"$comment never ends", "test:1:20: unexpected end of input"},
+		{"$attrbegin misc 02 $end", "test:1:20: bad attribute"},
+		{"$attrbegin misc 07 e 2 A 0 1 $end", "test:1:30: bad attribute"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			_, err := scanAll(test.input)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.HasPrefix(err.Error(), test.expected) {
+				t.Errorf("want: %q\ngot:  %q", test.expected, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package vcd
+
+import (
+	"bytes"
+	"io"
+)
+
+// Source hands out the contents of a waveform file that is not VCD text, such
+// as an FST file, the way a Reader would read them from VCD text. See
+// NewSourceReader.
+type Source interface {
+	// Header returns the declarations, as VCD text up to and including
+	// `$enddefinitions $end`.
+	Header() ([]byte, error)
+	// Next returns the next simulation command, and io.EOF after the last.
+	Next() (*SimulationCommandT, error)
+}
+
+// NewSourceReader returns a Reader that reads from src instead of VCD text.
+// Everything that takes a Reader works the same with it. The declarations
+// are parsed from the text that src returns. WithWorkers has no effect. If
+// src is an io.Closer, Close closes it.
+func NewSourceReader(src Source, opts ...ReaderOption) *Reader {
+	ret := &Reader{chunkSize: ParallelChunkSize, src: src}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// startSource makes the scanner that reads the header text of the source.
+func (self *Reader) startSource() error {
+	text, err := self.src.Header()
+	if err != nil {
+		return err
+	}
+	self.s = newScanner(bytes.NewReader(text), self.filename)
+	if self.lenient {
+		self.s.report = self.addDiagnostic
+	}
+	return nil
+}
+
+// closeSource closes the source, if it is an io.Closer.
+func (self *Reader) closeSource() error {
+	c, ok := self.src.(io.Closer)
+	if !ok || self.srcClosed {
+		return nil
+	}
+	self.srcClosed = true
+	return c.Close()
+}
+
+// NewValueChange returns a value change of the variable with the given id
+// code, written as the encoding e requires: a scalar such as `1!` or a
+// vector such as `b10z !`, a real number such as `r1.5 !`, or a string
+// such as `sidle !`. String values are escaped as Writer does. Port values
+// need strengths, which this does not have; they are taken to be vectors.
+func NewValueChange(code, value string, e ValueEncoding) *ValueChangeT {
+	switch e {
+	case EncodingReal:
+		return &ValueChangeT{VectorValueChange: &VectorValueChangeT{
+			VectorValueChange3: &VectorValueChange3T{Value: "r" + value, IdCode: code},
+		}}
+	case EncodingString:
+		return &ValueChangeT{VectorValueChange: &VectorValueChangeT{
+			VectorValueChange2: &VectorValueChange2T{Value: "s" + escapeText(value), IdCode: code},
+		}}
+	}
+	if len(value) == 1 && isScalarValue(value[0]) {
+		return &ValueChangeT{ScalarValueChange: &ScalarValueChangeT{
+			Value:  ValueT{Value: value},
+			IdCode: code,
+		}}
+	}
+	return &ValueChangeT{VectorValueChange: &VectorValueChangeT{
+		VectorValueChange1: &VectorValueChange1T{Value: "b" + value, IdCode: code},
+	}}
+}
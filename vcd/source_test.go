@@ -0,0 +1,121 @@
+package vcd
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// testSource is a Source with the given header and commands.
+type testSource struct {
+	header    string
+	headerErr error
+	cmds      []*SimulationCommandT
+	closed    int
+}
+
+func (self *testSource) Header() ([]byte, error) {
+	return []byte(self.header), self.headerErr
+}
+
+func (self *testSource) Next() (*SimulationCommandT, error) {
+	if len(self.cmds) == 0 {
+		return nil, io.EOF
+	}
+	ret := self.cmds[0]
+	self.cmds = self.cmds[1:]
+	return ret, nil
+}
+
+func (self *testSource) Close() error {
+	self.closed++
+	return nil
+}
+
+func TestSourceReader(t *testing.T) {
+	t.Parallel()
+	const input = `$date today $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var wire 4 " data $end
+$var real 1 # r $end
+$var string 1 $ s $end
+$upscope $end
+$enddefinitions $end
+#0
+1!
+b10xz "
+r1.5 #
+sa\x20b $
+#10
+0!
+`
+	expected, err := NewReader(strings.NewReader(input)).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	src := &testSource{
+		header: input[:strings.Index(input, "#0")],
+		cmds: []*SimulationCommandT{
+			{SimulationTime: &SimulationTimeT{DecimalNumber: "#0"}},
+			{ValueChange: NewValueChange("!", "1", EncodingVector)},
+			{ValueChange: NewValueChange(`"`, "10xz", EncodingVector)},
+			{ValueChange: NewValueChange("#", "1.5", EncodingReal)},
+			{ValueChange: NewValueChange("$", "a b", EncodingString)},
+			{SimulationTime: &SimulationTimeT{DecimalNumber: "#10"}},
+			{ValueChange: NewValueChange("!", "0", EncodingVector)},
+		},
+	}
+	r := NewSourceReader(src, WithFilename("test.src"), WithWorkers(4))
+	h, err := r.Header()
+	if err != nil {
+		t.Fatalf("header error: %v", err)
+	}
+	if h.Date != "today" || h.Hierarchy.Var("/top/data") == nil {
+		t.Errorf("header: %v", spew.Sdump(h))
+	}
+	var actual []*SimulationCommandT
+	for {
+		c, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		actual = append(actual, c)
+	}
+	if want, got := summary(expected.SimulationCommand), summary(actual); want != got {
+		t.Errorf("\nwant: %v\ngot:  %v", want, got)
+	}
+	for i, c := range actual {
+		if c.ValueChange != nil && c.ValueChange.Encoding() != expected.SimulationCommand[i].ValueChange.Encoding() {
+			t.Errorf("encoding of %v: want: %v, got: %v", c.ValueChange.GetIdCode(),
+				expected.SimulationCommand[i].ValueChange.Encoding(), c.ValueChange.Encoding())
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+	r.Close()
+	if src.closed != 1 {
+		t.Errorf("source closed %v times, want once", src.closed)
+	}
+}
+
+func TestSourceReaderErrors(t *testing.T) {
+	t.Parallel()
+	bad := errors.New("bad header")
+	_, err := NewSourceReader(&testSource{headerErr: bad}).Declarations()
+	if !errors.Is(err, bad) {
+		t.Errorf("want: %v, got: %v", bad, err)
+	}
+	_, err = NewSourceReader(&testSource{header: "$scope module top $end $bogus $end"}).Declarations()
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Errorf("want a parse error, got: %#v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package vcd
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Bit is the state of a single bit of a Value.
+type Bit byte
+
+// The bits are the nine values of VHDL's std_logic. Verilog only has 0, 1,
+// x and z; see Value.FourState.
+const (
+	Bit0 Bit = '0'
+	Bit1 Bit = '1'
+	BitX Bit = 'x' // Unknown.
+	BitZ Bit = 'z' // High impedance.
+	BitU Bit = 'u' // Uninitialized.
+	BitW Bit = 'w' // Weak unknown.
+	BitL Bit = 'l' // Weak 0.
+	BitH Bit = 'h' // Weak 1.
+	// BitDontCare is std_logic's don't-care. It also matches any bit in
+	// Value.Matches.
+	BitDontCare Bit = '-'
+)
+
+// IsKnown reports whether the bit is 0 or 1.
+func (self Bit) IsKnown() bool {
+	return self == Bit0 || self == Bit1
+}
+
+// FourState returns the bit as one of the four values of Verilog: L is 0, H
+// is 1, and U, W and don't-care are x.
+func (self Bit) FourState() Bit {
+	switch self {
+	case BitL:
+		return Bit0
+	case BitH:
+		return Bit1
+	case BitU, BitW, BitDontCare:
+		return BitX
+	}
+	return self
+}
+
+// toBit returns the Bit for the character c, ignoring case.
+func toBit(c byte) (Bit, bool) {
+	switch c {
+	case '0', '1', 'x', 'z', 'u', 'w', 'l', 'h', '-':
+		return Bit(c), true
+	case 'X', 'Z', 'U', 'W', 'L', 'H':
+		return Bit(c - 'A' + 'a'), true
+	}
+	return 0, false
+}
+
+// Value is a bit vector, such as the value of a scalar or of a `b` value
+// change. Next to the 0, 1, x and z of Verilog, a bit may have any of the
+// nine values of VHDL's std_logic: u, w, l, h and don't-care too. The zero
+// Value has no bits.
+//
+// Values are comparable with ==.
+type Value struct {
+	bits string // One Bit per character, the most significant bit first.
+}
+
+// ParseValue parses a vector value such as `b10xz`, or a scalar value such
+// as `1`. The leading `b` or `B` is optional.
+func ParseValue(s string) (Value, error) {
+	if strings.HasPrefix(s, "b") || strings.HasPrefix(s, "B") {
+		s = s[1:]
+	}
+	if s == "" {
+		return Value{}, fmt.Errorf("vcd.ParseValue: empty value")
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		bit, ok := toBit(s[i])
+		if !ok {
+			return Value{}, fmt.Errorf("vcd.ParseValue: not a bit: %q in %q", s[i], s)
+		}
+		b.WriteByte(byte(bit))
+	}
+	return Value{bits: b.String()}, nil
+}
+
+// MustParseValue is like ParseValue, but panics on error. Use it for
+// constants.
+func MustParseValue(s string) Value {
+	ret, err := ParseValue(s)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// Width returns the number of bits.
+func (self Value) Width() int {
+	return len(self.bits)
+}
+
+// Bit returns bit i, where bit 0 is the least significant one.
+func (self Value) Bit(i int) Bit {
+	return Bit(self.bits[len(self.bits)-1-i])
+}
+
+// String returns the bits, the most significant bit first.
+func (self Value) String() string {
+	return self.bits
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (self Value) MarshalText() ([]byte, error) {
+	return []byte(self.bits), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (self *Value) UnmarshalText(text []byte) error {
+	v, err := ParseValue(string(text))
+	if err != nil {
+		return err
+	}
+	*self = v
+	return nil
+}
+
+// Extend returns the value extended to width bits. As IEEE 1364 specifies
+// for VCD files, a value is extended to the left with 0 if its leftmost bit
+// is 0 or 1, and with its leftmost bit if that is x or z. Of the bits of
+// std_logic, the weak L and H are extended with 0 like 0 and 1, and U, W and
+// don't-care with themselves like x. A value that is wider than width loses
+// its most significant bits.
+func (self Value) Extend(width int) Value {
+	n := len(self.bits)
+	switch {
+	case n == width:
+		return self
+	case n > width:
+		return Value{bits: self.bits[n-width:]}
+	case n == 0:
+		return Value{bits: strings.Repeat(string(Bit0), width)}
+	}
+	pad := self.bits[0]
+	switch Bit(pad) {
+	case Bit1, BitL, BitH:
+		pad = byte(Bit0)
+	}
+	return Value{bits: strings.Repeat(string(pad), width-n) + self.bits}
+}
+
+// FourState returns the value with each bit mapped to the four values of
+// Verilog, for checks that only know those: L becomes 0, H becomes 1, and
+// U, W and don't-care become x. See Bit.FourState.
+func (self Value) FourState() Value {
+	b := []byte(self.bits)
+	for i, c := range b {
+		b[i] = byte(Bit(c).FourState())
+	}
+	return Value{bits: string(b)}
+}
+
+// IsFullyKnown reports whether all bits are 0 or 1.
+func (self Value) IsFullyKnown() bool {
+	for i := 0; i < len(self.bits); i++ {
+		if !Bit(self.bits[i]).IsKnown() {
+			return false
+		}
+	}
+	return true
+}
+
+// Slice returns bits msb down to lsb, as in the Verilog `v[msb:lsb]`. Bit 0
+// is the least significant one. Like slicing, it panics if the bits are out
+// of range.
+func (self Value) Slice(msb, lsb int) Value {
+	n := len(self.bits)
+	if lsb < 0 || msb < lsb || msb >= n {
+		panic(fmt.Sprintf("vcd.Value.Slice: [%v:%v] out of range for width %v", msb, lsb, n))
+	}
+	return Value{bits: self.bits[n-1-msb : n-lsb]}
+}
+
+// Matches reports whether the value matches pattern, bit by bit. A
+// don't-care bit in pattern matches any bit. Both are extended to the wider
+// of the two widths first, so that `b1-` matches all two bit values that
+// start with 1, and `b-` matches anything.
+func (self Value) Matches(pattern Value) bool {
+	w := max(self.Width(), pattern.Width())
+	v, p := self.Extend(w).bits, pattern.Extend(w).bits
+	for i := 0; i < w; i++ {
+		if Bit(p[i]) != BitDontCare && p[i] != v[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (self Value) mustBeKnown(op string) error {
+	if !self.IsFullyKnown() {
+		return fmt.Errorf("vcd.Value.%v: value has unknown bits: %v", op, self.bits)
+	}
+	if len(self.bits) == 0 {
+		return fmt.Errorf("vcd.Value.%v: value has no bits", op)
+	}
+	return nil
+}
+
+// Uint64 returns the value as an unsigned number. Returns an error if a bit
+// is not known, or if the value does not fit.
+func (self Value) Uint64() (uint64, error) {
+	if err := self.mustBeKnown("Uint64"); err != nil {
+		return 0, err
+	}
+	bits := strings.TrimLeft(self.bits, "0")
+	if len(bits) > 64 {
+		return 0, fmt.Errorf("vcd.Value.Uint64: value does not fit: %v", self.bits)
+	}
+	if bits == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(bits, 2, 64)
+}
+
+// Int64 returns the value as a signed number in two's complement, with the
+// width of the value. Returns an error if a bit is not known, or if the
+// value does not fit.
+func (self Value) Int64() (int64, error) {
+	b, err := self.signed("Int64")
+	if err != nil {
+		return 0, err
+	}
+	if !b.IsInt64() {
+		return 0, fmt.Errorf("vcd.Value.Int64: value does not fit: %v", self.bits)
+	}
+	return b.Int64(), nil
+}
+
+// BigInt returns the value as an unsigned number of any width. Returns an
+// error if a bit is not known.
+func (self Value) BigInt() (*big.Int, error) {
+	if err := self.mustBeKnown("BigInt"); err != nil {
+		return nil, err
+	}
+	ret, _ := new(big.Int).SetString(self.bits, 2)
+	return ret, nil
+}
+
+// SignedBigInt returns the value as a signed number of any width, in two's
+// complement. Returns an error if a bit is not known.
+func (self Value) SignedBigInt() (*big.Int, error) {
+	return self.signed("SignedBigInt")
+}
+
+func (self Value) signed(op string) (*big.Int, error) {
+	if err := self.mustBeKnown(op); err != nil {
+		return nil, err
+	}
+	ret, _ := new(big.Int).SetString(self.bits, 2)
+	if Bit(self.bits[0]) == Bit1 {
+		ret.Sub(ret, new(big.Int).Lsh(big.NewInt(1), uint(len(self.bits))))
+	}
+	return ret, nil
+}
@@ -0,0 +1,271 @@
+package vcd
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "1"},
+		{"b10xz", "10xz"},
+		{"B1XZU", "1xzu"},
+		{"0-1", "0-1"},
+		{"bUX01ZWLH-", "ux01zwlh-"},
+		{"h", "h"},
+	}
+	for _, test := range tests {
+		v, err := ParseValue(test.input)
+		if err != nil {
+			t.Errorf("ParseValue(%q): %v", test.input, err)
+			continue
+		}
+		if v.String() != test.expected {
+			t.Errorf("ParseValue(%q): want: %v, got: %v", test.input, test.expected, v)
+		}
+	}
+	for _, input := range []string{"", "b", "b102", "r1.5"} {
+		if _, err := ParseValue(input); err == nil {
+			t.Errorf("ParseValue(%q): want error", input)
+		}
+	}
+}
+
+func TestValueBits(t *testing.T) {
+	t.Parallel()
+	v := MustParseValue("b10xz")
+	if w := v.Width(); w != 4 {
+		t.Errorf("Width: want: 4, got: %v", w)
+	}
+	for i, expected := range []Bit{BitZ, BitX, Bit0, Bit1} {
+		if b := v.Bit(i); b != expected {
+			t.Errorf("Bit(%v): want: %c, got: %c", i, expected, b)
+		}
+	}
+	if v.IsFullyKnown() {
+		t.Errorf("IsFullyKnown: want false for %v", v)
+	}
+	if s := v.Slice(2, 1).String(); s != "0x" {
+		t.Errorf("Slice(2, 1): want: 0x, got: %v", s)
+	}
+	if s := v.Slice(3, 3).String(); s != "1" {
+		t.Errorf("Slice(3, 3): want: 1, got: %v", s)
+	}
+	if v != MustParseValue("B10XZ") {
+		t.Errorf("values should compare equal")
+	}
+}
+
+func TestValueFourState(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"ux01zwlh-", "xx01zx01x"},
+		{"10xz", "10xz"},
+		{"L", "0"},
+	}
+	for _, test := range tests {
+		if actual := MustParseValue(test.input).FourState().String(); actual != test.expected {
+			t.Errorf("FourState(%q): want: %v, got: %v", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestValueExtend(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		width    int
+		expected string
+	}{
+		{"b10", 4, "0010"},
+		{"b01", 4, "0001"},
+		{"bx0", 4, "xxx0"},
+		{"bz1", 3, "zz1"},
+		{"bl1", 4, "00l1"},
+		{"bh0", 4, "00h0"},
+		{"bu1", 4, "uuu1"},
+		{"bw1", 3, "ww1"},
+		{"b-1", 3, "--1"},
+		{"b1100", 2, "00"},
+		{"b101", 3, "101"},
+		{"", 2, "00"},
+	}
+	for _, test := range tests {
+		var v Value
+		if test.input != "" {
+			v = MustParseValue(test.input)
+		}
+		if got := v.Extend(test.width).String(); got != test.expected {
+			t.Errorf("%q.Extend(%v): want: %v, got: %v", test.input, test.width, test.expected, got)
+		}
+	}
+}
+
+func TestValueMatches(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		value, pattern string
+		expected       bool
+	}{
+		{"b10", "b10", true},
+		{"b10", "b1-", true},
+		{"b11", "b1-", true},
+		{"b01", "b1-", false},
+		{"bx1", "b-1", true},
+		{"b1010", "b-", true},
+		{"b0010", "b10", true},
+		{"bz", "b0", false},
+	}
+	for _, test := range tests {
+		v, p := MustParseValue(test.value), MustParseValue(test.pattern)
+		if got := v.Matches(p); got != test.expected {
+			t.Errorf("%v.Matches(%v): want: %v, got: %v", v, p, test.expected, got)
+		}
+	}
+}
+
+func TestValueNumbers(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		unsigned uint64
+		signed   int64
+	}{
+		{"0", 0, 0},
+		{"1", 1, -1},
+		{"b0101", 5, 5},
+		{"b1011", 11, -5},
+		{"b11111111", 255, -1},
+	}
+	for _, test := range tests {
+		v := MustParseValue(test.input)
+		u, err := v.Uint64()
+		if err != nil || u != test.unsigned {
+			t.Errorf("%v.Uint64(): want: %v, got: %v, %v", v, test.unsigned, u, err)
+		}
+		s, err := v.Int64()
+		if err != nil || s != test.signed {
+			t.Errorf("%v.Int64(): want: %v, got: %v, %v", v, test.signed, s, err)
+		}
+		b, err := v.BigInt()
+		if err != nil || b.Cmp(new(big.Int).SetUint64(test.unsigned)) != 0 {
+			t.Errorf("%v.BigInt(): want: %v, got: %v, %v", v, test.unsigned, b, err)
+		}
+		sb, err := v.SignedBigInt()
+		if err != nil || sb.Cmp(big.NewInt(test.signed)) != 0 {
+			t.Errorf("%v.SignedBigInt(): want: %v, got: %v, %v", v, test.signed, sb, err)
+		}
+	}
+
+	wide := MustParseValue("b1" + strings.Repeat("0", 64))
+	if _, err := wide.Uint64(); err == nil {
+		t.Errorf("Uint64: want overflow error for %v bits", wide.Width())
+	}
+	if b, err := wide.BigInt(); err != nil || b.Cmp(new(big.Int).Lsh(big.NewInt(1), 64)) != 0 {
+		t.Errorf("BigInt: want 2^64, got: %v, %v", b, err)
+	}
+	if _, err := MustParseValue("b0" + strings.Repeat("0", 64)).Uint64(); err != nil {
+		t.Errorf("Uint64: leading zeros should fit: %v", err)
+	}
+	if _, err := MustParseValue("b01" + strings.Repeat("0", 64)).Int64(); err == nil {
+		t.Errorf("Int64: want overflow error")
+	}
+
+	for _, input := range []string{"b1x", "bz", "b1-"} {
+		v := MustParseValue(input)
+		if _, err := v.Uint64(); err == nil {
+			t.Errorf("%v.Uint64(): want error", v)
+		}
+		if _, err := v.SignedBigInt(); err == nil {
+			t.Errorf("%v.SignedBigInt(): want error", v)
+		}
+	}
+	if _, err := (Value{}).Uint64(); err == nil {
+		t.Errorf("Uint64: want error for an empty value")
+	}
+}
+
+func TestValueChangeValue(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1!", "1"},
+		{"z !", "z"},
+		{"b10x1 !", "10x1"},
+		{"B10 !", "10"},
+	}
+	parser := NewSimulationParser[ValueChangeT]()
+	for _, test := range tests {
+		vc, err := parser.ParseString(test.input, test.input)
+		if err != nil {
+			t.Fatalf("parse error: input:`%+v`: %+v", test.input, err)
+		}
+		v, err := vc.Value()
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if v.String() != test.expected {
+			t.Errorf("%q: want: %v, got: %v", test.input, test.expected, v)
+		}
+	}
+	for _, input := range []string{"r1.5 !", "sidle !", "pD 6 0 !"} {
+		vc, err := parser.ParseString(input, input)
+		if err != nil {
+			t.Fatalf("parse error: input:`%+v`: %+v", input, err)
+		}
+		if _, err := vc.Value(); err == nil {
+			t.Errorf("%q: want error", input)
+		}
+	}
+}
+
+func TestRealAndStringValues(t *testing.T) {
+	t.Parallel()
+	parser := NewSimulationParser[ValueChangeT]()
+	vc, err := parser.ParseString("", "r-1.5e3 !")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if f, err := vc.VectorValueChange.VectorValueChange3.Float64(); err != nil || f != -1500 {
+		t.Errorf("Float64: want: -1500, got: %v, %v", f, err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sidle !`, "idle"},
+		{`sHello,\x20world! !`, "Hello, world!"},
+		{`sa\tb\nc\\d\r !`, "a\tb\nc\\d\r"},
+	}
+	for _, test := range tests {
+		vc, err := parser.ParseString(test.input, test.input)
+		if err != nil {
+			t.Fatalf("parse error: input:`%+v`: %+v", test.input, err)
+		}
+		s, err := vc.VectorValueChange.VectorValueChange2.Text()
+		if err != nil || s != test.expected {
+			t.Errorf("%q: want: %q, got: %q, %v", test.input, test.expected, s, err)
+		}
+	}
+	for _, input := range []string{`sa\ !`, `sa\q !`, `sa\x2 !`, `sa\xgg !`} {
+		vc, err := parser.ParseString(input, input)
+		if err != nil {
+			t.Fatalf("parse error: input:`%+v`: %+v", input, err)
+		}
+		if _, err := vc.VectorValueChange.VectorValueChange2.Text(); err == nil {
+			t.Errorf("%q: want error", input)
+		}
+	}
+}
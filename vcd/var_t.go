@@ -2,16 +2,28 @@ package vcd
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
-
-	participle "github.com/alecthomas/participle/v2"
+	"unicode"
 )
 
+// IdT is the reference of a variable: its name, and the indices of a bit or
+// of a range of bits, such as `data[7:0]`.
+//
+// Names may be escaped identifiers: Verilog's end at whitespace, as in
+// `\bus[3] ` or `\a.b `, and VHDL's extended identifiers are enclosed in
+// backslashes, as in `\my signal\`. Name is the name without the escapes,
+// such as `bus[3]` or `my signal`, and Raw is the name as it was written, if
+// it was escaped. Names that are not escaped may have any characters but
+// whitespace, such as the dots of generate blocks or `$`.
 type IdT struct {
-	Name    string  `parser:"@Ident" json:",omitempty"`
-	Indices []*IdxT `parser:"@@*" json:",omitempty"`
+	Name    string  `json:",omitempty"`
+	Indices []*IdxT `json:",omitempty"`
+	Raw     string  `json:",omitempty"`
 }
 
+// String returns the name and the indices, such as `data[7:0]`, without
+// escapes. The paths of Hierarchy are made of these.
 func (self IdT) String() string {
 	var ret []string
 	ret = append(ret, self.Name)
@@ -21,10 +33,118 @@ func (self IdT) String() string {
 	return strings.Join(ret, "")
 }
 
+// RawString returns the reference as a VCD file has it, with the escapes.
+func (self IdT) RawString() string {
+	if self.Raw == "" {
+		return self.String()
+	}
+	ret := []string{self.Raw}
+	for _, e := range self.Indices {
+		ret = append(ret, e.AsString())
+	}
+	// An escaped name ends at whitespace.
+	return strings.Join(ret, " ")
+}
+
+// parseId parses the reference of a variable.
+func parseId(s string) (IdT, error) {
+	var ret IdT
+	s = strings.TrimSpace(s)
+	var rest string
+	if strings.HasPrefix(s, `\`) {
+		ret.Raw, rest = splitEscaped(s)
+		ret.Name = unescape(ret.Raw)
+	} else {
+		ret.Name, rest = splitPlain(s)
+	}
+	if ret.Name == "" || (ret.Raw == "" && strings.IndexFunc(ret.Name, unicode.IsSpace) >= 0) {
+		return ret, fmt.Errorf("bad name: `%v`", s)
+	}
+	indices, err := parseIndices(rest)
+	if err != nil {
+		return ret, fmt.Errorf("bad index in `%v`: %w", s, err)
+	}
+	ret.Indices = indices
+	return ret, nil
+}
+
+// splitPlain splits s, which starts with a name that is not escaped, into
+// the name and the indices that follow it. Brackets that are not followed
+// by indices only, as in `gen[0].q`, are a part of the name.
+func splitPlain(s string) (string, string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '[' && !unicode.IsSpace(rune(s[i])) {
+			continue
+		}
+		if _, err := parseIndices(s[i:]); err == nil {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// parseIndices parses the indices that follow a name, such as `[3][7:0]`.
+func parseIndices(s string) ([]*IdxT, error) {
+	var ret []*IdxT
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		var (
+			idx IdxT
+			err error
+		)
+		if idx, s, err = parseIdx(s); err != nil {
+			return nil, err
+		}
+		ret = append(ret, &idx)
+	}
+	return ret, nil
+}
+
+// splitEscaped splits s, which starts with an escaped name, into the name
+// and the rest.
+func splitEscaped(s string) (string, string) {
+	if n := extendedLen(s); n > 0 && (n == len(s) || s[n] == '[' || unicode.IsSpace(rune(s[n]))) {
+		return s[:n], s[n:]
+	}
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		i = len(s)
+	}
+	return s[:i], s[i:]
+}
+
+// extendedLen returns the length of the VHDL extended identifier at the
+// start of s, or 0 if there is none. A doubled `\` in it stands for one.
+func extendedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] != '\\':
+		case i+1 < len(s) && s[i+1] == '\\':
+			i++
+		default:
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// unescape returns the escaped name raw without the escapes. Names that are
+// not escaped are returned as they are.
+func unescape(raw string) string {
+	if !strings.HasPrefix(raw, `\`) {
+		return raw
+	}
+	if extendedLen(raw) == len(raw) {
+		return strings.ReplaceAll(raw[1:len(raw)-1], `\\`, `\`)
+	}
+	return raw[1:]
+}
+
+// IdxT is an index of a reference: either a bit, such as `[3]`, or a range
+// of bits, such as `[7:0]`. See parseIdx.
 type IdxT struct {
-	Index    *int `parser:"(\"[\" @Int \"]\"" json:",omitempty"`
-	MsbIndex *int `parser:"| \"[\" @Int" `
-	LsbIndex *int `parser:" \":\" @Int \"]\") " json:",omitempty"`
+	Index    *int `json:",omitempty"`
+	MsbIndex *int
+	LsbIndex *int `json:",omitempty"`
 }
 
 func (self IdxT) AsString() string {
@@ -43,10 +163,36 @@ func (self IdxT) AsString() string {
 	return strings.Join(ret, "")
 }
 
+// parseIdx parses an index at the start of s, such as `[3]` or `[7:0]`, and
+// returns the rest of s.
+func parseIdx(s string) (IdxT, string, error) {
+	var ret IdxT
+	end := strings.IndexByte(s, ']')
+	if !strings.HasPrefix(s, "[") || end < 0 {
+		return ret, s, fmt.Errorf("expected an index, got: `%v`", s)
+	}
+	idx, rest := s[1:end], s[end+1:]
+	msb, lsb, isRange := strings.Cut(idx, ":")
+	m, err := strconv.Atoi(strings.TrimSpace(msb))
+	if err != nil {
+		return ret, s, fmt.Errorf("expected an integer, got: `%v`", msb)
+	}
+	if !isRange {
+		ret.Index = &m
+		return ret, rest, nil
+	}
+	l, err := strconv.Atoi(strings.TrimSpace(lsb))
+	if err != nil {
+		return ret, s, fmt.Errorf("expected an integer, got: `%v`", lsb)
+	}
+	ret.MsbIndex, ret.LsbIndex = &m, &l
+	return ret, rest, nil
+}
+
 type VarT struct {
 	tokenCount int
 	varTokens  []string // Accumulated tokens that refer to the signal variable. Can be many.
-	p          *participle.Parser[IdT]
+	sizeTokens []string // Accumulated tokens of a size range, like `[7:0]`.
 
 	Kw      bool   `json:",omitempty"`
 	VarType string `json:",omitempty"`
@@ -54,28 +200,34 @@ type VarT struct {
 	Code    string `json:",omitempty"`
 	Id      IdT    `json:",omitempty"`
 	KwEnd   bool   `json:",omitempty"`
+
+	// Range is set if the size was given as a range, as extended VCD
+	// ports do: `$var port [7:0] <0 data $end`.
+	Range *IdxT `json:",omitempty"`
+
+	// Attrs are the attributes declared right before the variable, and
+	// EnumTable is the enum table that they refer to, if any. See
+	// LinkAttributes.
+	Attrs     []*AttrT    `json:",omitempty"`
+	EnumTable *EnumTableT `json:",omitempty"`
 }
 
 // Capture implements custom capturing of tokens into VarT.
 func (self *VarT) Capture(tokens []string) error {
-	if self.p == nil {
-		p, err := participle.Build[IdT](participle.UseLookahead(3))
-		if err != nil {
-			return fmt.Errorf("could not build mini parser: %w", err)
-
-		}
-		self.p = p
-	}
 	// Parsing 6 tokens total.
 	//
 	//	1    2     3 4 5   6
 	//
 	// `$var logic 1 ! clk[foo][bar] $end`
 	for _, t := range tokens {
-		t = strings.TrimSpace(t)
-		if t == "" {
+		if strings.TrimSpace(t) == "" {
+			// The whitespace in escaped names is kept.
+			if len(self.varTokens) > 0 {
+				self.varTokens = append(self.varTokens, t)
+			}
 			continue
 		}
+		t = strings.TrimSpace(t)
 		self.tokenCount++
 		switch self.tokenCount {
 		case 1: // First token to be read.
@@ -88,6 +240,14 @@ func (self *VarT) Capture(tokens []string) error {
 				return fmt.Errorf("unknown var type: `%v`", t)
 			}
 		case 3:
+			if strings.HasPrefix(t, "[") || self.sizeTokens != nil {
+				self.sizeTokens = append(self.sizeTokens, t)
+				if !strings.HasSuffix(t, "]") {
+					self.tokenCount-- // The range continues.
+					return nil
+				}
+				return self.captureRange()
+			}
 			if _, err := fmt.Sscanf(t, "%d", &self.Size); err != nil {
 				return fmt.Errorf("expected length, got: %w", err)
 			}
@@ -97,11 +257,11 @@ func (self *VarT) Capture(tokens []string) error {
 			self.tokenCount-- // Make sure we come back to handle this again, until $end.
 			if t == "$end" {  // Try to extract identifier now.
 				idString := strings.Join(self.varTokens, "")
-				id, err := self.p.ParseString("<idString>", idString)
+				id, err := parseId(idString)
 				if err != nil {
 					return fmt.Errorf("could not parse Id: `%v`: %w", idString, err)
 				}
-				self.Id = *id
+				self.Id = id
 				self.varTokens = nil
 			} else {
 				// While not accummulated yet, continue adding.
@@ -112,3 +272,16 @@ func (self *VarT) Capture(tokens []string) error {
 	}
 	return nil
 }
+
+// captureRange sets the size from the accumulated size range.
+func (self *VarT) captureRange() error {
+	r := strings.Join(self.sizeTokens, "")
+	self.sizeTokens = nil
+	var msb, lsb int
+	if _, err := fmt.Sscanf(r, "[%d:%d]", &msb, &lsb); err != nil {
+		return fmt.Errorf("expected range, got: %q: %w", r, err)
+	}
+	self.Range = &IdxT{MsbIndex: &msb, LsbIndex: &lsb}
+	self.Size = max(msb, lsb) - min(msb, lsb) + 1
+	return nil
+}
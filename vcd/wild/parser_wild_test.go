@@ -39,6 +39,20 @@ func TestParseFromTheWild(t *testing.T) {
         $enddefinitions $end
         b00000000 9#
         `, // 13
+
+		// SystemVerilog variables, as written by Verilator.
+		`$var bit 1 # clk_en $end`,
+		`$var int 32 $ count [31:0] $end`, // 15
+		`$var longint 64 % stamp [63:0] $end`,
+		`$var real 64 & ratio $end`,
+		`$var realtime 64 ' now $end`,
+		`$var shortreal 32 ( half $end`,
+		`$var enum 2 ) state $end`, // 20
+		`
+        $var real 64 & ratio $end
+        $enddefinitions $end
+        r0.25 &
+        `,
 	}
 
 	for i, test := range tests {
@@ -0,0 +1,470 @@
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes VCD text. It writes either a complete File with WriteFile,
+// or a file piece by piece:
+//
+//	w := vcd.NewWriter(out)
+//	w.DeclareScope(vcd.ScopeKindModule, "top")
+//	clk, err := w.DeclareVar(vcd.VarKindWire, 1, "clk")
+//	w.Upscope()
+//	w.EndDefinitions()
+//	w.Time(0)
+//	w.Change(clk, "0")
+//	// ...
+//	err := w.Flush()
+//
+// The output is buffered; call Flush at the end. Once a method fails, all
+// later calls return the same error.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+
+	// vars are the variables declared with DeclareVar, by code.
+	vars map[string]writerVar
+	// next is the number of the next id code to assign.
+	next int
+	// depth is the number of open scopes.
+	depth       int
+	definitions bool // Set once EndDefinitions was called.
+	time        *uint64
+}
+
+type writerVar struct {
+	kind VarKindCode
+	size int
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:    bufio.NewWriter(w),
+		vars: map[string]writerVar{},
+	}
+}
+
+// Flush writes any buffered output.
+func (self *Writer) Flush() error {
+	if self.err != nil {
+		return self.err
+	}
+	if err := self.w.Flush(); err != nil {
+		self.err = fmt.Errorf("vcd.Writer.Flush: %w", err)
+	}
+	return self.err
+}
+
+// printf writes formatted output, unless a previous write failed.
+func (self *Writer) printf(format string, args ...any) error {
+	if self.err != nil {
+		return self.err
+	}
+	if _, err := fmt.Fprintf(self.w, format, args...); err != nil {
+		self.err = fmt.Errorf("vcd.Writer: %w", err)
+	}
+	return self.err
+}
+
+// fail records and returns an error of the method op.
+func (self *Writer) fail(op, format string, args ...any) error {
+	if self.err == nil {
+		self.err = fmt.Errorf("vcd.Writer.%v: %v", op, fmt.Sprintf(format, args...))
+	}
+	return self.err
+}
+
+// WriteFile writes f. The parser from NewParser[File] reads the output back
+// into a File equal to f, except for the positions of the value changes.
+func (self *Writer) WriteFile(f *File) error {
+	for _, d := range f.DeclarationCommand {
+		if err := self.writeDeclaration(d); err != nil {
+			return err
+		}
+	}
+	for _, c := range f.SimulationCommand {
+		if err := self.writeSimulationCommand(c); err != nil {
+			return err
+		}
+	}
+	return self.err
+}
+
+func (self *Writer) writeDeclaration(d *DeclarationCommandT) error {
+	switch {
+	case d.CommentText != nil:
+		return self.writeText("$comment", *d.CommentText)
+	case d.Date != nil:
+		return self.writeText("$date", *d.Date)
+	case d.Version != nil:
+		return self.writeText("$version", *d.Version)
+	case d.Var != nil:
+		v := d.Var
+		size := strconv.Itoa(v.Size)
+		if v.Range != nil {
+			size = v.Range.AsString()
+		}
+		return self.printf("$var %v %v %v %v $end\n", v.VarType, size, v.Code, v.Id.RawString())
+	case d.Attrbegin != nil:
+		return self.writeAttr(d.Attrbegin)
+	case d.Attrend != nil:
+		return self.printf("$attrend $end\n")
+	case d.EndDefinitions != nil:
+		self.definitions = true
+		return self.printf("$enddefinitions $end\n")
+	case d.Scope != nil:
+		kind := d.Scope.ScopeKind.Kind()
+		if kind == ScopeKindUnknown {
+			return self.fail("WriteFile", "unknown scope kind: %+v", d.Scope)
+		}
+		return self.printf("$scope %v %v $end\n", kind, d.Scope.Id)
+	case d.Timescale != nil:
+		t := d.Timescale
+		if t.Unit == nil {
+			return self.fail("WriteFile", "timescale without a unit: %+v", t)
+		}
+		return self.printf("$timescale %v %v $end\n", t.Number, t.Unit)
+	case d.Upscope != nil:
+		return self.printf("$upscope $end\n")
+	}
+	return self.fail("WriteFile", "empty declaration")
+}
+
+// writeText writes a command such as $comment from its text, as the parser
+// captures it: the keyword, the words without the whitespace between them,
+// and `$end` with the whitespace following it.
+func (self *Writer) writeText(kw, text string) error {
+	body, ws, ok := strings.Cut(strings.TrimPrefix(text, kw), "$end")
+	if !ok {
+		return self.fail("WriteFile", "%v without $end: %q", kw, text)
+	}
+	if ws == "" {
+		// At the end of the input, which this may not be.
+		ws = "\n"
+	}
+	if body == "" {
+		return self.printf("%v $end%v", kw, ws)
+	}
+	return self.printf("%v %v $end%v", kw, body, ws)
+}
+
+func (self *Writer) writeAttr(a *AttrT) error {
+	return self.printf("$attrbegin %v $end\n", a)
+}
+
+func (self *Writer) writeSimulationCommand(c *SimulationCommandT) error {
+	switch {
+	case c.SimulationTime != nil:
+		return self.printf("%v\n", c.SimulationTime.DecimalNumber)
+	case c.ValueChange != nil:
+		return self.writeValueChange(c.ValueChange)
+	case c.Dumpall != nil:
+		return self.writeBlock("$dumpall", c.Dumpall.ValueChange)
+	case c.Dumpoff != nil:
+		return self.writeBlock("$dumpoff", c.Dumpoff.ValueChange)
+	case c.Dumpon != nil:
+		return self.writeBlock("$dumpon", c.Dumpon.ValueChange)
+	case c.Dumpvars != nil:
+		return self.writeBlock("$dumpvars", c.Dumpvars.ValueChange)
+	case c.Dumpportsall != nil:
+		return self.writeBlock("$dumpportsall", c.Dumpportsall.ValueChange)
+	case c.Dumpportsoff != nil:
+		return self.writeBlock("$dumpportsoff", c.Dumpportsoff.ValueChange)
+	case c.Dumpportson != nil:
+		return self.writeBlock("$dumpportson", c.Dumpportson.ValueChange)
+	case c.Dumpports != nil:
+		return self.writeBlock("$dumpports", c.Dumpports.ValueChange)
+	case c.CommentText != nil:
+		return self.writeText("$comment", *c.CommentText)
+	case c.Attrbegin != nil:
+		return self.writeAttr(c.Attrbegin)
+	case c.Attrend != nil:
+		return self.printf("$attrend $end\n")
+	case c.Vcdclose != nil:
+		if t := c.Vcdclose.SimulationTime; t != nil {
+			return self.printf("$vcdclose %v $end\n", t.DecimalNumber)
+		}
+		return self.printf("$vcdclose $end\n")
+	}
+	return self.fail("WriteFile", "empty simulation command")
+}
+
+func (self *Writer) writeBlock(kw string, vcs []*ValueChangeT) error {
+	self.printf("%v\n", kw)
+	for _, vc := range vcs {
+		self.writeValueChange(vc)
+	}
+	return self.printf("$end\n")
+}
+
+func (self *Writer) writeValueChange(vc *ValueChangeT) error {
+	switch {
+	case vc.ScalarValueChange != nil:
+		s := vc.ScalarValueChange
+		if s.Garble != "" {
+			// The value and the id code without a space between them.
+			return self.printf("%v\n", s.Garble)
+		}
+		return self.printf("%v %v\n", s.Value.Value, s.IdCode)
+	case vc.VectorValueChange != nil:
+		v := vc.VectorValueChange
+		switch {
+		case v.VectorValueChange1 != nil:
+			return self.printf("%v %v\n", v.VectorValueChange1.Value, v.VectorValueChange1.IdCode)
+		case v.VectorValueChange2 != nil:
+			return self.printf("%v %v\n", v.VectorValueChange2.Value, v.VectorValueChange2.IdCode)
+		case v.VectorValueChange3 != nil:
+			return self.printf("%v %v\n", v.VectorValueChange3.Value, v.VectorValueChange3.IdCode)
+		}
+	case vc.PortValueChange != nil:
+		p := vc.PortValueChange
+		return self.printf("%v %v %v %v\n", p.Value, p.Strength0, p.Strength1, p.IdCode)
+	}
+	return self.fail("WriteFile", "empty value change")
+}
+
+// Comment writes a $comment.
+func (self *Writer) Comment(text string) error {
+	return self.printf("$comment %v $end\n", text)
+}
+
+// Date writes the $date declaration.
+func (self *Writer) Date(text string) error {
+	return self.printf("$date %v $end\n", text)
+}
+
+// Version writes the $version declaration.
+func (self *Writer) Version(text string) error {
+	return self.printf("$version %v $end\n", text)
+}
+
+// Timescale writes the $timescale declaration, such as `1 ns`.
+func (self *Writer) Timescale(number int64, unit string) error {
+	switch unit {
+	case "s", "ms", "us", "ns", "ps", "fs":
+	default:
+		return self.fail("Timescale", "unknown unit: %q", unit)
+	}
+	return self.printf("$timescale %v %v $end\n", number, unit)
+}
+
+// DeclareScope opens a scope. Close it with Upscope.
+func (self *Writer) DeclareScope(kind ScopeKindCode, name string) error {
+	if self.definitions {
+		return self.fail("DeclareScope", "scope after the definitions: %v", name)
+	}
+	if kind < 0 || kind >= ScopeKindUnknown {
+		return self.fail("DeclareScope", "unknown scope kind: %v", int(kind))
+	}
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return self.fail("DeclareScope", "bad scope name: %q", name)
+	}
+	self.depth++
+	return self.printf("$scope %v %v $end\n", kind, name)
+}
+
+// Upscope closes the innermost scope.
+func (self *Writer) Upscope() error {
+	if self.depth == 0 {
+		return self.fail("Upscope", "no open scope")
+	}
+	self.depth--
+	return self.printf("$upscope $end\n")
+}
+
+// DeclareVar declares a variable in the current scope, and returns the id
+// code assigned to it. The name may have indices, such as `data[7:0]`.
+func (self *Writer) DeclareVar(kind VarKindCode, size int, name string) (string, error) {
+	if err := self.checkVar("DeclareVar", kind, size, name); err != nil {
+		return "", err
+	}
+	code := self.nextIdCode()
+	self.vars[code] = writerVar{kind: kind, size: size}
+	return code, self.printf("$var %v %v %v %v $end\n", kind, size, code, name)
+}
+
+// DeclareAlias declares a variable in the current scope with the id code of
+// a variable that was declared before, so that both have the same values.
+func (self *Writer) DeclareAlias(kind VarKindCode, size int, name, code string) error {
+	if err := self.checkVar("DeclareAlias", kind, size, name); err != nil {
+		return err
+	}
+	if _, ok := self.vars[code]; !ok {
+		return self.fail("DeclareAlias", "unknown id code: %q", code)
+	}
+	return self.printf("$var %v %v %v %v $end\n", kind, size, code, name)
+}
+
+func (self *Writer) checkVar(op string, kind VarKindCode, size int, name string) error {
+	if self.definitions {
+		return self.fail(op, "variable after the definitions: %v", name)
+	}
+	if kind < 0 || kind >= VarKindUnknown {
+		return self.fail(op, "unknown variable kind: %v", int(kind))
+	}
+	if size < 1 {
+		return self.fail(op, "bad size: %v: %v", name, size)
+	}
+	if name == "" {
+		return self.fail(op, "empty variable name")
+	}
+	return self.err
+}
+
+// Attr writes an $attrbegin, which annotates the scope or variable declared
+// next. The name may be empty. See AttrT.
+func (self *Writer) Attr(kind AttrKindCode, subtype int, name string, arg int64) error {
+	if kind < 0 || kind >= AttrKindUnknown {
+		return self.fail("Attr", "unknown attribute kind: %v", int(kind))
+	}
+	return self.writeAttr(&AttrT{Kind: kind.String(), Subtype: subtype, Name: name, Arg: arg})
+}
+
+// Attrend writes an $attrend.
+func (self *Writer) Attrend() error {
+	return self.printf("$attrend $end\n")
+}
+
+// EndDefinitions ends the declarations. Any open scopes are closed first.
+func (self *Writer) EndDefinitions() error {
+	if self.definitions {
+		return self.fail("EndDefinitions", "called twice")
+	}
+	for self.depth > 0 {
+		self.Upscope()
+	}
+	self.definitions = true
+	return self.printf("$enddefinitions $end\n")
+}
+
+// Time sets the simulation time of the changes that follow. The time may
+// not go backwards. A time equal to the current one is not written again.
+func (self *Writer) Time(t uint64) error {
+	if !self.definitions {
+		return self.fail("Time", "time before the end of the definitions")
+	}
+	if self.time != nil {
+		if t < *self.time {
+			return self.fail("Time", "time goes backwards: %v < %v", t, *self.time)
+		}
+		if t == *self.time {
+			return self.err
+		}
+	}
+	self.time = &t
+	return self.printf("#%v\n", t)
+}
+
+// Change writes a new value of the variable with the given code. The value
+// is written as the kind of the variable requires: bits such as `10xz` or
+// `UX01ZWLH-` for most kinds, a number for real variables, and any text for strings.
+// Ports need ChangePort.
+func (self *Writer) Change(code, value string) error {
+	v, err := self.lookup("Change", code)
+	if err != nil {
+		return err
+	}
+	switch v.kind.Encoding() {
+	case EncodingReal:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return self.fail("Change", "not a real value: %v: %q", code, value)
+		}
+		return self.printf("r%v %v\n", value, code)
+	case EncodingString:
+		if value == "" {
+			return self.fail("Change", "empty string value: %v", code)
+		}
+		return self.printf("s%v %v\n", escapeText(value), code)
+	case EncodingPort:
+		return self.fail("Change", "port value without strengths: %v", code)
+	}
+	if value == "" || strings.Trim(value, "01xzuwlhXZUWLH-") != "" {
+		return self.fail("Change", "not a vector value: %v: %q", code, value)
+	}
+	if v.size == 1 && len(value) == 1 && isScalarValue(value[0]) {
+		return self.printf("%v%v\n", value, code)
+	}
+	return self.printf("b%v %v\n", value, code)
+}
+
+// ChangePort writes a new value of an extended VCD port, such as `D` with
+// the strengths 6 and 0.
+func (self *Writer) ChangePort(code, value string, strength0, strength1 int) error {
+	v, err := self.lookup("ChangePort", code)
+	if err != nil {
+		return err
+	}
+	if v.kind != VarKindPort {
+		return self.fail("ChangePort", "not a port: %v", code)
+	}
+	if value == "" || strings.IndexFunc(value, func(c rune) bool { return c > 0x7f || !isPortState(byte(c)) }) >= 0 {
+		return self.fail("ChangePort", "not a port value: %v: %q", code, value)
+	}
+	if strength0 < 0 || strength0 > 7 || strength1 < 0 || strength1 > 7 {
+		return self.fail("ChangePort", "bad strengths: %v: %v %v", code, strength0, strength1)
+	}
+	return self.printf("p%v %v %v %v\n", value, strength0, strength1, code)
+}
+
+func (self *Writer) lookup(op, code string) (writerVar, error) {
+	if self.err != nil {
+		return writerVar{}, self.err
+	}
+	if !self.definitions {
+		return writerVar{}, self.fail(op, "value change before the end of the definitions")
+	}
+	v, ok := self.vars[code]
+	if !ok {
+		return writerVar{}, self.fail(op, "unknown id code: %q", code)
+	}
+	return v, nil
+}
+
+// nextIdCode returns the next unused id code. Codes are made of the
+// printable ASCII characters, the shortest ones first. Codes that would lex
+// as something else, like `#1` as a timestamp, are skipped.
+func (self *Writer) nextIdCode() string {
+	const first, base = '!', '~' - '!' + 1
+	for {
+		var ret []byte
+		for n := self.next; ; n = n/base - 1 {
+			ret = append([]byte{byte(first + n%base)}, ret...)
+			if n < base {
+				break
+			}
+		}
+		self.next++
+		if !strings.ContainsRune("#$bBrR|sp", rune(ret[0])) {
+			return string(ret)
+		}
+	}
+}
+
+// escapeText escapes the whitespace and backslashes of a string value, the
+// reverse of VectorValueChange2T.Text.
+func escapeText(s string) string {
+	var ret strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			ret.WriteString(`\\`)
+		case '\n':
+			ret.WriteString(`\n`)
+		case '\t':
+			ret.WriteString(`\t`)
+		case '\r':
+			ret.WriteString(`\r`)
+		case ' ', '\f', '\v':
+			fmt.Fprintf(&ret, `\x%02x`, c)
+		default:
+			ret.WriteByte(c)
+		}
+	}
+	return ret.String()
+}
@@ -0,0 +1,256 @@
+package vcd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/davecgh/go-spew/spew"
+)
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.Date("today")
+	w.Timescale(1, "ns")
+	w.DeclareScope(ScopeKindModule, "top")
+	clk, _ := w.DeclareVar(VarKindWire, 1, "clk")
+	data, _ := w.DeclareVar(VarKindReg, 4, "data[3:0]")
+	w.DeclareScope(ScopeKindInterface, "bus_if")
+	r, _ := w.DeclareVar(VarKindReal, 1, "r")
+	s, _ := w.DeclareVar(VarKindString, 1, "state")
+	p, _ := w.DeclareVar(VarKindPort, 1, "pin")
+	w.EndDefinitions()
+	w.Time(0)
+	w.Change(clk, "0")
+	w.Change(data, "10xz")
+	w.Change(r, "1.5")
+	w.Change(s, "a b\\c")
+	w.ChangePort(p, "D", 6, 0)
+	w.Time(10)
+	w.Time(10)
+	w.Change(clk, "u")
+	w.Comment("done")
+	if err := w.Flush(); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	const expected = `$date today $end
+$timescale 1 ns $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 4 " data[3:0] $end
+$scope interface bus_if $end
+$var real 1 % r $end
+$var string 1 & state $end
+$var port 1 ' pin $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+0!
+b10xz "
+r1.5 %
+sa\x20b\\c &
+pD 6 0 '
+#10
+u!
+$comment done $end
+`
+	if b.String() != expected {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", expected, b.String())
+	}
+
+	// The output must read back.
+	f, err := NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read back: %v", err)
+	}
+	var text string
+	for _, c := range f.SimulationCommand {
+		if vc := c.ValueChange; vc != nil && vc.Encoding() == EncodingString {
+			text, err = vc.VectorValueChange.VectorValueChange2.Text()
+		}
+	}
+	if err != nil || text != "a b\\c" {
+		t.Errorf("string value: want: %q, got: %q, %v", "a b\\c", text, err)
+	}
+}
+
+func TestWriterAliasAttr(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.DeclareScope(ScopeKindModule, "top")
+	w.Attr(AttrKindMisc, 4, "top.v", 12)
+	clk, _ := w.DeclareVar(VarKindWire, 1, "clk")
+	w.Attrend()
+	w.DeclareAlias(VarKindWire, 1, "clk_copy", clk)
+	w.EndDefinitions()
+	w.Time(0)
+	w.Change(clk, "1")
+	if err := w.Flush(); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	const expected = `$scope module top $end
+$attrbegin misc 04 top.v 12 $end
+$var wire 1 ! clk $end
+$attrend $end
+$var wire 1 ! clk_copy $end
+$upscope $end
+$enddefinitions $end
+#0
+1!
+`
+	if b.String() != expected {
+		t.Errorf("\nwant:\n%v\ngot:\n%v", expected, b.String())
+	}
+	h, err := ParseHeader(&b)
+	if err != nil {
+		t.Fatalf("could not read back: %v", err)
+	}
+	if vars := h.Hierarchy.Aliases(clk); len(vars) != 2 || vars[1].Path != "/top/clk_copy" {
+		t.Errorf("aliases of %q: %v", clk, vars)
+	}
+}
+
+func TestWriterIdCodes(t *testing.T) {
+	t.Parallel()
+	w := NewWriter(&bytes.Buffer{})
+	seen := map[string]bool{}
+	for i := 0; i < 20000; i++ {
+		code := w.nextIdCode()
+		if seen[code] {
+			t.Fatalf("duplicate code: %q", code)
+		}
+		seen[code] = true
+		if strings.ContainsAny(code[:1], "#$bBrR|sp") {
+			t.Fatalf("code lexes as something else: %q", code)
+		}
+		if i < 84 && len(code) != 1 {
+			t.Fatalf("code %v should be a single character: %q", i, code)
+		}
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		write    func(w *Writer) error
+		expected string
+	}{
+		{"upscope", func(w *Writer) error { return w.Upscope() }, "no open scope"},
+		{"time in definitions", func(w *Writer) error { return w.Time(0) }, "time before the end"},
+		{"unknown code", func(w *Writer) error {
+			w.EndDefinitions()
+			return w.Change("!", "1")
+		}, "unknown id code"},
+		{"time goes backwards", func(w *Writer) error {
+			w.EndDefinitions()
+			w.Time(10)
+			return w.Time(5)
+		}, "time goes backwards"},
+		{"var after definitions", func(w *Writer) error {
+			w.EndDefinitions()
+			_, err := w.DeclareVar(VarKindWire, 1, "a")
+			return err
+		}, "variable after the definitions"},
+		{"bad vector", func(w *Writer) error {
+			c, _ := w.DeclareVar(VarKindWire, 2, "a")
+			w.EndDefinitions()
+			return w.Change(c, "12")
+		}, "not a vector value"},
+		{"bad real", func(w *Writer) error {
+			c, _ := w.DeclareVar(VarKindReal, 1, "a")
+			w.EndDefinitions()
+			return w.Change(c, "x")
+		}, "not a real value"},
+		{"port without strengths", func(w *Writer) error {
+			c, _ := w.DeclareVar(VarKindPort, 1, "a")
+			w.EndDefinitions()
+			return w.Change(c, "D")
+		}, "port value without strengths"},
+		{"alias of unknown code", func(w *Writer) error {
+			return w.DeclareAlias(VarKindWire, 1, "a", "!")
+		}, "unknown id code"},
+		{"unknown attribute kind", func(w *Writer) error {
+			return w.Attr(AttrKindUnknown, 0, "a", 0)
+		}, "unknown attribute kind"},
+		{"bad timescale", func(w *Writer) error { return w.Timescale(1, "ks") }, "unknown unit"},
+		{"sticky", func(w *Writer) error {
+			w.Upscope()
+			return w.Comment("x")
+		}, "no open scope"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			err := test.write(NewWriter(&bytes.Buffer{}))
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("want: %q, got: %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	t.Parallel()
+	const input = `$comment  a   b $end  
+$attrbegin misc 07 state_t 2 IDLE RUN 0 1 1 $end
+$scope vhdl_process p $end
+$attrbegin misc 07 1 $end
+$var logic [1:0] ! state $end
+$attrend $end
+$var wire 1 " x [3] $end
+$var wire 2 # \bus[3] [1:0] $end
+$var logic 1 $ \my signal\ $end
+$upscope $end
+$timescale 10 ps $end
+$enddefinitions $end
+$comment after $end
+#0
+$dumpvars 1" b0 ! $end
+1 "
+r1.5 ! sidle ! pD 6 0 !
+$vcdclose #5 $end
+$comment last $end`
+	parser := NewParser[File]()
+	expected, err := parser.ParseString("", input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if err := w.WriteFile(expected); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	actual, err := parser.ParseString("", b.String())
+	if err != nil {
+		t.Fatalf("parse error in the output: %v\n%v", err, b.String())
+	}
+	for _, f := range []*File{expected, actual} {
+		for _, c := range f.SimulationCommand {
+			if c.ValueChange != nil && c.ValueChange.ScalarValueChange != nil {
+				c.ValueChange.ScalarValueChange.Pos = lexer.Position{}
+			}
+			if c.Dumpvars != nil {
+				for _, vc := range c.Dumpvars.ValueChange {
+					if vc.ScalarValueChange != nil {
+						vc.ScalarValueChange.Pos = lexer.Position{}
+					}
+				}
+			}
+		}
+	}
+	// The writer ends the last comment with a line break.
+	*expected.SimulationCommand[len(expected.SimulationCommand)-1].CommentText += "\n"
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nwant: %v\ngot:  %v\noutput:\n%v", spew.Sdump(expected), spew.Sdump(actual), b.String())
+	}
+}
@@ -0,0 +1,439 @@
+// Package wave is an in-memory waveform store. It keeps the value changes of
+// a VCD file in compact per-signal columns, and answers the same questions as
+// the database that cvt makes, without one. It suits files that fit in
+// memory once compacted.
+package wave
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+// Handle is a dense integer that identifies a signal in a Store. The handles
+// of a Store are 0 to Len()-1.
+type Handle int
+
+// markEvery is the number of value changes between two marks. A time lookup
+// takes a binary search over the marks, and then decodes at most this many
+// timestamps.
+const markEvery = 64
+
+// mark is the absolute time of a value change, and where its delta is in
+// the times column.
+type mark struct {
+	time   uint64
+	offset int
+}
+
+// Signal is the waveform of a signal: its value changes, in the order of
+// time.
+type Signal struct {
+	Handle Handle
+	// Names are the paths of all variables with this signal, as in
+	// vcd.Hierarchy.
+	Names     []string
+	Code      string
+	Kind      vcd.VarKindCode
+	Size      int
+	EnumTable *vcd.EnumTableT
+
+	n     int
+	times []byte // The deltas between consecutive timestamps, as uvarints.
+	marks []mark // One for every markEvery value changes.
+	last  uint64 // The time of the last value change.
+
+	// The values are indexes into dict, packed into width bits each.
+	dict   []string
+	packed []uint64
+	width  int
+
+	// Only while building.
+	values  []uint32
+	indexes map[string]uint32
+}
+
+// Store is a set of waveforms.
+type Store struct {
+	hierarchy *vcd.Hierarchy
+	timescale *vcd.TimescaleT
+	signals   []*Signal
+	byCode    map[string]*Signal
+	byName    map[string]*Signal
+}
+
+// Load reads a VCD file from r into a new Store.
+func Load(r *vcd.Reader) (*Store, error) {
+	decls, err := r.Declarations()
+	if err != nil {
+		return nil, fmt.Errorf("wave.Load: %w", err)
+	}
+	ret, err := build(decls, r.Next)
+	if err != nil {
+		return nil, fmt.Errorf("wave.Load: %w", err)
+	}
+	return ret, nil
+}
+
+// FromFile makes a Store from a parsed VCD file.
+func FromFile(f *vcd.File) (*Store, error) {
+	cmds := f.SimulationCommand
+	next := func() (*vcd.SimulationCommandT, error) {
+		if len(cmds) == 0 {
+			return nil, io.EOF
+		}
+		ret := cmds[0]
+		cmds = cmds[1:]
+		return ret, nil
+	}
+	ret, err := build(f.DeclarationCommand, next)
+	if err != nil {
+		return nil, fmt.Errorf("wave.FromFile: %w", err)
+	}
+	return ret, nil
+}
+
+func build(decls []*vcd.DeclarationCommandT, next func() (*vcd.SimulationCommandT, error)) (*Store, error) {
+	vcd.LinkAttributes(decls)
+	ret := &Store{
+		byCode: map[string]*Signal{},
+		byName: map[string]*Signal{},
+	}
+	ret.hierarchy = vcd.NewHierarchy(decls)
+	for _, d := range decls {
+		if d.Timescale != nil {
+			ret.timescale = d.Timescale
+			break
+		}
+	}
+	for _, v := range ret.hierarchy.Vars() {
+		s := ret.byCode[v.Code]
+		if s == nil {
+			s = &Signal{
+				Handle:    Handle(len(ret.signals)),
+				Code:      v.Code,
+				Kind:      v.GetVarKind(),
+				Size:      v.Size,
+				EnumTable: v.EnumTable,
+				indexes:   map[string]uint32{},
+			}
+			ret.signals = append(ret.signals, s)
+			ret.byCode[v.Code] = s
+		}
+		s.Names = append(s.Names, v.Path)
+		if ret.byName[v.Path] == nil {
+			ret.byName[v.Path] = s
+		}
+	}
+	var timestamp uint64
+	for {
+		c, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.SimulationTime != nil {
+			if timestamp, err = c.SimulationTime.Value(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, vc := range c.ValueChanges() {
+			s := ret.byCode[vc.GetIdCode()]
+			if s == nil {
+				// Like the database, keep changes of undeclared signals
+				// too.
+				s = &Signal{
+					Handle:  Handle(len(ret.signals)),
+					Code:    vc.GetIdCode(),
+					indexes: map[string]uint32{},
+				}
+				ret.signals = append(ret.signals, s)
+				ret.byCode[s.Code] = s
+			}
+			if err := s.add(timestamp, vc.GetValue()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, s := range ret.signals {
+		s.pack()
+	}
+	return ret, nil
+}
+
+// add appends a value change.
+func (self *Signal) add(t uint64, value string) error {
+	if self.n > 0 && t < self.last {
+		return fmt.Errorf("time goes backwards on %q: %v after %v", self.Code, t, self.last)
+	}
+	if self.n%markEvery == 0 {
+		self.marks = append(self.marks, mark{time: t, offset: len(self.times)})
+	}
+	self.times = binary.AppendUvarint(self.times, t-self.last)
+	self.last = t
+	i, ok := self.indexes[value]
+	if !ok {
+		i = uint32(len(self.dict))
+		self.dict = append(self.dict, value)
+		self.indexes[value] = i
+	}
+	self.values = append(self.values, i)
+	self.n++
+	return nil
+}
+
+// pack packs the values with as few bits each as the dictionary needs.
+func (self *Signal) pack() {
+	self.width = max(1, bits.Len(uint(max(0, len(self.dict)-1))))
+	self.packed = make([]uint64, (self.n*self.width+63)/64)
+	for i, v := range self.values {
+		bit := i * self.width
+		self.packed[bit/64] |= uint64(v) << (bit % 64)
+		if spill := bit%64 + self.width - 64; spill > 0 {
+			self.packed[bit/64+1] |= uint64(v) >> (self.width - spill)
+		}
+	}
+	self.times = self.times[:len(self.times):len(self.times)]
+	self.values, self.indexes = nil, nil
+}
+
+// valueIndex returns the dictionary index of the value of change i.
+func (self *Signal) valueIndex(i int) uint32 {
+	bit := i * self.width
+	v := self.packed[bit/64] >> (bit % 64)
+	if spill := bit%64 + self.width - 64; spill > 0 {
+		v |= self.packed[bit/64+1] << (self.width - spill)
+	}
+	return uint32(v & (1<<self.width - 1))
+}
+
+// Len returns the number of signals in the store.
+func (self *Store) Len() int {
+	return len(self.signals)
+}
+
+// Signal returns the signal with the handle h.
+func (self *Store) Signal(h Handle) *Signal {
+	return self.signals[h]
+}
+
+// Signals returns all signals, in the order of their handles.
+func (self *Store) Signals() []*Signal {
+	return self.signals
+}
+
+// Lookup returns the signal of the variable with the path name, or nil if
+// there is none.
+func (self *Store) Lookup(name string) *Signal {
+	return self.byName[name]
+}
+
+// Hierarchy returns the scopes and variables of the store, whose paths are
+// the names of the signals.
+func (self *Store) Hierarchy() *vcd.Hierarchy {
+	return self.hierarchy
+}
+
+// Timescale returns the timescale of the times, or nil if the file declares
+// none.
+func (self *Store) Timescale() *vcd.TimescaleT {
+	return self.timescale
+}
+
+// ByCode returns the signal with the id code, or nil if there is none.
+func (self *Store) ByCode(code string) *Signal {
+	return self.byCode[code]
+}
+
+// Len returns the number of value changes.
+func (self *Signal) Len() int {
+	return self.n
+}
+
+// Time returns the time of value change i.
+func (self *Signal) Time(i int) uint64 {
+	m := self.marks[i/markEvery]
+	t, off := m.time, m.offset
+	// The delta at the mark is already in its time.
+	_, k := binary.Uvarint(self.times[off:])
+	off += k
+	for j := i - i%markEvery; j < i; j++ {
+		d, k := binary.Uvarint(self.times[off:])
+		t, off = t+d, off+k
+	}
+	return t
+}
+
+// Value returns the value of value change i.
+func (self *Signal) Value(i int) string {
+	return self.dict[self.valueIndex(i)]
+}
+
+// Search returns the number of value changes at or before time t, which is
+// the index of the first value change after t.
+func (self *Signal) Search(t uint64) int {
+	// The first mark after t; the change is in the block before it.
+	m := sort.Search(len(self.marks), func(i int) bool {
+		return self.marks[i].time > t
+	})
+	if m == 0 {
+		return 0
+	}
+	m--
+	i, end := m*markEvery, min(self.n, (m+1)*markEvery)
+	tt, off := self.marks[m].time, self.marks[m].offset
+	_, k := binary.Uvarint(self.times[off:])
+	off += k
+	for i++; i < end; i++ {
+		d, k := binary.Uvarint(self.times[off:])
+		if tt+d > t {
+			break
+		}
+		tt, off = tt+d, off+k
+	}
+	return i
+}
+
+// ValueAt returns the value at time t, including a change right at t.
+// Returns false before the first value change.
+func (self *Signal) ValueAt(t uint64) (string, bool) {
+	i := self.Search(t)
+	if i == 0 {
+		return "", false
+	}
+	return self.Value(i - 1), true
+}
+
+// ValueBefore returns the value right before time t, not including a
+// change right at t. Returns false if there is no change before t.
+func (self *Signal) ValueBefore(t uint64) (string, bool) {
+	if t == 0 {
+		return "", false
+	}
+	return self.ValueAt(t - 1)
+}
+
+// PrevChange returns the time of the last value change before t, and the
+// value after it.
+func (self *Signal) PrevChange(t uint64) (uint64, string, bool) {
+	if t == 0 {
+		return 0, "", false
+	}
+	i := self.Search(t - 1)
+	if i == 0 {
+		return 0, "", false
+	}
+	return self.Time(i - 1), self.Value(i - 1), true
+}
+
+// NextChange returns the time of the first value change after t, and the
+// value after it. If there are several changes at that time, the value is
+// that of the last one.
+func (self *Signal) NextChange(t uint64) (uint64, string, bool) {
+	i := self.Search(t)
+	if i == self.n {
+		return 0, "", false
+	}
+	next := self.Time(i)
+	j := self.Search(next)
+	return next, self.Value(j - 1), true
+}
+
+// matching returns which of the values in the dictionary match, and whether
+// any of them does.
+func (self *Signal) matching(match func(string) bool) ([]bool, bool) {
+	ret := make([]bool, len(self.dict))
+	var found bool
+	for i, d := range self.dict {
+		ret[i] = match(d)
+		found = found || ret[i]
+	}
+	return ret, found
+}
+
+// equal returns a function that matches the value v.
+func equal(v string) func(string) bool {
+	return func(d string) bool {
+		return d == v
+	}
+}
+
+// FindAfter returns the time of the first value change to the value v after
+// time t.
+func (self *Signal) FindAfter(t uint64, v string) (uint64, bool) {
+	return self.FindAfterFunc(t, equal(v))
+}
+
+// FindAfterFunc returns the time of the first value change after time t to
+// a value for which match returns true.
+func (self *Signal) FindAfterFunc(t uint64, match func(string) bool) (uint64, bool) {
+	return self.findFrom(self.Search(t), match)
+}
+
+// findFrom returns the time of the first value change to a matching value
+// from value change i on.
+func (self *Signal) findFrom(i int, match func(string) bool) (uint64, bool) {
+	m, ok := self.matching(match)
+	if !ok {
+		return 0, false
+	}
+	for ; i < self.n; i++ {
+		if m[self.valueIndex(i)] {
+			return self.Time(i), true
+		}
+	}
+	return 0, false
+}
+
+// FindBefore returns the time of the last value change to the value v
+// before time t.
+func (self *Signal) FindBefore(t uint64, v string) (uint64, bool) {
+	return self.FindBeforeFunc(t, equal(v))
+}
+
+// FindBeforeFunc returns the time of the last value change before time t to
+// a value for which match returns true.
+func (self *Signal) FindBeforeFunc(t uint64, match func(string) bool) (uint64, bool) {
+	m, ok := self.matching(match)
+	if !ok || t == 0 {
+		return 0, false
+	}
+	for i := self.Search(t-1) - 1; i >= 0; i-- {
+		if m[self.valueIndex(i)] {
+			return self.Time(i), true
+		}
+	}
+	return 0, false
+}
+
+// FindFirst returns the time of the first value change to the value v.
+func (self *Signal) FindFirst(v string) (uint64, bool) {
+	return self.FindFirstFunc(equal(v))
+}
+
+// FindFirstFunc returns the time of the first value change to a value for
+// which match returns true.
+func (self *Signal) FindFirstFunc(match func(string) bool) (uint64, bool) {
+	return self.findFrom(0, match)
+}
+
+// Name returns the name of the value v in the enum table of the signal, or an
+// empty string if it has none.
+func (self *Signal) Name(v string) string {
+	if self.EnumTable == nil {
+		return ""
+	}
+	value, err := vcd.ParseValue(v)
+	if err != nil {
+		return ""
+	}
+	name, _ := self.EnumTable.Lookup(value)
+	return name
+}
@@ -0,0 +1,145 @@
+package wave
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/filmil/go-vcd-parser/vcd"
+)
+
+const testVCD = `
+$attrbegin misc 07 state_t 3 IDLE RUN WAIT 00 01 10 1 $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var reg 4 " data[3:0] $end
+$attrbegin misc 07 1 $end
+$var logic 2 # state $end
+$scope module cpu $end
+$var wire 1 ! clk $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars 0! b0 " b0 # $end
+#10
+1!
+b1010 "
+b1 #
+#20
+0!
+1!
+#30
+b10 #
+`
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	s, err := Load(vcd.NewReader(strings.NewReader(testVCD)))
+	if err != nil {
+		t.Fatalf("could not load: %v", err)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("want 3 signals, got: %v", s.Len())
+	}
+	clk := s.Lookup("/top/cpu/clk")
+	if clk == nil || clk != s.Lookup("/top/clk") || clk != s.ByCode("!") || s.Signal(clk.Handle) != clk {
+		t.Fatalf("aliases: %+v", clk)
+	}
+	if strings.Join(clk.Names, " ") != "/top/clk /top/cpu/clk" || clk.Len() != 4 {
+		t.Errorf("clk: %+v", clk)
+	}
+	tests := []struct {
+		name     string
+		actual   func() any
+		expected any
+	}{
+		{"ValueAt(0)", func() any { v, ok := clk.ValueAt(0); return str(v, ok) }, "0 true"},
+		{"ValueAt(20)", func() any { v, ok := clk.ValueAt(20); return str(v, ok) }, "1 true"},
+		{"ValueBefore(20)", func() any { v, ok := clk.ValueBefore(20); return str(v, ok) }, "1 true"},
+		{"ValueBefore(0)", func() any { v, ok := clk.ValueBefore(0); return str(v, ok) }, "false"},
+		{"PrevChange(20)", func() any { t, v, ok := clk.PrevChange(20); return str(t, v, ok) }, "10 1 true"},
+		{"NextChange(10)", func() any { t, v, ok := clk.NextChange(10); return str(t, v, ok) }, "20 1 true"},
+		{"NextChange(20)", func() any { t, v, ok := clk.NextChange(20); return str(t, v, ok) }, "0  false"},
+		{"FindFirst(1)", func() any { t, ok := clk.FindFirst("1"); return str(t, ok) }, "10 true"},
+		{"FindFirst(0)", func() any { t, ok := clk.FindFirst("0"); return str(t, ok) }, "0 true"},
+		{"FindAfter(10, 1)", func() any { t, ok := clk.FindAfter(10, "1"); return str(t, ok) }, "20 true"},
+		{"FindBefore(20, 0)", func() any { t, ok := clk.FindBefore(20, "0"); return str(t, ok) }, "0 true"},
+		{"FindFirst(z)", func() any { t, ok := clk.FindFirst("z"); return str(t, ok) }, "0 false"},
+		{"FindAfterFunc(0, not 0)", func() any {
+			t, ok := clk.FindAfterFunc(0, func(v string) bool { return v != "0" })
+			return str(t, ok)
+		}, "10 true"},
+		{"Name", func() any { return s.Lookup("/top/state").Name("10") }, "WAIT"},
+		{"no Name", func() any { return s.Lookup("/top/data[3:0]").Name("1010") }, ""},
+	}
+	for _, test := range tests {
+		if actual := test.actual(); actual != test.expected {
+			t.Errorf("%v: want: %q, got: %q", test.name, test.expected, actual)
+		}
+	}
+}
+
+// TestStoreRandom checks the lookups against a plain list of changes.
+func TestStoreRandom(t *testing.T) {
+	t.Parallel()
+	rnd := rand.New(rand.NewSource(1))
+	for _, values := range []int{1, 2, 3, 200, 100000} {
+		w := &strings.Builder{}
+		vw := vcd.NewWriter(w)
+		code, _ := vw.DeclareVar(vcd.VarKindInteger, 32, "v")
+		vw.EndDefinitions()
+		type change struct {
+			t uint64
+			v string
+		}
+		var changes []change
+		var now uint64
+		for i := 0; i < 1000; i++ {
+			now += uint64(rnd.Intn(3)) * uint64(1+rnd.Intn(1000))
+			v := fmt.Sprintf("%b", rnd.Intn(values))
+			vw.Time(now)
+			vw.Change(code, v)
+			changes = append(changes, change{now, v})
+		}
+		if err := vw.Flush(); err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+		s, err := Load(vcd.NewReader(strings.NewReader(w.String())))
+		if err != nil {
+			t.Fatalf("could not load: %v", err)
+		}
+		sig := s.Lookup("/v")
+		if sig.Len() != len(changes) {
+			t.Fatalf("want %v changes, got: %v", len(changes), sig.Len())
+		}
+		for i, c := range changes {
+			if sig.Time(i) != c.t || sig.Value(i) != c.v {
+				t.Fatalf("change %v: want: %v, got: %v %v", i, c, sig.Time(i), sig.Value(i))
+			}
+		}
+		for q := uint64(0); q <= now+1; q += 1 + uint64(rnd.Intn(50)) {
+			expected := 0
+			for expected < len(changes) && changes[expected].t <= q {
+				expected++
+			}
+			if actual := sig.Search(q); actual != expected {
+				t.Fatalf("Search(%v): want: %v, got: %v", q, expected, actual)
+			}
+		}
+	}
+}
+
+// str formats args with spaces between all of them.
+func str(args ...any) string {
+	return strings.TrimSpace(fmt.Sprintln(args...))
+}
+
+func TestStoreTimeBackwards(t *testing.T) {
+	t.Parallel()
+	input := "$var wire 1 ! clk $end $enddefinitions $end #10 1! #5 0!"
+	if _, err := Load(vcd.NewReader(strings.NewReader(input))); err == nil {
+		t.Errorf("want an error")
+	}
+}